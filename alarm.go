@@ -0,0 +1,71 @@
+package lambroll
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// alarmCheckInterval is an interval to check CloudWatch alarms during canary deployment
+var alarmCheckInterval = 30 * time.Second
+
+type alarmError struct {
+	names []string
+}
+
+func (e *alarmError) Error() string {
+	return fmt.Sprintf("alarm %s is in %s state", strings.Join(e.names, ","), cwtypes.StateValueAlarm)
+}
+
+// checkAlarms returns an alarmError if any of alarms is in ALARM state
+func (app *App) checkAlarms(ctx context.Context, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	in := &cloudwatch.DescribeAlarmsInput{
+		AlarmNames: names,
+		AlarmTypes: []cwtypes.AlarmType{
+			cwtypes.AlarmTypeMetricAlarm,
+			cwtypes.AlarmTypeCompositeAlarm,
+		},
+	}
+	found := make(map[string]bool, len(names))
+	var firing []string
+	for {
+		res, err := app.cloudwatch.DescribeAlarms(ctx, in)
+		if err != nil {
+			return fmt.Errorf("failed to describe alarms: %w", err)
+		}
+		for _, a := range res.MetricAlarms {
+			found[aws.ToString(a.AlarmName)] = true
+			app.logger.Printf("[debug] alarm %s is %s", aws.ToString(a.AlarmName), a.StateValue)
+			if a.StateValue == cwtypes.StateValueAlarm {
+				firing = append(firing, aws.ToString(a.AlarmName))
+			}
+		}
+		for _, a := range res.CompositeAlarms {
+			found[aws.ToString(a.AlarmName)] = true
+			app.logger.Printf("[debug] alarm %s is %s", aws.ToString(a.AlarmName), a.StateValue)
+			if a.StateValue == cwtypes.StateValueAlarm {
+				firing = append(firing, aws.ToString(a.AlarmName))
+			}
+		}
+		if in.NextToken = res.NextToken; in.NextToken == nil {
+			break
+		}
+	}
+	for _, name := range names {
+		if !found[name] {
+			app.logger.Printf("[warn] alarm %s is not found", name)
+		}
+	}
+	if len(firing) > 0 {
+		return &alarmError{names: firing}
+	}
+	return nil
+}
@@ -8,12 +8,16 @@ import (
 	"io/fs"
 	"log"
 	"os"
+	pathpkg "path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/fujiwara/lambroll/ignore"
 	"github.com/fujiwara/lambroll/wildcard"
 )
 
@@ -21,7 +25,7 @@ type ArchiveOption struct {
 	Src  string `help:"function zip archive or src dir" default:"."`
 	Dest string `help:"destination file path" default:"function.zip"`
 
-	ZipOption
+	BuildOption
 }
 
 // Archive archives zip
@@ -29,18 +33,26 @@ func (app *App) Archive(ctx context.Context, opt *ArchiveOption) error {
 	if err := opt.Expand(); err != nil {
 		return err
 	}
-
-	zipfile, _, err := createZipArchive(opt.Src, opt.excludes, opt.KeepSymlink)
+	// the function definition is optional for archive
+	fn, err := app.loadFunction(app.functionFilePath)
+	if err != nil {
+		app.logger.Printf("[debug] function definition is not loaded: %s", err)
+		fn = &FunctionDefinition{}
+	}
+	if err := app.prepareSources(ctx, fn, &opt.BuildOption); err != nil {
+		return err
+	}
+	zipfile, _, err := createZipArchive(opt.Src, &opt.ZipOption)
 	if err != nil {
 		return err
 	}
 	defer zipfile.Close()
 	var w io.WriteCloser
 	if opt.Dest == "-" {
-		log.Printf("[info] writing zip archive to stdout")
+		app.logger.Printf("[info] writing zip archive to stdout")
 		w = os.Stdout
 	} else {
-		log.Printf("[info] writing zip archive to %s", opt.Dest)
+		app.logger.Printf("[info] writing zip archive to %s", opt.Dest)
 		w, err = os.Create(opt.Dest)
 		if err != nil {
 			return fmt.Errorf("failed to create %s: %w", opt.Dest, err)
@@ -51,15 +63,15 @@ func (app *App) Archive(ctx context.Context, opt *ArchiveOption) error {
 	return err
 }
 
-func loadZipArchive(src string) (*os.File, os.FileInfo, error) {
-	log.Printf("[info] reading zip archive from %s", src)
+func loadZipArchive(src string, logger *log.Logger) (*os.File, os.FileInfo, error) {
+	logger.Printf("[info] reading zip archive from %s", src)
 	r, err := zip.OpenReader(src)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to open zip file %s: %w", src, err)
 	}
 	for _, f := range r.File {
 		header := f.FileHeader
-		log.Printf("[debug] %s %10d %s %s",
+		logger.Printf("[debug] %s %10d %s %s",
 			header.Mode(),
 			header.UncompressedSize64,
 			header.Modified.Format(time.RFC3339),
@@ -71,61 +83,202 @@ func loadZipArchive(src string) (*os.File, os.FileInfo, error) {
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to stat %s: %w", src, err)
 	}
-	log.Printf("[info] zip archive %d bytes", info.Size())
+	logger.Printf("[info] zip archive %d bytes", info.Size())
 	fh, err := os.Open(src)
 	return fh, info, err
 }
 
-// createZipArchive creates a zip archive
-func createZipArchive(src string, excludes []string, keepSymlink bool) (*os.File, os.FileInfo, error) {
-	log.Printf("[info] creating zip archive from %s", src)
+// createZipArchive creates a zip archive from src, or from the include list if defined
+func createZipArchive(src string, opt *ZipOption) (*os.File, os.FileInfo, error) {
+	logger := opt.getLogger()
+	includes := opt.includes
+	if len(includes) == 0 {
+		includes = []*PackageInclude{{Src: src}}
+	} else if opt.srcGiven {
+		logger.Printf("[warn] --src %s is not used. the zip archive is created from the include list", src)
+	}
+	var modTime *time.Time
+	if opt.Reproducible {
+		t, err := sourceDateEpoch()
+		if err != nil {
+			return nil, nil, err
+		}
+		if opt.modTime != nil {
+			t = *opt.modTime
+		}
+		logger.Printf("[info] creating reproducible zip archive. timestamps of files are set to %s", t.Format(time.RFC3339))
+		modTime = &t
+	}
+	type zipEntry struct {
+		path string
+		name string // name in the zip archive
+		info fs.DirEntry
+	}
+	var entries []zipEntry
+	names := make(map[string]string)
+	matcher := opt.excludeMatcher()
+	for _, in := range includes {
+		src, prefix := in.Src, in.prefix()
+		if prefix == "" {
+			logger.Printf("[info] creating zip archive from %s", src)
+		} else {
+			logger.Printf("[info] creating zip archive from %s to %s/", src, prefix)
+		}
+		err := filepath.WalkDir(src, func(path string, info fs.DirEntry, err error) error {
+			logger.Println("[trace] waking", path)
+			if err != nil {
+				logger.Println("[error] failed to walking dir in", src)
+				return err
+			}
+			relpath, _ := filepath.Rel(src, path)
+			if relpath == "." && !info.IsDir() {
+				// src is a file
+				relpath = filepath.Base(path)
+			}
+			name := pathpkg.Join(prefix, filepath.ToSlash(relpath))
+			if info.IsDir() {
+				if relpath == "." {
+					if len(opt.includes) > 0 {
+						// the ignore file in the root of each source of the include list
+						return matcher.AddFile(filepath.Join(path, IgnoreFilename), prefix)
+					}
+					return nil
+				}
+				if matcher.Match(name, true) {
+					logger.Println("[trace] skipping directory", name)
+					return filepath.SkipDir
+				}
+				// patterns in the nested ignore file are relative to the directory
+				return matcher.AddFile(filepath.Join(path, IgnoreFilename), name)
+			}
+			if matcher.Match(name, false) {
+				logger.Println("[trace] skipping", name)
+				return nil
+			}
+			if name == BootstrapFilename && opt.bootstrap != nil {
+				logger.Printf("[warn] %s is replaced by the binary built by --build-go", path)
+				return nil
+			}
+			if p, ok := names[name]; ok {
+				return fmt.Errorf("%s is duplicated in the zip archive: %s and %s", name, p, path)
+			}
+			names[name] = path
+			entries = append(entries, zipEntry{path: path, name: name, info: info})
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if opt.Reproducible {
+		// order by the name in the archive, not by the order of walking
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].name < entries[j].name
+		})
+	}
+
 	tmpfile, err := os.CreateTemp("", "archive")
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to open tempFile: %w", err)
 	}
 	w := zip.NewWriter(tmpfile)
-	err = filepath.WalkDir(src, func(path string, info fs.DirEntry, err error) error {
-		log.Println("[trace] waking", path)
-		if err != nil {
-			log.Println("[error] failed to walking dir in", src)
-			return err
-		}
-		if info.IsDir() {
-			return nil
+	for _, e := range entries {
+		logger.Println("[trace] adding", e.name)
+		if err := addToZip(w, e.path, e.name, e.info, opt.KeepSymlink, modTime, logger); err != nil {
+			return nil, nil, err
 		}
-		relpath, _ := filepath.Rel(src, path)
-		if matchExcludes(relpath, excludes) {
-			log.Println("[trace] skipping", relpath)
-			return nil
+	}
+	if opt.bootstrap != nil {
+		if err := addBootstrapToZip(w, opt.bootstrap, modTime, logger); err != nil {
+			return nil, nil, err
 		}
-		log.Println("[trace] adding", relpath)
-		return addToZip(w, path, relpath, info, keepSymlink)
-	})
+	}
 	if err := w.Close(); err != nil {
 		return nil, nil, fmt.Errorf("failed to create zip archive: %w", err)
 	}
 	tmpfile.Seek(0, io.SeekStart)
 	stat, _ := tmpfile.Stat()
-	log.Printf("[info] zip archive wrote %d bytes", stat.Size())
-	return tmpfile, stat, err
+	logger.Printf("[info] zip archive wrote %d bytes", stat.Size())
+	return tmpfile, stat, nil
+}
+
+// excludeMatcher decides whether the file or the directory is excluded from the zip archive
+type excludeMatcher interface {
+	Match(name string, isDir bool) bool
+	AddFile(filename, base string) error
+}
+
+func (opt *ZipOption) excludeMatcher() excludeMatcher {
+	if opt.IgnoreSyntax == "gitignore" {
+		return ignore.NewMatcher(opt.excludes)
+	}
+	return wildcardMatcher(opt.excludes)
 }
 
-func matchExcludes(path string, excludes []string) bool {
-	for _, pattern := range excludes {
-		if wildcard.Match(pattern, path) {
+// wildcardMatcher matches each pattern against the whole path. "*" also matches "/".
+// A directory is excluded (not traversed) when a pattern matches the path of it, or when a pattern
+// ending with "*" matches all paths in it (e.g. "node_modules/*").
+// Ignore files in subdirectories are not evaluated.
+type wildcardMatcher []string
+
+func (m wildcardMatcher) Match(name string, isDir bool) bool {
+	for _, pattern := range m {
+		if wildcard.Match(pattern, name) {
+			return true
+		}
+		if isDir && strings.HasSuffix(pattern, "*") && wildcard.Match(pattern, name+"/") {
 			return true
 		}
 	}
 	return false
 }
 
-func followSymlink(path string) (string, fs.FileInfo, error) {
+func (m wildcardMatcher) AddFile(filename, base string) error {
+	return nil
+}
+
+// minZipTime is the minimum time which can be represented in a zip archive (MS-DOS date)
+var minZipTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// sourceDateEpoch returns the time of SOURCE_DATE_EPOCH environment variable.
+// See https://reproducible-builds.org/specs/source-date-epoch/
+func sourceDateEpoch() (time.Time, error) {
+	v := os.Getenv("SOURCE_DATE_EPOCH")
+	if v == "" {
+		return minZipTime, nil
+	}
+	sec, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %s: %w", v, err)
+	}
+	t := time.Unix(sec, 0).UTC()
+	if t.Before(minZipTime) {
+		return minZipTime, nil
+	}
+	return t, nil
+}
+
+// normalizeZipHeader normalizes the timestamp and the permission of the header for reproducible archives
+func normalizeZipHeader(header *zip.FileHeader, modTime time.Time) {
+	header.Modified = modTime
+	mode := header.Mode()
+	switch {
+	case mode&fs.ModeSymlink != 0:
+		header.SetMode(fs.ModeSymlink | 0777)
+	case mode&0111 != 0:
+		header.SetMode(0755)
+	default:
+		header.SetMode(0644)
+	}
+}
+
+func followSymlink(path string, logger *log.Logger) (string, fs.FileInfo, error) {
 	link, err := os.Readlink(path)
 	if err != nil {
 		return "", nil, fmt.Errorf("failed to read symlink %s: %s", path, err)
 	}
 	linkTarget := filepath.Join(filepath.Dir(path), link)
-	log.Printf("[debug] resolve symlink %s to %s", path, linkTarget)
+	logger.Printf("[debug] resolve symlink %s to %s", path, linkTarget)
 	info, err := os.Stat(linkTarget)
 	if err != nil {
 		return "", nil, fmt.Errorf("failed to stat symlink target %s: %s", linkTarget, err)
@@ -136,10 +289,10 @@ func followSymlink(path string) (string, fs.FileInfo, error) {
 	return linkTarget, info, nil
 }
 
-func addToZip(z *zip.Writer, path, relpath string, entry fs.DirEntry, keepSymlink bool) error {
+func addToZip(z *zip.Writer, path, relpath string, entry fs.DirEntry, keepSymlink bool, modTime *time.Time, logger *log.Logger) error {
 	info, err := entry.Info()
 	if err != nil {
-		log.Printf("[error] failed to get info %s: %s", path, err)
+		logger.Printf("[error] failed to get info %s: %s", path, err)
 		return err
 	}
 	var reader io.ReadCloser
@@ -152,9 +305,9 @@ func addToZip(z *zip.Writer, path, relpath string, entry fs.DirEntry, keepSymlin
 			reader = io.NopCloser(strings.NewReader(link))
 		} else {
 			// treat symlink as file. skip symlink target directory.
-			path, info, err = followSymlink(path) // overwrite path, info
+			path, info, err = followSymlink(path, logger) // overwrite path, info
 			if err != nil {
-				log.Printf("[warn] failed to follow symlink. skip: %s", err)
+				logger.Printf("[warn] failed to follow symlink. skip: %s", err)
 				return nil
 			}
 		}
@@ -162,7 +315,7 @@ func addToZip(z *zip.Writer, path, relpath string, entry fs.DirEntry, keepSymlin
 	if reader == nil {
 		reader, err = os.Open(path)
 		if err != nil {
-			log.Printf("[error] failed to open %s: %s", path, err)
+			logger.Printf("[error] failed to open %s: %s", path, err)
 			return err
 		}
 	}
@@ -170,18 +323,21 @@ func addToZip(z *zip.Writer, path, relpath string, entry fs.DirEntry, keepSymlin
 
 	header, err := zip.FileInfoHeader(info)
 	if err != nil {
-		log.Println("[error] failed to create zip file header", err)
+		logger.Println("[error] failed to create zip file header", err)
 		return err
 	}
-	header.Name = relpath // fix name as subdir
+	header.Name = filepath.ToSlash(relpath) // fix name as subdir
 	header.Method = zip.Deflate
+	if modTime != nil {
+		normalizeZipHeader(header, *modTime)
+	}
 	w, err := z.CreateHeader(header)
 	if err != nil {
-		log.Println("[error] failed to create in zip", err)
+		logger.Println("[error] failed to create in zip", err)
 		return err
 	}
 	_, err = io.Copy(w, reader)
-	log.Printf("[debug] %s %10d %s %s",
+	logger.Printf("[debug] %s %10d %s %s",
 		header.Mode(),
 		header.UncompressedSize64,
 		header.Modified.Format(time.RFC3339),
@@ -190,9 +346,31 @@ func addToZip(z *zip.Writer, path, relpath string, entry fs.DirEntry, keepSymlin
 	return err
 }
 
+// addBootstrapToZip adds the bootstrap binary to the zip archive
+func addBootstrapToZip(z *zip.Writer, b []byte, modTime *time.Time, logger *log.Logger) error {
+	header := &zip.FileHeader{
+		Name:     BootstrapFilename,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	}
+	header.SetMode(0755)
+	if modTime != nil {
+		normalizeZipHeader(header, *modTime)
+	}
+	w, err := z.CreateHeader(header)
+	if err != nil {
+		return fmt.Errorf("failed to create %s in zip: %w", BootstrapFilename, err)
+	}
+	if _, err := w.Write(b); err != nil {
+		return fmt.Errorf("failed to write %s to zip: %w", BootstrapFilename, err)
+	}
+	logger.Printf("[debug] %s %10d %s %s", header.Mode(), len(b), header.Modified.Format(time.RFC3339), header.Name)
+	return nil
+}
+
 func (app *App) uploadFunctionToS3(ctx context.Context, f *os.File, bucket, key string) (string, error) {
 	svc := s3.NewFromConfig(app.awsConfig)
-	log.Printf("[debug] PutObject to s3://%s/%s", bucket, key)
+	app.logger.Printf("[debug] PutObject to s3://%s/%s", bucket, key)
 	res, err := svc.PutObject(ctx, &s3.PutObjectInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
@@ -2,13 +2,19 @@ package lambroll_test
 
 import (
 	"archive/zip"
+	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"log"
 	"os"
+	"path/filepath"
 	"slices"
 	"testing"
 	"time"
 
 	"github.com/fujiwara/lambroll"
+	"github.com/fujiwara/lambroll/lambrolltest"
 	"github.com/google/go-cmp/cmp"
 )
 
@@ -97,7 +103,7 @@ func testCreateZipArchive(t *testing.T, s zipTestSuite) {
 }
 
 func TestLoadZipArchive(t *testing.T) {
-	r, info, err := lambroll.LoadZipArchive("test/src.zip")
+	r, info, err := lambroll.LoadZipArchive("test/src.zip", log.Default())
 	if err != nil {
 		t.Error("failed to LoadZipArchive", err)
 	}
@@ -109,9 +115,242 @@ func TestLoadZipArchive(t *testing.T) {
 }
 
 func TestLoadNotZipArchive(t *testing.T) {
-	_, _, err := lambroll.LoadZipArchive("test/src/hello.txt")
+	_, _, err := lambroll.LoadZipArchive("test/src/hello.txt", log.Default())
 	if err == nil {
 		t.Error("must be failed to load not a zip file")
 	}
 	t.Log(err)
 }
+
+func TestCreateReproducibleZipArchive(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	dir := t.TempDir()
+	for _, name := range []string{"b.txt", "a/c.txt", "a.txt"} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	create := func() []byte {
+		t.Helper()
+		f, _, err := lambroll.CreateZipArchiveWithOption(dir, &lambroll.ZipOption{Reproducible: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(f.Name())
+		defer f.Close()
+		b, err := io.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	first := create()
+
+	// change timestamps and permissions
+	mtime := time.Now().Add(time.Hour)
+	for _, name := range []string{"b.txt", "a/c.txt", "a.txt"} {
+		path := filepath.Join(dir, name)
+		os.Chtimes(path, mtime, mtime)
+		os.Chmod(path, 0664)
+	}
+	second := create()
+	if !bytes.Equal(first, second) {
+		t.Error("zip archives created from the same sources are not identical")
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(first), int64(len(first)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		if !f.Modified.Equal(time.Unix(1700000000, 0)) {
+			t.Errorf("unexpected modified time of %s: %s", f.Name, f.Modified)
+		}
+		if m := f.Mode(); m != 0644 {
+			t.Errorf("unexpected mode of %s: %s", f.Name, m)
+		}
+	}
+	if diff := cmp.Diff(names, []string{"a.txt", "a/c.txt", "b.txt"}); diff != "" {
+		t.Errorf("unexpected order of files %s", diff)
+	}
+}
+
+func TestCreateZipArchiveWithIgnore(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"index.js":                      "",
+		"debug.log":                     "",
+		"keep.log":                      "",
+		"build/out.js":                  "",
+		"node_modules/a/index.js":       "",
+		"node_modules/a/README.md":      "",
+		"node_modules/b/test/a_test.js": "",
+		"lib/.lambdaignore":             "*.md\n!KEEP.md\n",
+		"lib/a.md":                      "",
+		"lib/KEEP.md":                   "",
+		"README.md":                     "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	excludes := []string{
+		".lambdaignore",
+		"*.log",
+		"!keep.log",
+		"/build/",
+		"node_modules/**/test/",
+		"node_modules/*/README.md",
+	}
+	r, _, err := lambroll.CreateZipArchiveWithGitignore(dir, excludes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer os.Remove(r.Name())
+	zr, err := zip.OpenReader(r.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	slices.Sort(names)
+	expected := []string{"README.md", "index.js", "keep.log", "lib/KEEP.md", "node_modules/a/index.js"}
+	if diff := cmp.Diff(names, expected); diff != "" {
+		t.Errorf("unexpected included files %s", diff)
+	}
+}
+
+func TestCreateZipArchiveWithWildcard(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"index.js", "src/a.js", "src/lib/b.js", "lib/.lambdaignore", "lib/c.md", "node_modules/d/e.js", "vendor/f.go"} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte("*.md\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// "*" matches "/" and nested ignore files are not evaluated by default
+	r, _, err := lambroll.CreateZipArchive(dir, []string{"src/*.js", "node_modules", "vendor/*"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer os.Remove(r.Name())
+	zr, err := zip.OpenReader(r.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	slices.Sort(names)
+	expected := []string{"index.js", "lib/.lambdaignore", "lib/c.md"}
+	if diff := cmp.Diff(names, expected); diff != "" {
+		t.Errorf("unexpected included files %s", diff)
+	}
+}
+
+func TestCreateZipArchiveWithIncludes(t *testing.T) {
+	root := t.TempDir()
+	files := []string{
+		"shared/lib/util.js",
+		"shared/lib/util_test.js",
+		"fn/dist/index.js",
+		"fn/dist/index.js.map",
+		"fn/.lambdainclude",
+		"fn/config.json",
+	}
+	for _, name := range files {
+		path := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	includeFile := filepath.Join(root, "fn/.lambdainclude")
+	if err := os.WriteFile(includeFile, []byte("# comment\n../shared/lib lib/\ndist /\nconfig.json\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	includes, err := lambroll.LoadIncludeFile(includeFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(includes) != 3 {
+		t.Fatalf("unexpected includes %#v", includes)
+	}
+	if s := includes[0].Src; s != filepath.Join(root, "shared/lib") {
+		t.Errorf("unexpected src %s", s)
+	}
+
+	r, _, err := lambroll.CreateZipArchiveWithIncludes(includes, []string{"*_test.js", "*.map"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer os.Remove(r.Name())
+	zr, err := zip.OpenReader(r.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	slices.Sort(names)
+	expected := []string{"config.json", "index.js", "lib/util.js"}
+	if diff := cmp.Diff(names, expected); diff != "" {
+		t.Errorf("unexpected included files %s", diff)
+	}
+
+	// duplicated files
+	includes = append(includes, &lambroll.PackageInclude{Src: filepath.Join(root, "fn/dist")})
+	if _, _, err := lambroll.CreateZipArchiveWithIncludes(includes, nil); err == nil {
+		t.Error("duplicated files in the zip archive should be an error")
+	}
+}
+
+func TestArchiveWithPackage(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"shared/lib/util.js": "util",
+		"fn/dist/index.js":   "index",
+		"fn/function.json":   `{"FunctionName": "hello", "Package": {"Include": [{"Src": "../shared/lib", "Dest": "lib"}, {"Src": "dist"}]}}`,
+	} {
+		path := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	app, err := lambrolltest.NewApp(ctx, &lambroll.Option{
+		Function: filepath.Join(root, "fn/function.json"),
+	}, lambrolltest.NewFakeLambda())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := filepath.Join(t.TempDir(), "function.zip")
+	if err := app.Archive(ctx, &lambroll.ArchiveOption{Src: ".", Dest: dest}); err != nil {
+		t.Fatal(err)
+	}
+	names := zipFileNames(t, dest)
+	slices.Sort(names)
+	expected := []string{"index.js", "lib/util.js"}
+	if diff := cmp.Diff(names, expected); diff != "" {
+		t.Errorf("unexpected included files %s", diff)
+	}
+}
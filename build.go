@@ -0,0 +1,127 @@
+package lambroll
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// Build defines a command to build the function code before creating a zip archive
+type Build struct {
+	// Command is a command line run by the shell (sh -c, or cmd /C on Windows)
+	Command string `json:"Command"`
+	// Dir is the working directory of the command. A relative path is resolved from the directory of the function definition.
+	Dir string `json:"Dir,omitempty"`
+	// Env is environment variables added to the command
+	Env map[string]string `json:"Env,omitempty"`
+}
+
+// runBuild runs the build command in the function definition
+func (app *App) runBuild(ctx context.Context, b *Build, opt *BuildOption) error {
+	if b == nil || b.Command == "" || opt.built {
+		return nil
+	}
+	if opt.SkipBuild {
+		app.logger.Println("[info] skipping build")
+		return nil
+	}
+	dir := joinPath(app.functionDir(), b.Dir)
+	app.logger.Printf("[info] building in %s: %s", dir, b.Command)
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", b.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", b.Command)
+	}
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	keys := make([]string, 0, len(b.Env))
+	for k := range b.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		cmd.Env = append(cmd.Env, k+"="+b.Env[k])
+	}
+	// stdout of lambroll may be used for a zip archive or diff. so the output of the build goes to stderr
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to build: %w", err)
+	}
+	app.logger.Println("[info] build completed")
+	opt.built = true
+	return nil
+}
+
+// prepareSources builds the function code and resolves the sources of the zip archive
+func (app *App) prepareSources(ctx context.Context, fn *FunctionDefinition, opt *BuildOption) error {
+	opt.logger = app.logger
+	if err := app.runBuild(ctx, fn.Build, opt); err != nil {
+		return err
+	}
+	if err := app.buildGo(ctx, fn, opt); err != nil {
+		return err
+	}
+	opt.applyPackage(fn.Package, app.functionDir())
+	return nil
+}
+
+// BootstrapFilename is the name of the executable for provided runtimes
+const BootstrapFilename = "bootstrap"
+
+// goarch returns GOARCH for the architecture of the function
+func goarch(fn *Function) (string, error) {
+	if len(fn.Architectures) == 0 {
+		return "amd64", nil
+	}
+	switch a := fn.Architectures[0]; a {
+	case types.ArchitectureX8664:
+		return "amd64", nil
+	case types.ArchitectureArm64:
+		return "arm64", nil
+	default:
+		return "", fmt.Errorf("unsupported architecture %s", a)
+	}
+}
+
+// buildGo builds the Go package specified by --build-go as bootstrap
+func (app *App) buildGo(ctx context.Context, fn *FunctionDefinition, opt *BuildOption) error {
+	if opt.BuildGo == "" || opt.bootstrap != nil {
+		return nil
+	}
+	arch, err := goarch(&fn.Function)
+	if err != nil {
+		return err
+	}
+	tmpdir, err := os.MkdirTemp("", "lambroll-build-go")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpdir)
+	out := filepath.Join(tmpdir, BootstrapFilename)
+
+	dir := app.functionDir()
+	app.logger.Printf("[info] building %s in %s for linux/%s", opt.BuildGo, dir, arch)
+	cmd := exec.CommandContext(ctx, "go", "build", "-tags", "lambda.norpc", "-trimpath", "-o", out, opt.BuildGo)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH="+arch, "CGO_ENABLED=0")
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to build %s: %w", opt.BuildGo, err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", out, err)
+	}
+	app.logger.Printf("[info] built %s %d bytes", BootstrapFilename, len(b))
+	opt.bootstrap = b
+	return nil
+}
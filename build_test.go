@@ -0,0 +1,196 @@
+package lambroll_test
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/fujiwara/lambroll"
+	"github.com/fujiwara/lambroll/lambrolltest"
+)
+
+func TestRunBuild(t *testing.T) {
+	ctx := context.Background()
+	app, _ := newFakeApp(t)
+	dir := t.TempDir()
+	b := &lambroll.Build{
+		Command: `printf "%s" "$MESSAGE" > out.txt`,
+		Dir:     dir,
+		Env:     map[string]string{"MESSAGE": "hello"},
+	}
+	out := filepath.Join(dir, "out.txt")
+
+	if err := app.RunBuild(ctx, b, &lambroll.BuildOption{SkipBuild: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(out); err == nil {
+		t.Error("build should be skipped")
+	}
+
+	if err := app.RunBuild(ctx, b, &lambroll.BuildOption{}); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := os.ReadFile(out); err != nil {
+		t.Fatal(err)
+	} else if string(content) != "hello" {
+		t.Errorf("unexpected output %q", string(content))
+	}
+
+	b.Command = "exit 1"
+	if err := app.RunBuild(ctx, b, &lambroll.BuildOption{}); err == nil {
+		t.Error("failed build should be an error")
+	}
+}
+
+func TestGoArch(t *testing.T) {
+	cases := []struct {
+		archs    []types.Architecture
+		expected string
+		isErr    bool
+	}{
+		{nil, "amd64", false},
+		{[]types.Architecture{types.ArchitectureX8664}, "amd64", false},
+		{[]types.Architecture{types.ArchitectureArm64}, "arm64", false},
+		{[]types.Architecture{"mips"}, "", true},
+	}
+	for _, c := range cases {
+		fn := &lambroll.Function{}
+		fn.Architectures = c.archs
+		arch, err := lambroll.GoArch(fn)
+		if c.isErr {
+			if err == nil {
+				t.Errorf("%v should be an error", c.archs)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if arch != c.expected {
+			t.Errorf("unexpected GOARCH %s for %v", arch, c.archs)
+		}
+	}
+}
+
+func TestCreateZipArchiveWithBootstrap(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"bootstrap":   "old",
+		"config.json": "{}",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, _, err := lambroll.CreateZipArchiveWithBootstrap(dir, []byte("new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer os.Remove(r.Name())
+	zr, err := zip.OpenReader(r.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	if len(zr.File) != 2 {
+		t.Fatalf("unexpected files in the zip archive %d", len(zr.File))
+	}
+	for _, f := range zr.File {
+		if f.Name != lambroll.BootstrapFilename {
+			continue
+		}
+		if f.Mode().Perm() != 0755 {
+			t.Errorf("unexpected mode of bootstrap %s", f.Mode())
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		if string(b) != "new" {
+			t.Errorf("bootstrap is not replaced %q", string(b))
+		}
+	}
+}
+
+func zipFileNames(t *testing.T, path string) []string {
+	t.Helper()
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+func TestArchiveWithBuild(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	def := `{"FunctionName": "hello", "Build": {"Command": "printf built > out.txt"}}`
+	if err := os.WriteFile(filepath.Join(dir, "function.json"), []byte(def), 0644); err != nil {
+		t.Fatal(err)
+	}
+	app, err := lambrolltest.NewApp(ctx, &lambroll.Option{
+		Function: filepath.Join(dir, "function.json"),
+	}, lambrolltest.NewFakeLambda())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := filepath.Join(t.TempDir(), "function.zip")
+
+	skip := &lambroll.ArchiveOption{Src: dir, Dest: dest}
+	skip.SkipBuild = true
+	if err := app.Archive(ctx, skip); err != nil {
+		t.Fatal(err)
+	}
+	if names := zipFileNames(t, dest); slices.Contains(names, "out.txt") {
+		t.Errorf("build should be skipped %v", names)
+	}
+
+	if err := app.Archive(ctx, &lambroll.ArchiveOption{Src: dir, Dest: dest}); err != nil {
+		t.Fatal(err)
+	}
+	if names := zipFileNames(t, dest); !slices.Contains(names, "out.txt") {
+		t.Errorf("the built file is not archived %v", names)
+	}
+}
+
+func TestArchiveWithBuildGo(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"function.json": `{"FunctionName": "hello", "Runtime": "provided.al2023", "Architectures": ["arm64"]}`,
+		"go.mod":        "module hello\n\ngo 1.22\n",
+		"main.go":       "package main\n\nfunc main() {}\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	app, err := lambrolltest.NewApp(ctx, &lambroll.Option{
+		Function: filepath.Join(dir, "function.json"),
+	}, lambrolltest.NewFakeLambda())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := filepath.Join(t.TempDir(), "function.zip")
+	opt := &lambroll.ArchiveOption{Src: dir, Dest: dest}
+	opt.BuildGo = "."
+	if err := app.Archive(ctx, opt); err != nil {
+		t.Fatal(err)
+	}
+	if names := zipFileNames(t, dest); !slices.Contains(names, lambroll.BootstrapFilename) {
+		t.Errorf("bootstrap is not archived %v", names)
+	}
+}
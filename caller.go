@@ -2,6 +2,7 @@ package lambroll
 
 import (
 	"context"
+	"sync"
 	"text/template"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -12,6 +13,7 @@ import (
 
 type CallerIdentity struct {
 	data     map[string]any
+	mu       sync.Mutex
 	Resolver func(ctx context.Context) (*sts.GetCallerIdentityOutput, error)
 }
 
@@ -24,6 +26,8 @@ func newCallerIdentity(cfg aws.Config) *CallerIdentity {
 }
 
 func (c *CallerIdentity) resolve(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if c.data != nil {
 		return nil
 	}
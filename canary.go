@@ -0,0 +1,150 @@
+package lambroll
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// canarySteps returns the traffic weights (percent) for the new version in order.
+// The last step is always 100.
+func canarySteps(initial int, steps []int) ([]int, error) {
+	ws := make([]int, 0, len(steps)+2)
+	ws = append(ws, initial)
+	ws = append(ws, steps...)
+	prev := 0
+	res := make([]int, 0, len(ws))
+	for _, w := range ws {
+		if w <= 0 || w > 100 {
+			return nil, fmt.Errorf("canary weight must be in 1..100: %d", w)
+		}
+		if w == prev {
+			continue
+		}
+		if w < prev {
+			return nil, fmt.Errorf("canary weights must be in ascending order: %v", ws)
+		}
+		res = append(res, w)
+		prev = w
+	}
+	if prev != 100 {
+		res = append(res, 100)
+	}
+	return res, nil
+}
+
+// deployCanary shifts traffic of the alias to newVersion step by step
+// using the weighted routing of the alias.
+// When any of alarms goes to ALARM state, the alias is rolled back to the stable version.
+// revisionId is RevisionId of the alias at the start of deploy. nil means the alias did not exist.
+func (app *App) deployCanary(ctx context.Context, name, newVersion string, revisionId *string, alarms []string, opt *DeployOption) error {
+	steps, err := canarySteps(opt.CanaryWeight, opt.CanarySteps)
+	if err != nil {
+		return err
+	}
+	res, err := app.lambda.GetAlias(ctx, &lambda.GetAliasInput{
+		FunctionName: aws.String(name),
+		Name:         aws.String(opt.AliasName),
+	})
+	if err != nil {
+		var nfe *types.ResourceNotFoundException
+		if errors.As(err, &nfe) {
+			app.logger.Printf("[info] alias %s is not found. skipping canary deployment", opt.AliasName)
+			return app.updateAliases(ctx, name, versionAlias{Version: newVersion, Name: opt.AliasName})
+		}
+		return fmt.Errorf("failed to get alias: %w", err)
+	}
+	if revisionId == nil {
+		revisionId = res.RevisionId
+	}
+	if rc := res.RoutingConfig; rc != nil && len(rc.AdditionalVersionWeights) > 0 {
+		return fmt.Errorf("alias %s already has weighted routing %v. complete or rollback it before a canary deployment", opt.AliasName, rc.AdditionalVersionWeights)
+	}
+	stableVersion := aws.ToString(res.FunctionVersion)
+	if stableVersion == newVersion {
+		app.logger.Printf("[info] alias %s already points to version %s", opt.AliasName, newVersion)
+		return nil
+	}
+
+	if err := app.checkAlarms(ctx, alarms); err != nil {
+		return fmt.Errorf("unable to start canary deployment: %w", err)
+	}
+
+	app.logger.Printf("[info] starting canary deployment of version %s on alias %s: steps %v%% every %s", newVersion, opt.AliasName, steps, opt.CanaryInterval)
+	if len(alarms) > 0 {
+		app.logger.Printf("[info] watching alarms %s", strings.Join(alarms, ","))
+	}
+	for i, weight := range steps {
+		if i > 0 {
+			err := app.waitCanaryInterval(ctx, alarms, opt)
+			var ae *alarmError
+			if errors.As(err, &ae) {
+				app.logger.Printf("[warn] %s. rolling back alias %s to version %s", ae, opt.AliasName, stableVersion)
+				if rerr := app.rollbackAlias(ctx, name, newVersion, stableVersion, &RollbackOption{Alias: opt.AliasName}); rerr != nil {
+					return fmt.Errorf("failed to rollback (%s): %w", err, rerr)
+				}
+				return fmt.Errorf("canary deployment was rolled back: %w", err)
+			} else if err != nil {
+				return err
+			}
+		}
+		if weight == 100 {
+			return app.updateAliases(ctx, name, versionAlias{Version: newVersion, Name: opt.AliasName, RevisionId: revisionId, ResetRouting: true})
+		}
+		if revisionId, err = app.updateAliasWeight(ctx, name, opt.AliasName, stableVersion, newVersion, weight, revisionId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateAliasWeight updates the weighted routing of the alias and returns the new RevisionId of the alias
+func (app *App) updateAliasWeight(ctx context.Context, name, alias, stableVersion, newVersion string, weight int, revisionId *string) (*string, error) {
+	app.logger.Printf("[info] updating alias %s to route %d%% of traffic to version %s (stable version %s)", alias, weight, newVersion, stableVersion)
+	res, err := app.lambda.UpdateAlias(ctx, &lambda.UpdateAliasInput{
+		FunctionName:    aws.String(name),
+		FunctionVersion: aws.String(stableVersion),
+		Name:            aws.String(alias),
+		RevisionId:      revisionId,
+		RoutingConfig: &types.AliasRoutingConfiguration{
+			AdditionalVersionWeights: map[string]float64{
+				newVersion: float64(weight) / 100,
+			},
+		},
+	})
+	if err != nil {
+		if cerr := asConflictError(name+":"+alias, err, false); cerr != nil {
+			return nil, cerr
+		}
+		return nil, fmt.Errorf("failed to update alias routing config: %w", err)
+	}
+	app.logger.Println("[info] alias updated")
+	return res.RevisionId, nil
+}
+
+// waitCanaryInterval waits for the canary interval while checking alarms
+func (app *App) waitCanaryInterval(ctx context.Context, alarms []string, opt *DeployOption) error {
+	app.logger.Printf("[info] waiting %s for the next canary step", opt.CanaryInterval)
+	timer := time.NewTimer(opt.CanaryInterval)
+	defer timer.Stop()
+	ticker := time.NewTicker(alarmCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return app.checkAlarms(ctx, alarms)
+		case <-ticker.C:
+			if err := app.checkAlarms(ctx, alarms); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package lambroll_test
+
+import (
+	"testing"
+
+	"github.com/fujiwara/lambroll"
+	"github.com/google/go-cmp/cmp"
+)
+
+var canaryStepsTestCases = []struct {
+	name    string
+	initial int
+	steps   []int
+	expect  []int
+	isError bool
+}{
+	{name: "initial only", initial: 10, expect: []int{10, 100}},
+	{name: "with steps", initial: 10, steps: []int{10, 50, 100}, expect: []int{10, 50, 100}},
+	{name: "without last", initial: 5, steps: []int{25, 50}, expect: []int{5, 25, 50, 100}},
+	{name: "all at once", initial: 100, expect: []int{100}},
+	{name: "descending", initial: 50, steps: []int{10}, isError: true},
+	{name: "out of range", initial: 10, steps: []int{120}, isError: true},
+}
+
+func TestCanarySteps(t *testing.T) {
+	for _, c := range canaryStepsTestCases {
+		t.Run(c.name, func(t *testing.T) {
+			steps, err := lambroll.CanarySteps(c.initial, c.steps)
+			if c.isError {
+				if err == nil {
+					t.Errorf("expected error but got %v", steps)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(c.expect, steps); diff != "" {
+				t.Errorf("unexpected steps %s", diff)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package lambroll
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -42,6 +43,9 @@ type CLIOptions struct {
 	Status   *StatusOption   `cmd:"status" help:"show status of function"`
 	Delete   *DeleteOption   `cmd:"delete" help:"delete function"`
 	Versions *VersionsOption `cmd:"versions" help:"show versions of function"`
+	Layer    *LayerOption    `cmd:"layer" help:"publish, show versions, diff or delete layer"`
+	Validate *ValidateOption `cmd:"validate" help:"validate function.json and function-url definition offline"`
+	Schema   *SchemaOption   `cmd:"schema" help:"print JSON Schema of function.json or function-url definition"`
 
 	Version struct{} `cmd:"version" help:"show version"`
 }
@@ -64,9 +68,30 @@ func ParseCLI(args []string) (string, *CLIOptions, func(), error) {
 		return "", nil, nil, fmt.Errorf("failed to parse args: %w", err)
 	}
 	sub := strings.Fields(c.Command())[0]
+	if flagGiven(c, "src") {
+		// the include list replaces --src. warn about it only when --src is given explicitly
+		switch sub {
+		case "deploy":
+			opts.Deploy.srcGiven = true
+		case "diff":
+			opts.Diff.srcGiven = true
+		case "archive":
+			opts.Archive.srcGiven = true
+		}
+	}
 	return sub, &opts, func() { c.PrintUsage(true) }, nil
 }
 
+// flagGiven reports whether the flag is given in the command line, not by the default value
+func flagGiven(c *kong.Context, name string) bool {
+	for _, p := range c.Path {
+		if p.Flag != nil && p.Flag.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 func CLI(ctx context.Context, parse CLIParseFunc) (int, error) {
 	sub, opts, usage, err := parse(os.Args[1:])
 	if err != nil {
@@ -89,6 +114,11 @@ func CLI(ctx context.Context, parse CLIParseFunc) (int, error) {
 	log.SetOutput(filter)
 
 	if err := dispatchCLI(ctx, sub, usage, opts); err != nil {
+		var ece *ExitCodeError
+		if errors.As(err, &ece) {
+			log.Printf("[info] %s", ece.Message)
+			return ece.Code, nil
+		}
 		return 1, err
 	}
 	return 0, nil
@@ -101,6 +131,10 @@ func dispatchCLI(ctx context.Context, sub string, usage func(), opts *CLIOptions
 		return nil
 	}
 
+	if sub == "deploy" && opts.Deploy.All || sub == "diff" && opts.Diff.All {
+		return dispatchProject(ctx, sub, opts)
+	}
+
 	app, err := New(ctx, &opts.Option)
 	if err != nil {
 		return err
@@ -135,8 +169,41 @@ func dispatchCLI(ctx context.Context, sub string, usage func(), opts *CLIOptions
 		return app.Delete(ctx, opts.Delete)
 	case "status":
 		return app.Status(ctx, opts.Status)
+	case "layer":
+		return app.Layer(ctx, opts.Layer)
+	case "validate":
+		return app.Validate(ctx, opts.Validate)
+	case "schema":
+		return app.Schema(ctx, opts.Schema)
 	default:
 		usage()
 	}
 	return nil
 }
+
+func dispatchProject(ctx context.Context, sub string, opts *CLIOptions) error {
+	var path string
+	switch sub {
+	case "deploy":
+		path = opts.Deploy.Manifest
+	case "diff":
+		path = opts.Diff.Manifest
+	}
+	m, err := LoadManifest(path)
+	if err != nil {
+		return err
+	}
+	m.MergeOption(&opts.Option)
+	app, err := New(ctx, &opts.Option)
+	if err != nil {
+		return err
+	}
+	log.Printf("[info] lambroll %s with %s", Version, path)
+	switch sub {
+	case "deploy":
+		return app.DeployAll(ctx, m, opts.Deploy)
+	case "diff":
+		return app.DiffAll(ctx, m, opts.Diff)
+	}
+	return nil
+}
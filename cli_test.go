@@ -0,0 +1,45 @@
+package lambroll_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fujiwara/lambroll"
+)
+
+var testCasesArchiveFlags = [][]string{
+	{"archive", "--skip-build"},
+	{"archive", "--build-go=./cmd/handler"},
+	{"archive", "--include-file=.lambdainclude"},
+}
+
+func TestParseCLIArchiveFlags(t *testing.T) {
+	for _, args := range testCasesArchiveFlags {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			sub, opts, _, err := lambroll.ParseCLI(args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sub != "archive" || opts.Archive == nil {
+				t.Errorf("unexpected subcommand %s", sub)
+			}
+		})
+	}
+}
+
+func TestParseCLISrcGiven(t *testing.T) {
+	_, opts, _, err := lambroll.ParseCLI([]string{"archive"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Archive.Src != "." || opts.Archive.SrcGiven() {
+		t.Errorf("--src should not be given %q", opts.Archive.Src)
+	}
+	_, opts, _, err = lambroll.ParseCLI([]string{"deploy", "--src=."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opts.Deploy.SrcGiven() {
+		t.Error("--src should be given")
+	}
+}
@@ -0,0 +1,297 @@
+package lambroll
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aereal/jsondiff"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/shogo82148/go-retry"
+)
+
+// Concurrency represents the concurrency settings of the function managed by lambroll
+type Concurrency struct {
+	// Reserved is the reserved concurrency of the function. When nil, it is not managed.
+	Reserved *int32 `json:"Reserved,omitempty"`
+	// Provisioned is the provisioned concurrency of each alias. 0 removes the provisioned concurrency of the alias.
+	Provisioned map[string]int32 `json:"Provisioned,omitempty"`
+
+	// versions is the version which each alias points to. It is empty when the alias does not exist.
+	versions map[string]string
+	// qualifiers is the qualifier which has the provisioned concurrency config of each alias.
+	qualifiers map[string]string
+}
+
+// provisionedConcurrencyPolicy is a retry policy to wait for provisioned concurrency to be allocated. It may take several minutes.
+var provisionedConcurrencyPolicy = retry.Policy{
+	MinDelay: time.Second,
+	MaxDelay: 15 * time.Second,
+	MaxCount: 120,
+}
+
+func (c *Concurrency) aliases() []string {
+	aliases := make([]string, 0, len(c.Provisioned))
+	for alias := range c.Provisioned {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	return aliases
+}
+
+// getConcurrency returns the current concurrency settings of the function for the keys of c.
+// Provisioned concurrency of an alias is read from the version which the alias points to,
+// or from the alias itself when it was configured on the alias.
+func (app *App) getConcurrency(ctx context.Context, name string, c *Concurrency) (*Concurrency, error) {
+	current := &Concurrency{}
+	if c.Reserved != nil {
+		res, err := app.lambda.GetFunctionConcurrency(ctx, &lambda.GetFunctionConcurrencyInput{
+			FunctionName: aws.String(name),
+		})
+		if err != nil {
+			var nfe *types.ResourceNotFoundException
+			if !errors.As(err, &nfe) {
+				return nil, fmt.Errorf("failed to get function concurrency: %w", err)
+			}
+		} else {
+			current.Reserved = res.ReservedConcurrentExecutions
+		}
+	}
+	for _, alias := range c.aliases() {
+		if current.Provisioned == nil {
+			current.Provisioned = make(map[string]int32)
+			current.versions = make(map[string]string)
+			current.qualifiers = make(map[string]string)
+		}
+		current.Provisioned[alias] = 0
+		a, err := app.currentAlias(ctx, name, alias)
+		if err != nil {
+			return nil, err
+		} else if a == nil {
+			continue
+		}
+		current.versions[alias] = aws.ToString(a.FunctionVersion)
+		for _, q := range []string{alias, current.versions[alias]} {
+			n, err := app.getProvisionedConcurrency(ctx, name, q)
+			if err != nil {
+				return nil, err
+			} else if n > 0 {
+				current.Provisioned[alias] = n
+				current.qualifiers[alias] = q
+				break
+			}
+		}
+	}
+	return current, nil
+}
+
+// getProvisionedConcurrency returns the requested provisioned concurrency of the qualifier. It returns 0 when not configured.
+func (app *App) getProvisionedConcurrency(ctx context.Context, name, qualifier string) (int32, error) {
+	res, err := app.lambda.GetProvisionedConcurrencyConfig(ctx, &lambda.GetProvisionedConcurrencyConfigInput{
+		FunctionName: aws.String(name),
+		Qualifier:    aws.String(qualifier),
+	})
+	if err != nil {
+		var nfe *types.ResourceNotFoundException
+		var pnfe *types.ProvisionedConcurrencyConfigNotFoundException
+		if errors.As(err, &nfe) || errors.As(err, &pnfe) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get provisioned concurrency config of %s: %w", qualifier, err)
+	}
+	return aws.ToInt32(res.RequestedProvisionedConcurrentExecutions), nil
+}
+
+// deployConcurrency reconciles the reserved concurrency and the provisioned concurrency of the function,
+// and waits for provisioned concurrency to be READY.
+// Provisioned concurrency of an alias is configured on the version which the alias points to.
+// Provisioned concurrency of aliases which do not exist yet is skipped.
+func (app *App) deployConcurrency(ctx context.Context, fn *FunctionDefinition, opt *DeployOption) error {
+	c := fn.Concurrency
+	if c == nil {
+		return nil
+	}
+	name := *fn.FunctionName
+	current, err := app.getConcurrency(ctx, name, c)
+	if err != nil {
+		return err
+	}
+
+	if c.Reserved != nil && (current.Reserved == nil || *current.Reserved != *c.Reserved) {
+		app.logger.Printf("[info] updating reserved concurrency to %d %s", *c.Reserved, opt.label())
+		if !opt.DryRun {
+			if _, err := app.lambda.PutFunctionConcurrency(ctx, &lambda.PutFunctionConcurrencyInput{
+				FunctionName:                 aws.String(name),
+				ReservedConcurrentExecutions: c.Reserved,
+			}); err != nil {
+				return fmt.Errorf("failed to put function concurrency: %w", err)
+			}
+		}
+	}
+
+	var waits []string
+	for _, alias := range c.aliases() {
+		n, cur, q := c.Provisioned[alias], current.Provisioned[alias], current.qualifiers[alias]
+		if n == cur {
+			if n > 0 {
+				waits = append(waits, q)
+			}
+			continue
+		}
+		if n == 0 {
+			app.logger.Printf("[info] deleting provisioned concurrency of alias %s %s", alias, opt.label())
+			if opt.DryRun {
+				continue
+			}
+			if err := app.deleteProvisionedConcurrency(ctx, name, q); err != nil {
+				return err
+			}
+			continue
+		}
+		if q == "" {
+			q = current.versions[alias]
+		}
+		if q == "" {
+			app.logger.Printf("[info] alias %s is not found. skip updating provisioned concurrency", alias)
+			continue
+		}
+		app.logger.Printf("[info] updating provisioned concurrency of alias %s to %d %s", alias, n, opt.label())
+		if opt.DryRun {
+			continue
+		}
+		if err := app.putProvisionedConcurrency(ctx, name, q, n); err != nil {
+			return err
+		}
+		waits = append(waits, q)
+	}
+	if opt.DryRun {
+		return nil
+	}
+	for _, q := range waits {
+		if err := app.waitProvisionedConcurrencyReady(ctx, name, q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prewarmConcurrency allocates the provisioned concurrency of the alias to newVersion
+// and waits for it to be READY before the alias is updated to newVersion.
+// It returns the qualifier which has the provisioned concurrency config of the current version of the alias,
+// to be deleted after the alias is updated. prewarmed is false when nothing is allocated.
+func (app *App) prewarmConcurrency(ctx context.Context, fn *FunctionDefinition, newVersion string, opt *DeployOption) (old string, prewarmed bool, err error) {
+	c := fn.Concurrency
+	if c == nil || newVersion == versionLatest {
+		return "", false, nil
+	}
+	n := c.Provisioned[opt.AliasName]
+	if n <= 0 {
+		return "", false, nil
+	}
+	name := *fn.FunctionName
+	current, err := app.getConcurrency(ctx, name, &Concurrency{Provisioned: map[string]int32{opt.AliasName: n}})
+	if err != nil {
+		return "", false, err
+	}
+	if v := current.versions[opt.AliasName]; v == "" || v == newVersion {
+		return "", false, nil
+	}
+	app.logger.Printf("[info] pre-warming provisioned concurrency %d of version %s before updating alias %s", n, newVersion, opt.AliasName)
+	if err := app.putProvisionedConcurrency(ctx, name, newVersion, n); err != nil {
+		return "", false, err
+	}
+	if err := app.waitProvisionedConcurrencyReady(ctx, name, newVersion); err != nil {
+		if derr := app.deleteProvisionedConcurrency(ctx, name, newVersion); derr != nil {
+			app.logger.Printf("[warn] %s", derr)
+		}
+		return "", false, fmt.Errorf("failed to pre-warm version %s: %w", newVersion, err)
+	}
+	return current.qualifiers[opt.AliasName], true, nil
+}
+
+func (app *App) putProvisionedConcurrency(ctx context.Context, name, qualifier string, n int32) error {
+	if _, err := app.lambda.PutProvisionedConcurrencyConfig(ctx, &lambda.PutProvisionedConcurrencyConfigInput{
+		FunctionName:                    aws.String(name),
+		Qualifier:                       aws.String(qualifier),
+		ProvisionedConcurrentExecutions: aws.Int32(n),
+	}); err != nil {
+		return fmt.Errorf("failed to put provisioned concurrency config of %s: %w", qualifier, err)
+	}
+	return nil
+}
+
+// deleteProvisionedConcurrency deletes the provisioned concurrency config of the qualifier. It does nothing for empty qualifier.
+func (app *App) deleteProvisionedConcurrency(ctx context.Context, name, qualifier string) error {
+	if qualifier == "" {
+		return nil
+	}
+	if _, err := app.lambda.DeleteProvisionedConcurrencyConfig(ctx, &lambda.DeleteProvisionedConcurrencyConfigInput{
+		FunctionName: aws.String(name),
+		Qualifier:    aws.String(qualifier),
+	}); err != nil {
+		var pnfe *types.ProvisionedConcurrencyConfigNotFoundException
+		if errors.As(err, &pnfe) {
+			return nil
+		}
+		return fmt.Errorf("failed to delete provisioned concurrency config of %s: %w", qualifier, err)
+	}
+	return nil
+}
+
+// waitProvisionedConcurrencyReady waits for the provisioned concurrency of the qualifier to be READY
+func (app *App) waitProvisionedConcurrencyReady(ctx context.Context, name, qualifier string) error {
+	retryer := provisionedConcurrencyPolicy.Start(ctx)
+	for retryer.Continue() {
+		res, err := app.lambda.GetProvisionedConcurrencyConfig(ctx, &lambda.GetProvisionedConcurrencyConfigInput{
+			FunctionName: aws.String(name),
+			Qualifier:    aws.String(qualifier),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get provisioned concurrency config of %s: %w", qualifier, err)
+		}
+		app.logger.Printf("[info] provisioned concurrency of %s Status:%s Allocated:%d/%d",
+			qualifier, res.Status,
+			aws.ToInt32(res.AllocatedProvisionedConcurrentExecutions),
+			aws.ToInt32(res.RequestedProvisionedConcurrentExecutions),
+		)
+		switch res.Status {
+		case types.ProvisionedConcurrencyStatusEnumReady:
+			return nil
+		case types.ProvisionedConcurrencyStatusEnumFailed:
+			return fmt.Errorf("failed to allocate provisioned concurrency of %s: %s", qualifier, aws.ToString(res.StatusReason))
+		}
+		app.logger.Printf("[info] waiting for provisioned concurrency of %s to be %s", qualifier, types.ProvisionedConcurrencyStatusEnumReady)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("timed out waiting for provisioned concurrency of %s to be %s", qualifier, types.ProvisionedConcurrencyStatusEnumReady)
+}
+
+func (app *App) diffConcurrency(ctx context.Context, fn *FunctionDefinition, opt *DiffOption) error {
+	c := fn.Concurrency
+	if c == nil {
+		return nil
+	}
+	name := *fn.FunctionName
+	current, err := app.getConcurrency(ctx, name, c)
+	if err != nil {
+		return err
+	}
+	r, _ := toGeneralMap(map[string]*Concurrency{"Concurrency": current}, false)
+	l, _ := toGeneralMap(map[string]*Concurrency{"Concurrency": c}, false)
+	if diff, err := jsondiff.Diff(
+		&jsondiff.Input{Name: app.functionArn(ctx, name), X: r},
+		&jsondiff.Input{Name: app.functionFilePath, X: l},
+	); err != nil {
+		return fmt.Errorf("failed to diff: %w", err)
+	} else if diff != "" {
+		fmt.Fprint(app.stdout, coloredDiff(diff))
+		opt.report.addChanges(diffChanges(r, l, ""))
+	}
+	return nil
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"log"
 	"os"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -14,17 +13,24 @@ import (
 
 var directUploadThreshold = int64(50 * 1024 * 1024) // 50MB
 
-func prepareZipfile(src string, excludes []string, keepSymlink bool) (*os.File, os.FileInfo, error) {
+func prepareZipfile(src string, opt *ZipOption) (*os.File, os.FileInfo, error) {
+	if len(opt.includes) > 0 {
+		// --src is not used
+		return createZipArchive(src, opt)
+	}
 	if fi, err := os.Stat(src); err != nil {
 		return nil, nil, fmt.Errorf("src %s is not found: %w", src, err)
 	} else if fi.IsDir() {
-		zipfile, info, err := createZipArchive(src, excludes, keepSymlink)
+		zipfile, info, err := createZipArchive(src, opt)
 		if err != nil {
 			return nil, nil, err
 		}
 		return zipfile, info, nil
 	} else if !fi.IsDir() {
-		zipfile, info, err := loadZipArchive(src)
+		if opt.bootstrap != nil {
+			return nil, nil, fmt.Errorf("--build-go can not be used with a zip archive %s", src)
+		}
+		zipfile, info, err := loadZipArchive(src, opt.getLogger())
 		if err != nil {
 			return nil, nil, err
 		}
@@ -33,70 +39,96 @@ func prepareZipfile(src string, excludes []string, keepSymlink bool) (*os.File,
 	return nil, nil, fmt.Errorf("src %s is not found", src)
 }
 
-func (app *App) prepareFunctionCodeForDeploy(ctx context.Context, opt *DeployOption, fn *Function) error {
+// prepareFunctionCodeForDeploy prepares the code of the function to deploy.
+// When the sha256 of the zip archive equals to currentCodeSha256, it returns true without uploading the archive.
+func (app *App) prepareFunctionCodeForDeploy(ctx context.Context, opt *DeployOption, fn *FunctionDefinition, currentCodeSha256 string) (bool, error) {
 	if fn.PackageType == types.PackageTypeImage {
 		if fn.Code == nil || fn.Code.ImageUri == nil {
-			return fmt.Errorf("PackageType=Image requires Code.ImageUri in function definition")
+			return false, fmt.Errorf("PackageType=Image requires Code.ImageUri in function definition")
+		}
+		if fn.Image != nil && !opt.SkipArchive {
+			if err := app.pushImage(ctx, fn, opt); err != nil {
+				return false, fmt.Errorf("failed to push image: %w", err)
+			}
+		} else {
+			app.pinImageDigest(ctx, fn)
 		}
-		// deploy docker image. no need to prepare
-		log.Printf("[info] using docker image %s", *fn.Code.ImageUri)
+		app.logger.Printf("[info] using docker image %s", *fn.Code.ImageUri)
 
 		if fn.ImageConfig == nil {
 			fn.ImageConfig = &types.ImageConfig{} // reset explicitly
 		}
-		return nil
+		return false, nil
 	}
 
 	if opt.SkipArchive {
 		if fn.Code == nil || fn.Code.S3Bucket == nil || fn.Code.S3Key == nil {
-			return fmt.Errorf("--skip-archive requires Code.S3Bucket and Code.S3key elements in function definition")
+			return false, fmt.Errorf("--skip-archive requires Code.S3Bucket and Code.S3key elements in function definition")
 		}
-		return nil
+		return false, nil
 	}
 
-	zipfile, info, err := prepareZipfile(opt.Src, opt.excludes, opt.KeepSymlink)
+	if err := app.prepareSources(ctx, fn, &opt.BuildOption); err != nil {
+		return false, err
+	}
+	zipfile, info, err := prepareZipfile(opt.Src, &opt.ZipOption)
 	if err != nil {
-		return err
+		return false, err
 	}
 	defer zipfile.Close()
+	if opt.plan != nil {
+		if err := opt.plan.checkCodeSha256(zipfile); err != nil {
+			return false, err
+		}
+	}
+	if currentCodeSha256 != "" {
+		sha, err := sha256OfFile(zipfile)
+		if err != nil {
+			return false, err
+		}
+		if sha == currentCodeSha256 {
+			app.logger.Printf("[info] CodeSha256 %s of the zip archive is the same as the deployed function", sha)
+			return true, nil
+		}
+	}
 
 	if fn.Code != nil {
 		if bucket, key := fn.Code.S3Bucket, fn.Code.S3Key; bucket != nil && key != nil {
-			log.Printf("[info] uploading function %d bytes to s3://%s/%s", info.Size(), *bucket, *key)
+			app.logger.Printf("[info] uploading function %d bytes to s3://%s/%s", info.Size(), *bucket, *key)
 			versionID, err := app.uploadFunctionToS3(ctx, zipfile, *bucket, *key)
 			if err != nil {
-				return fmt.Errorf("failed to upload function zip to s3://%s/%s: %w", *bucket, *key, err)
+				return false, fmt.Errorf("failed to upload function zip to s3://%s/%s: %w", *bucket, *key, err)
 			}
 			if versionID != "" {
-				log.Printf("[info] object created as version %s", versionID)
+				app.logger.Printf("[info] object created as version %s", versionID)
 				fn.Code.S3ObjectVersion = aws.String(versionID)
 			} else {
-				log.Printf("[info] object created")
+				app.logger.Printf("[info] object created")
 				fn.Code.S3ObjectVersion = nil
 			}
 		} else {
-			return fmt.Errorf("Code.S3Bucket or Code.S3Key are not defined")
+			return false, fmt.Errorf("Code.S3Bucket or Code.S3Key are not defined")
 		}
 	} else {
 		// try direct upload
 		if s := info.Size(); s > directUploadThreshold {
-			return fmt.Errorf("cannot use a zip file for update function directly. Too large file %d bytes. Please define Code.S3Bucket and Code.S3Key in function.json", s)
+			return false, fmt.Errorf("cannot use a zip file for update function directly. Too large file %d bytes. Please define Code.S3Bucket and Code.S3Key in function.json", s)
 		}
 		b, err := io.ReadAll(zipfile)
 		if err != nil {
-			return fmt.Errorf("failed to read zipfile content: %w", err)
+			return false, fmt.Errorf("failed to read zipfile content: %w", err)
 		}
 		fn.Code = &types.FunctionCode{ZipFile: b}
 	}
-	return nil
+	return false, nil
 }
 
-func (app *App) create(ctx context.Context, opt *DeployOption, fn *Function) error {
-	err := app.prepareFunctionCodeForDeploy(ctx, opt, fn)
+func (app *App) create(ctx context.Context, opt *DeployOption, fn *FunctionDefinition) error {
+	_, err := app.prepareFunctionCodeForDeploy(ctx, opt, fn, "")
 	if err != nil {
 		return fmt.Errorf("failed to prepare function code: %w", err)
 	}
-	log.Println("[info] creating function", opt.label())
+	app.logger.Println("[info] creating function", opt.label())
 
 	version := "(created)"
 	if !opt.DryRun {
@@ -107,9 +139,9 @@ func (app *App) create(ctx context.Context, opt *DeployOption, fn *Function) err
 		}
 		if res.Version != nil {
 			version = *res.Version
-			log.Printf("[info] deployed function version %s", version)
+			app.logger.Printf("[info] deployed function version %s", version)
 		} else {
-			log.Println("[info] deployed")
+			app.logger.Println("[info] deployed")
 		}
 	}
 
@@ -121,7 +153,7 @@ func (app *App) create(ctx context.Context, opt *DeployOption, fn *Function) err
 		return nil
 	}
 
-	log.Printf("[info] creating alias set %s to version %s %s", opt.AliasName, version, opt.label())
+	app.logger.Printf("[info] creating alias set %s to version %s %s", opt.AliasName, version, opt.label())
 	if !opt.DryRun {
 		_, err := app.lambda.CreateAlias(ctx, &lambda.CreateAliasInput{
 			FunctionName:    fn.FunctionName,
@@ -131,16 +163,17 @@ func (app *App) create(ctx context.Context, opt *DeployOption, fn *Function) err
 		if err != nil {
 			return fmt.Errorf("failed to create alias: %w", err)
 		}
-		log.Println("[info] alias created")
+		app.logger.Println("[info] alias created")
 	}
 	return nil
 }
 
-func (app *App) createFunction(ctx context.Context, fn *Function) (*lambda.CreateFunctionOutput, error) {
-	in := lambda.CreateFunctionInput(*fn)
+func (app *App) createFunction(ctx context.Context, fn *FunctionDefinition) (*lambda.CreateFunctionOutput, error) {
+	in := lambda.CreateFunctionInput(fn.Function)
 	if res, err := app.lambda.CreateFunction(ctx, &in); err != nil {
 		return nil, fmt.Errorf("failed to create function: %w", err)
 	} else {
-		return res, app.waitForLastUpdateStatusSuccessful(ctx, *fn.FunctionName)
+		_, err = app.waitForLastUpdateStatusSuccessful(ctx, *fn.FunctionName)
+		return res, err
 	}
 }
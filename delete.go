@@ -3,7 +3,6 @@ package lambroll
 import (
 	"context"
 	"fmt"
-	"log"
 
 	"github.com/Songmu/prompter"
 	"github.com/aws/aws-sdk-go-v2/service/lambda"
@@ -29,14 +28,14 @@ func (app *App) Delete(ctx context.Context, opt *DeleteOption) error {
 		return fmt.Errorf("failed to load function: %w", err)
 	}
 
-	log.Println("[info] deleting function", *fn.FunctionName, opt.label())
+	app.logger.Println("[info] deleting function", *fn.FunctionName, opt.label())
 
 	if opt.DryRun {
 		return nil
 	}
 
 	if !opt.Force && !prompter.YN("Do you want to delete the function?", false) {
-		log.Println("[info] canceled to delete function", *fn.FunctionName)
+		app.logger.Println("[info] canceled to delete function", *fn.FunctionName)
 		return nil
 	}
 
@@ -47,7 +46,7 @@ func (app *App) Delete(ctx context.Context, opt *DeleteOption) error {
 		return fmt.Errorf("failed to delete function: %w", err)
 	}
 
-	log.Println("[info] completed to delete function", *fn.FunctionName)
+	app.logger.Println("[info] completed to delete function", *fn.FunctionName)
 
 	return nil
 }
@@ -6,30 +6,45 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"os"
+	"slices"
+	"strconv"
+	"time"
 
 	"github.com/aereal/jsondiff"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/lambda"
 	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
 	"github.com/itchyny/gojq"
+	"github.com/samber/lo"
 )
 
 // DeployOption represents an option for Deploy()
 type DeployOption struct {
-	Src           string `help:"function zip archive or src dir" default:"."`
-	Publish       bool   `help:"publish function" default:"true"`
-	AliasName     string `name:"alias" help:"alias name for publish" default:"current"`
-	AliasToLatest bool   `help:"set alias to unpublished $LATEST version" default:"false"`
-	DryRun        bool   `help:"dry run" default:"false"`
-	SkipArchive   bool   `help:"skip to create zip archive. requires Code.S3Bucket and Code.S3Key in function definition" default:"false"`
-	KeepVersions  int    `help:"Number of latest versions to keep. Older versions will be deleted. (Optional value: default 0)." default:"0"`
-	Ignore        string `help:"ignore fields by jq queries in function.json" default:""`
-	FunctionURL   string `help:"path to function-url definition" default:"" env:"LAMBROLL_FUNCTION_URL"`
-	SkipFunction  bool   `help:"skip to deploy a function. deploy function-url only" default:"false"`
-
-	ZipOption
+	Src                 string `help:"function zip archive or src dir" default:"."`
+	Publish             bool   `help:"publish function" default:"true"`
+	AliasName           string `name:"alias" help:"alias name for publish" default:"current"`
+	AliasToLatest       bool   `help:"set alias to unpublished $LATEST version" default:"false"`
+	DryRun              bool   `help:"dry run" default:"false"`
+	SkipArchive         bool   `help:"skip to create zip archive. requires Code.S3Bucket and Code.S3Key in function definition" default:"false"`
+	KeepVersions        int    `help:"Number of latest versions to keep. Older versions will be deleted. (Optional value: default 0)." default:"0"`
+	Ignore              string `help:"ignore fields by jq queries in function.json" default:""`
+	FunctionURL         string `help:"path to function-url definition" default:"" env:"LAMBROLL_FUNCTION_URL"`
+	SkipFunction        bool   `help:"skip to deploy a function. deploy function-url and event-source-mappings only" default:"false"`
+	EventSourceMappings string `help:"path to event source mappings definition" default:"" env:"LAMBROLL_EVENT_SOURCE_MAPPINGS"`
+	Plan                string `help:"apply the deploy plan file created by diff --out" default:""`
+	LockRevision        bool   `help:"fail fast when another update of the function is in progress, instead of waiting and retrying" default:"false"`
+
+	CanaryWeight   int           `help:"percentage of traffic routed to the new version at first. enables canary deployment (0: disabled)" default:"0"`
+	CanarySteps    []int         `help:"percentages of traffic routed to the new version after each interval"`
+	CanaryInterval time.Duration `help:"interval between canary steps" default:"5m"`
+	Alarms         []string      `help:"CloudWatch alarm names to watch during canary deployment. rollback automatically when any alarm goes to ALARM state"`
+	ResetRouting   bool          `help:"reset weighted routing of the alias left by an unfinished canary deployment" default:"false"`
+
+	BuildOption
+	ProjectOption
+
+	plan *Plan
 }
 
 func (opt DeployOption) label() string {
@@ -40,8 +55,38 @@ func (opt DeployOption) label() string {
 }
 
 type versionAlias struct {
-	Version string
-	Name    string
+	Version      string
+	Name         string
+	RevisionId   *string
+	ResetRouting bool // remove weighted routing of the alias
+}
+
+// conflictError represents that the function or the alias is modified by others during deploy
+type conflictError struct {
+	name string
+	err  error
+}
+
+func (e *conflictError) Error() string {
+	return fmt.Sprintf("%s was modified by others during deploy. retry after the other deployment finished: %s", e.name, e.err)
+}
+
+func (e *conflictError) Unwrap() error {
+	return e.err
+}
+
+// asConflictError returns conflictError when err is a mismatch of RevisionId.
+// When lock is true, ResourceConflictException is also treated as conflictError.
+func asConflictError(name string, err error, lock bool) error {
+	var pfe *types.PreconditionFailedException
+	if errors.As(err, &pfe) {
+		return &conflictError{name: name, err: err}
+	}
+	var rce *types.ResourceConflictException
+	if lock && errors.As(err, &rce) {
+		return &conflictError{name: name, err: err}
+	}
+	return nil
 }
 
 // Expand expands ExcludeFile contents to Excludes
@@ -76,15 +121,24 @@ func (app *App) Deploy(ctx context.Context, opt *DeployOption) error {
 	if err := opt.Expand(); err != nil {
 		return err
 	}
-	log.Printf("[debug] %s", opt.String())
+	app.logger.Printf("[debug] %s", opt.String())
+	if opt.CanaryWeight > 0 && !opt.Publish {
+		return fmt.Errorf("--canary-weight requires --publish. weighted routing is not available for $LATEST")
+	}
 
-	fn, err := app.loadFunction(app.functionFilePath)
+	fn, err := app.loadFunctionForDeploy(opt)
 	if err != nil {
 		return fmt.Errorf("failed to load function: %w", err)
 	}
 
 	deployFunctionURL := func(context.Context) error { return nil }
-	if opt.FunctionURL != "" {
+	if opt.plan != nil {
+		if opt.plan.FunctionURL != nil {
+			deployFunctionURL = func(ctx context.Context) error {
+				return app.deployPlannedFunctionURL(ctx, opt.plan.FunctionURL, opt)
+			}
+		}
+	} else if opt.FunctionURL != "" {
 		deployFunctionURL = func(ctx context.Context) error {
 			fc, err := app.loadFunctionUrl(opt.FunctionURL, *fn.FunctionName)
 			if err != nil {
@@ -94,36 +148,112 @@ func (app *App) Deploy(ctx context.Context, opt *DeployOption) error {
 		}
 	}
 
+	deployEventSourceMappings := func(context.Context) error { return nil }
+	if opt.EventSourceMappings != "" {
+		deployEventSourceMappings = func(ctx context.Context) error {
+			esms, err := app.loadEventSourceMappings(opt.EventSourceMappings, *fn.FunctionName)
+			if err != nil {
+				return fmt.Errorf("failed to load event source mappings: %w", err)
+			}
+			return app.deployEventSourceMappings(ctx, *fn.FunctionName, esms, opt)
+		}
+	}
+
 	if opt.SkipFunction {
-		// skip to deploy a function. deploy function-url only
-		return deployFunctionURL(ctx)
+		// skip to deploy a function. deploy function-url and event source mappings only
+		if err := deployFunctionURL(ctx); err != nil {
+			return err
+		}
+		return deployEventSourceMappings(ctx)
 	}
 
-	log.Printf("[info] starting deploy function %s", *fn.FunctionName)
-	if current, err := app.lambda.GetFunction(ctx, &lambda.GetFunctionInput{
+	app.logger.Printf("[info] starting deploy function %s", *fn.FunctionName)
+	current, err := app.lambda.GetFunction(ctx, &lambda.GetFunctionInput{
 		FunctionName: fn.FunctionName,
-	}); err != nil {
+	})
+	if err != nil {
 		var nfe *types.ResourceNotFoundException
 		if !errors.As(err, &nfe) {
 			return err
 		}
+		if opt.plan != nil {
+			if err := opt.plan.checkDrift(nil); err != nil {
+				return err
+			}
+		}
 		if err := app.create(ctx, opt, fn); err != nil {
 			return err
 		}
+		if err := app.deployConcurrency(ctx, fn, opt); err != nil {
+			return fmt.Errorf("failed to deploy concurrency: %w", err)
+		}
+		if err := app.deployPermissions(ctx, fn, opt); err != nil {
+			return fmt.Errorf("failed to deploy permissions: %w", err)
+		}
+		if err := app.deployEventInvokeConfig(ctx, fn, opt); err != nil {
+			return fmt.Errorf("failed to deploy event invoke config: %w", err)
+		}
 		if err := deployFunctionURL(ctx); err != nil {
 			return err
 		}
-		return nil
-	} else if err := validateUpdateFunction(current.Configuration, current.Code, fn); err != nil {
+		return deployEventSourceMappings(ctx)
+	}
+	if err := validateUpdateFunction(current.Configuration, current.Code, &fn.Function); err != nil {
 		return err
 	}
-	fillDefaultValues(fn)
+	if opt.plan != nil {
+		if err := opt.plan.checkDrift(current.Configuration); err != nil {
+			return err
+		}
+	}
+	if current.Configuration.LastUpdateStatus == types.LastUpdateStatusInProgress {
+		if opt.LockRevision {
+			return &conflictError{
+				name: *fn.FunctionName,
+				err:  fmt.Errorf("LastUpdateStatus is %s", current.Configuration.LastUpdateStatus),
+			}
+		}
+		// RevisionId changes when the update in progress completes
+		if current, err = app.waitForLastUpdateStatusSuccessful(ctx, *fn.FunctionName); err != nil {
+			return err
+		}
+	}
+	// RevisionId is passed to every update of the function to detect modifications by others
+	revisionId := current.Configuration.RevisionId
+	var aliasRevisionId *string
+	if !opt.DryRun && (opt.Publish || opt.AliasToLatest) {
+		alias, err := app.currentAlias(ctx, *fn.FunctionName, opt.AliasName)
+		if err != nil {
+			return err
+		}
+		if alias != nil {
+			aliasRevisionId = alias.RevisionId
+			if rc := alias.RoutingConfig; rc != nil && len(rc.AdditionalVersionWeights) > 0 && opt.CanaryWeight == 0 && !opt.ResetRouting {
+				return fmt.Errorf("alias %s has weighted routing %v (unfinished canary deployment?). complete or rollback it, or specify --reset-routing", opt.AliasName, rc.AdditionalVersionWeights)
+			}
+		}
+	}
+	fillDefaultValues(&fn.Function)
 
-	if err := app.prepareFunctionCodeForDeploy(ctx, opt, fn); err != nil {
+	// the upload is skipped when both of the code and the configuration are not changed,
+	// and a version of them can be reused
+	var currentCodeSha256, reusableVersion string
+	if changed, err := app.functionConfigurationChanged(current, fn, opt.Ignore); err != nil {
+		return err
+	} else if !changed {
+		if reusableVersion, err = app.reusableVersion(ctx, current.Configuration, opt); err != nil {
+			return err
+		}
+		if reusableVersion != "" {
+			currentCodeSha256 = aws.ToString(current.Configuration.CodeSha256)
+		}
+	}
+	unchanged, err := app.prepareFunctionCodeForDeploy(ctx, opt, fn, currentCodeSha256)
+	if err != nil {
 		return fmt.Errorf("failed to prepare function code for deploy: %w", err)
 	}
 
-	if ignore := opt.Ignore; ignore != "" {
+	if ignore := opt.Ignore; ignore != "" && opt.plan == nil {
 		q, err := gojq.Parse(ignore)
 		if err != nil {
 			return fmt.Errorf("failed to parse ignore query: %w", err)
@@ -135,11 +265,71 @@ func (app *App) Deploy(ctx context.Context, opt *DeployOption) error {
 			return fmt.Errorf("failed to modify function: %w", err)
 		}
 		src, _ := json.Marshal(fnAny)
-		fn = &Function{}
-		unmarshalJSON(src, &fn, app.functionFilePath)
+		fn = &FunctionDefinition{}
+		unmarshalJSON(src, &fn, app.functionFilePath, app.logger)
 	}
 
-	log.Println("[info] updating function configuration", opt.label())
+	var newerVersion string
+	if unchanged {
+		app.logger.Printf("[info] the code and the configuration of function %s are not changed. skip updating function %s", *fn.FunctionName, opt.label())
+		if err := app.updateTags(ctx, fn, opt); err != nil {
+			return err
+		}
+		newerVersion = reusableVersion
+		app.logger.Printf("[info] deployed version %s %s", newerVersion, opt.label())
+	} else if newerVersion, err = app.updateFunction(ctx, fn, revisionId, opt); err != nil {
+		return err
+	}
+	if opt.DryRun {
+		return nil
+	}
+	// the new version is pre-warmed before the alias points to it
+	oldProvisioned, prewarmed, err := app.prewarmConcurrency(ctx, fn, newerVersion, opt)
+	if err != nil {
+		return fmt.Errorf("failed to deploy concurrency: %w", err)
+	}
+	if err := app.deployAlias(ctx, fn, newerVersion, aliasRevisionId, opt); err != nil {
+		if prewarmed {
+			if derr := app.deleteProvisionedConcurrency(ctx, *fn.FunctionName, newerVersion); derr != nil {
+				app.logger.Printf("[warn] %s", derr)
+			}
+		}
+		return err
+	}
+	if prewarmed && oldProvisioned != "" {
+		app.logger.Printf("[info] deleting provisioned concurrency of %s", oldProvisioned)
+		if err := app.deleteProvisionedConcurrency(ctx, *fn.FunctionName, oldProvisioned); err != nil {
+			return fmt.Errorf("failed to deploy concurrency: %w", err)
+		}
+	}
+	if err := app.deployConcurrency(ctx, fn, opt); err != nil {
+		return fmt.Errorf("failed to deploy concurrency: %w", err)
+	}
+	if opt.KeepVersions > 0 { // Ignore zero-value.
+		if err := app.deleteVersions(ctx, *fn.FunctionName, opt.KeepVersions); err != nil {
+			return err
+		}
+	}
+
+	if err := app.deployPermissions(ctx, fn, opt); err != nil {
+		return fmt.Errorf("failed to deploy permissions: %w", err)
+	}
+	if err := app.deployEventInvokeConfig(ctx, fn, opt); err != nil {
+		return fmt.Errorf("failed to deploy event invoke config: %w", err)
+	}
+	if err := deployFunctionURL(ctx); err != nil {
+		return err
+	}
+	if err := deployEventSourceMappings(ctx); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// updateFunction updates the configuration and the code of the function, and returns the deployed version
+func (app *App) updateFunction(ctx context.Context, fn *FunctionDefinition, revisionId *string, opt *DeployOption) (string, error) {
+	app.logger.Println("[info] updating function configuration", opt.label())
 	confIn := &lambda.UpdateFunctionConfigurationInput{
 		DeadLetterConfig:  fn.DeadLetterConfig,
 		Description:       fn.Description,
@@ -159,20 +349,35 @@ func (app *App) Deploy(ctx context.Context, opt *DeployOption) error {
 		VpcConfig:         fn.VpcConfig,
 		ImageConfig:       fn.ImageConfig,
 		SnapStart:         fn.SnapStart,
+		RevisionId:        revisionId,
 	}
-	log.Printf("[debug] %s", jsonStr(confIn))
+	app.logger.Printf("[debug] %s", jsonStr(confIn))
 
-	var newerVersion string
 	if !opt.DryRun {
+		var updated *lambda.UpdateFunctionConfigurationOutput
 		proc := func(ctx context.Context) error {
-			return app.updateFunctionConfiguration(ctx, confIn)
+			var err error
+			updated, err = app.updateFunctionConfiguration(ctx, confIn, opt.LockRevision)
+			return err
 		}
-		if err := app.ensureLastUpdateStatusSuccessful(ctx, *fn.FunctionName, "updating function configuration", proc, opt.label()); err != nil {
-			return fmt.Errorf("failed to update function configuration: %w", err)
+		res, err := app.ensureLastUpdateStatusSuccessful(ctx, *fn.FunctionName, "updating function configuration", proc, opt.label())
+		if err != nil {
+			return "", fmt.Errorf("failed to update function configuration: %w", err)
+		}
+		// RevisionId changes while LastUpdateStatus becomes successful.
+		// Take the new one only when nobody else has modified the configuration in the meantime.
+		if modified, err := configurationModified(updated, res.Configuration); err != nil {
+			return "", err
+		} else if modified {
+			return "", &conflictError{
+				name: *fn.FunctionName,
+				err:  fmt.Errorf("the configuration was changed after UpdateFunctionConfiguration"),
+			}
 		}
+		revisionId = res.Configuration.RevisionId
 	}
 	if err := app.updateTags(ctx, fn, opt); err != nil {
-		return err
+		return "", err
 	}
 
 	codeIn := &lambda.UpdateFunctionCodeInput{
@@ -183,6 +388,7 @@ func (app *App) Deploy(ctx context.Context, opt *DeployOption) error {
 		S3Key:           fn.Code.S3Key,
 		S3ObjectVersion: fn.Code.S3ObjectVersion,
 		ImageUri:        fn.Code.ImageUri,
+		RevisionId:      revisionId,
 	}
 	if opt.DryRun {
 		codeIn.DryRun = true
@@ -194,66 +400,169 @@ func (app *App) Deploy(ctx context.Context, opt *DeployOption) error {
 	proc := func(ctx context.Context) error {
 		var err error
 		// set res outside of this function
-		res, err = app.updateFunctionCode(ctx, codeIn)
+		res, err = app.updateFunctionCode(ctx, codeIn, opt.LockRevision)
 		return err
 	}
-	if err := app.ensureLastUpdateStatusSuccessful(ctx, *fn.FunctionName, "updating function code", proc, opt.label()); err != nil {
-		return err
+	if _, err := app.ensureLastUpdateStatusSuccessful(ctx, *fn.FunctionName, "updating function code", proc, opt.label()); err != nil {
+		return "", err
 	}
+	newerVersion := versionLatest
 	if res.Version != nil {
 		newerVersion = *res.Version
-		log.Printf("[info] deployed version %s %s", *res.Version, opt.label())
-	} else {
-		newerVersion = versionLatest
-		log.Printf("[info] deployed version %s %s", newerVersion, opt.label())
 	}
-	if opt.DryRun {
-		return nil
+	app.logger.Printf("[info] deployed version %s %s", newerVersion, opt.label())
+	return newerVersion, nil
+}
+
+// reusableVersion returns the version to deploy when the code and the configuration of $LATEST are not changed.
+// The version of the alias or the latest published version is reused when it is the same as $LATEST,
+// instead of publishing a new version. It returns "" when there is no version to reuse.
+func (app *App) reusableVersion(ctx context.Context, current *types.FunctionConfiguration, opt *DeployOption) (string, error) {
+	if opt.DryRun || !opt.Publish {
+		return versionLatest, nil
+	}
+	name := aws.ToString(current.FunctionName)
+	var candidates []string
+	alias, err := app.currentAlias(ctx, name, opt.AliasName)
+	if err != nil {
+		return "", err
+	}
+	if alias != nil && aws.ToString(alias.FunctionVersion) != versionLatest {
+		candidates = append(candidates, aws.ToString(alias.FunctionVersion))
 	}
-	if opt.Publish || opt.AliasToLatest {
-		err := app.updateAliases(ctx, *fn.FunctionName, versionAlias{newerVersion, opt.AliasName})
+
+	versions := map[string]*types.FunctionConfiguration{}
+	var latest int64
+	params := &lambda.ListVersionsByFunctionInput{FunctionName: current.FunctionName}
+	for {
+		res, err := app.lambda.ListVersionsByFunction(ctx, params)
 		if err != nil {
-			return err
+			return "", fmt.Errorf("failed to list versions: %w", err)
 		}
+		for _, v := range res.Versions {
+			versions[aws.ToString(v.Version)] = &v
+			if n, err := strconv.ParseInt(aws.ToString(v.Version), 10, 64); err == nil && n > latest {
+				latest = n
+			}
+		}
+		if res.NextMarker == nil {
+			break
+		}
+		params.Marker = res.NextMarker
 	}
-	if opt.KeepVersions > 0 { // Ignore zero-value.
-		return app.deleteVersions(ctx, *fn.FunctionName, opt.KeepVersions)
+	if latest > 0 {
+		candidates = append(candidates, strconv.FormatInt(latest, 10))
 	}
 
-	if err := deployFunctionURL(ctx); err != nil {
-		return err
+	for _, version := range lo.Uniq(candidates) {
+		v, ok := versions[version]
+		if !ok {
+			continue
+		}
+		if aws.ToString(v.CodeSha256) != aws.ToString(current.CodeSha256) {
+			continue
+		}
+		if same, err := sameConfiguration(v, current); err != nil {
+			return "", err
+		} else if same {
+			app.logger.Printf("[info] version %s has the same code and configuration as %s", version, versionLatest)
+			return version, nil
+		}
 	}
+	app.logger.Printf("[info] no version has the same code and configuration as %s", versionLatest)
+	return "", nil
+}
 
-	return nil
+// functionConfigurationChanged reports whether the configuration of fn differs from the deployed function.
+// Code and Tags are not compared.
+func (app *App) functionConfigurationChanged(current *lambda.GetFunctionOutput, fn *FunctionDefinition, ignore string) (bool, error) {
+	remoteFunc := newFunctionFrom(current.Configuration, current.Code, nil)
+	fillDefaultValues(remoteFunc)
+	remote, local := *remoteFunc, fn.Function
+	remote.Code, local.Code = nil, nil
+	remote.Tags, local.Tags = nil, nil
+	local.Publish = false
+
+	opts := []jsondiff.Option{}
+	if ignore != "" {
+		q, err := gojq.Parse(ignore)
+		if err != nil {
+			return false, fmt.Errorf("failed to parse ignore query: %w", err)
+		}
+		opts = append(opts, jsondiff.Ignore(q))
+	}
+	remoteJSON, _ := marshalAny(remote)
+	localJSON, _ := marshalAny(local)
+	ds, err := jsondiff.Diff(
+		&jsondiff.Input{Name: "remote", X: remoteJSON},
+		&jsondiff.Input{Name: "local", X: localJSON},
+		opts...,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to diff function configuration: %w", err)
+	}
+	app.logger.Printf("[debug] diff of function configuration: %s", ds)
+	return ds != "", nil
 }
 
-func (app *App) updateFunctionConfiguration(ctx context.Context, in *lambda.UpdateFunctionConfigurationInput) error {
+func (app *App) updateFunctionConfiguration(ctx context.Context, in *lambda.UpdateFunctionConfigurationInput, lock bool) (*lambda.UpdateFunctionConfigurationOutput, error) {
 	retryer := retryPolicy.Start(ctx)
 	for retryer.Continue() {
-		_, err := app.lambda.UpdateFunctionConfiguration(ctx, in)
+		res, err := app.lambda.UpdateFunctionConfiguration(ctx, in)
 		if err != nil {
+			if cerr := asConflictError(*in.FunctionName, err, lock); cerr != nil {
+				return nil, cerr
+			}
 			var rce *types.ResourceConflictException
 			if errors.As(err, &rce) {
-				log.Println("[debug] retrying", rce.Error())
+				app.logger.Println("[debug] retrying", rce.Error())
 				continue
 			}
-			return fmt.Errorf("failed to update function configuration: %w", err)
+			return nil, fmt.Errorf("failed to update function configuration: %w", err)
 		}
-		return nil
+		return res, nil
 	}
-	return fmt.Errorf("failed to update function configuration (max retries reached)")
+	return nil, fmt.Errorf("failed to update function configuration (max retries reached)")
 }
 
-func (app *App) updateFunctionCode(ctx context.Context, in *lambda.UpdateFunctionCodeInput) (*lambda.UpdateFunctionCodeOutput, error) {
+// configurationModified reports whether the configuration of the function differs from the result of UpdateFunctionConfiguration
+func configurationModified(updated *lambda.UpdateFunctionConfigurationOutput, current *types.FunctionConfiguration) (bool, error) {
+	var c types.FunctionConfiguration
+	if b, err := json.Marshal(updated); err != nil {
+		return false, fmt.Errorf("failed to marshal function configuration: %w", err)
+	} else if err := json.Unmarshal(b, &c); err != nil {
+		return false, fmt.Errorf("failed to unmarshal function configuration: %w", err)
+	}
+	same, err := sameConfiguration(&c, current)
+	return !same, err
+}
+
+// sameConfiguration reports whether the configurations of the functions are the same. Code is not compared.
+func sameConfiguration(a, b *types.FunctionConfiguration) (bool, error) {
+	x, err := marshalJSON(newFunctionFrom(a, nil, nil))
+	if err != nil {
+		return false, err
+	}
+	y, err := marshalJSON(newFunctionFrom(b, nil, nil))
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(x, y), nil
+}
+
+func (app *App) updateFunctionCode(ctx context.Context, in *lambda.UpdateFunctionCodeInput, lock bool) (*lambda.UpdateFunctionCodeOutput, error) {
 	var res *lambda.UpdateFunctionCodeOutput
 	retryer := retryPolicy.Start(ctx)
 	for retryer.Continue() {
 		var err error
 		res, err = app.lambda.UpdateFunctionCode(ctx, in)
 		if err != nil {
+			if cerr := asConflictError(*in.FunctionName, err, lock); cerr != nil {
+				return nil, cerr
+			}
 			var rce *types.ResourceConflictException
 			if errors.As(err, &rce) {
-				log.Println("[debug] retrying", err)
+				app.logger.Println("[debug] retrying", err)
 				continue
 			}
 			return nil, fmt.Errorf("failed to update function code: %w", err)
@@ -263,56 +572,104 @@ func (app *App) updateFunctionCode(ctx context.Context, in *lambda.UpdateFunctio
 	return res, nil
 }
 
-func (app *App) ensureLastUpdateStatusSuccessful(ctx context.Context, name string, msg string, code func(ctx context.Context) error, label string) error {
-	log.Println("[info]", msg, "...", label)
-	if err := app.waitForLastUpdateStatusSuccessful(ctx, name); err != nil {
-		return err
+// ensureLastUpdateStatusSuccessful runs code after LastUpdateStatus becomes successful,
+// and waits for LastUpdateStatus to be successful again. It returns the function after the update.
+func (app *App) ensureLastUpdateStatusSuccessful(ctx context.Context, name string, msg string, code func(ctx context.Context) error, label string) (*lambda.GetFunctionOutput, error) {
+	app.logger.Println("[info]", msg, "...", label)
+	if _, err := app.waitForLastUpdateStatusSuccessful(ctx, name); err != nil {
+		return nil, err
 	}
 	if err := code(ctx); err != nil {
-		return err
+		return nil, err
 	}
-	log.Println("[info]", msg, "accepted. waiting for LastUpdateStatus to be successful.", label)
-	if err := app.waitForLastUpdateStatusSuccessful(ctx, name); err != nil {
-		return err
+	app.logger.Println("[info]", msg, "accepted. waiting for LastUpdateStatus to be successful.", label)
+	res, err := app.waitForLastUpdateStatusSuccessful(ctx, name)
+	if err != nil {
+		return nil, err
 	}
-	log.Println("[info]", msg, "successfully", label)
-	return nil
+	app.logger.Println("[info]", msg, "successfully", label)
+	return res, nil
 }
 
-func (app *App) waitForLastUpdateStatusSuccessful(ctx context.Context, name string) error {
+// waitForLastUpdateStatusSuccessful waits for LastUpdateStatus to be successful and returns the function
+func (app *App) waitForLastUpdateStatusSuccessful(ctx context.Context, name string) (*lambda.GetFunctionOutput, error) {
 	retryer := retryPolicy.Start(ctx)
 	for retryer.Continue() {
 		res, err := app.lambda.GetFunction(ctx, &lambda.GetFunctionInput{
 			FunctionName: aws.String(name),
 		})
 		if err != nil {
-			log.Println("[warn] failed to get function, retrying", err)
+			app.logger.Println("[warn] failed to get function, retrying", err)
 			continue
 		} else {
 			state := res.Configuration.State
 			last := res.Configuration.LastUpdateStatus
-			log.Printf("[info] State:%s LastUpdateStatus:%s", state, last)
+			app.logger.Printf("[info] State:%s LastUpdateStatus:%s", state, last)
 			if last == types.LastUpdateStatusSuccessful {
-				return nil
+				return res, nil
 			}
-			log.Printf("[info] waiting for LastUpdateStatus %s", types.LastUpdateStatusSuccessful)
+			app.logger.Printf("[info] waiting for LastUpdateStatus %s", types.LastUpdateStatusSuccessful)
+		}
+	}
+	return nil, fmt.Errorf("max retries reached")
+}
+
+// deployAlias updates the alias to newVersion, step by step on a canary deployment
+func (app *App) deployAlias(ctx context.Context, fn *FunctionDefinition, newVersion string, aliasRevisionId *string, opt *DeployOption) error {
+	if opt.Publish && opt.CanaryWeight > 0 {
+		alarms := lo.Uniq(append(slices.Clone(fn.Alarms), opt.Alarms...))
+		return app.deployCanary(ctx, *fn.FunctionName, newVersion, aliasRevisionId, alarms, opt)
+	} else if opt.Publish || opt.AliasToLatest {
+		return app.updateAliases(ctx, *fn.FunctionName, versionAlias{Version: newVersion, Name: opt.AliasName, RevisionId: aliasRevisionId, ResetRouting: opt.ResetRouting})
+	}
+	return nil
+}
+
+// aliasRevisionId returns RevisionId of the alias. It returns nil when the alias does not exist.
+func (app *App) aliasRevisionId(ctx context.Context, functionName, alias string) (*string, error) {
+	res, err := app.currentAlias(ctx, functionName, alias)
+	if err != nil || res == nil {
+		return nil, err
+	}
+	return res.RevisionId, nil
+}
+
+// currentAlias returns the alias. It returns nil when the alias does not exist.
+func (app *App) currentAlias(ctx context.Context, functionName, alias string) (*lambda.GetAliasOutput, error) {
+	res, err := app.lambda.GetAlias(ctx, &lambda.GetAliasInput{
+		FunctionName: aws.String(functionName),
+		Name:         aws.String(alias),
+	})
+	if err != nil {
+		var nfe *types.ResourceNotFoundException
+		if errors.As(err, &nfe) {
+			return nil, nil
 		}
+		return nil, fmt.Errorf("failed to get alias: %w", err)
 	}
-	return fmt.Errorf("max retries reached")
+	return res, nil
 }
 
 func (app *App) updateAliases(ctx context.Context, functionName string, vs ...versionAlias) error {
 	for _, v := range vs {
-		log.Printf("[info] updating alias set %s to version %s", v.Name, v.Version)
-		_, err := app.lambda.UpdateAlias(ctx, &lambda.UpdateAliasInput{
+		app.logger.Printf("[info] updating alias set %s to version %s", v.Name, v.Version)
+		in := &lambda.UpdateAliasInput{
 			FunctionName:    aws.String(functionName),
 			FunctionVersion: aws.String(v.Version),
 			Name:            aws.String(v.Name),
-		})
+			RevisionId:      v.RevisionId,
+		}
+		if v.ResetRouting {
+			// an empty RoutingConfig removes weighted routing (e.g. by canary deployment)
+			in.RoutingConfig = &types.AliasRoutingConfiguration{
+				AdditionalVersionWeights: map[string]float64{},
+			}
+		}
+		_, err := app.lambda.UpdateAlias(ctx, in)
 		if err != nil {
 			var nfe *types.ResourceNotFoundException
 			if errors.As(err, &nfe) {
-				log.Printf("[info] alias %s is not found. creating alias", v.Name)
+				app.logger.Printf("[info] alias %s is not found. creating alias", v.Name)
 				_, err := app.lambda.CreateAlias(ctx, &lambda.CreateAliasInput{
 					FunctionName:    aws.String(functionName),
 					FunctionVersion: aws.String(v.Version),
@@ -321,18 +678,20 @@ func (app *App) updateAliases(ctx context.Context, functionName string, vs ...ve
 				if err != nil {
 					return fmt.Errorf("failed to create alias: %w", err)
 				}
+			} else if cerr := asConflictError(functionName+":"+v.Name, err, false); cerr != nil {
+				return cerr
 			} else {
 				return fmt.Errorf("failed to update alias: %w", err)
 			}
 		}
-		log.Println("[info] alias updated")
+		app.logger.Println("[info] alias updated")
 	}
 	return nil
 }
 
 func (app *App) deleteVersions(ctx context.Context, functionName string, keepVersions int) error {
 	if keepVersions <= 0 {
-		log.Printf("[info] specify --keep-versions")
+		app.logger.Printf("[info] specify --keep-versions")
 		return nil
 	}
 
@@ -364,7 +723,7 @@ func (app *App) deleteVersions(ctx context.Context, functionName string, keepVer
 			break
 		}
 
-		log.Printf("[info] deleting function version: %s", *v.Version)
+		app.logger.Printf("[info] deleting function version: %s", *v.Version)
 		_, err := app.lambda.DeleteFunction(ctx, &lambda.DeleteFunctionInput{
 			FunctionName: aws.String(functionName),
 			Qualifier:    v.Version,
@@ -374,6 +733,6 @@ func (app *App) deleteVersions(ctx context.Context, functionName string, keepVer
 		}
 	}
 
-	log.Printf("[info] except %d latest versions are deleted", keepVersions)
+	app.logger.Printf("[info] except %d latest versions are deleted", keepVersions)
 	return nil
 }
@@ -1,13 +1,13 @@
 package lambroll
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"strings"
 
 	"github.com/aereal/jsondiff"
@@ -22,13 +22,21 @@ import (
 
 // DiffOption represents options for Diff()
 type DiffOption struct {
-	Src         string  `help:"function zip archive or src dir" default:"."`
-	CodeSha256  bool    `name:"code" help:"diff of code sha256" default:"false"`
-	Qualifier   *string `help:"the qualifier to compare"`
-	FunctionURL string  `help:"path to function-url definition" default:"" env:"LAMBROLL_FUNCTION_URL"`
-	Ignore      string  `help:"ignore diff by jq query" default:""`
+	Src                 string  `help:"function zip archive or src dir" default:"."`
+	CodeSha256          bool    `name:"code" help:"diff of code sha256" default:"false"`
+	Qualifier           *string `help:"the qualifier to compare"`
+	FunctionURL         string  `help:"path to function-url definition" default:"" env:"LAMBROLL_FUNCTION_URL"`
+	Ignore              string  `help:"ignore diff by jq query" default:""`
+	EventSourceMappings string  `help:"path to event source mappings definition" default:"" env:"LAMBROLL_EVENT_SOURCE_MAPPINGS"`
+	Out                 string  `help:"write a deploy plan to the file. apply it by deploy --plan" default:""`
+	ExitCode            bool    `help:"exit with 2 (configuration drift), 3 (code drift), 4 (both) or 5 (function not found) when changes are detected" default:"false"`
+	Report              string  `help:"write a JSON report of changed paths to the file" default:""`
+	Output              string  `help:"output format (text, json, patch, markdown). json prints changed values, patch prints JSON Patch (RFC 6902) for each document and markdown prints a collapsible diff for pull requests" default:"text" enum:"text,json,patch,markdown"`
 
-	ZipOption
+	BuildOption
+	ProjectOption
+
+	report *DiffReport
 }
 
 // Diff prints diff of function.json compared with latest function
@@ -36,13 +44,30 @@ func (app *App) Diff(ctx context.Context, opt *DiffOption) error {
 	if err := opt.Expand(); err != nil {
 		return err
 	}
+	if opt.Out != "" && opt.Qualifier != nil {
+		return fmt.Errorf("--out can not be used with --qualifier")
+	}
+	stdout := app.stdout
+	var text bytes.Buffer
+	if opt.Output != "" && opt.Output != "text" {
+		// text diffs are rendered in markdown or not printed
+		a := *app
+		a.stdout = &text
+		app = &a
+	}
 
 	newFunc, err := app.loadFunction(app.functionFilePath)
 	if err != nil {
 		return fmt.Errorf("failed to load function: %w", err)
 	}
-	fillDefaultValues(newFunc)
+	fillDefaultValues(&newFunc.Function)
 	name := *newFunc.FunctionName
+	opt.report = newDiffReport(name)
+	opt.report.header.arn = app.functionArn(ctx, name)
+	opt.report.header.qualifier = versionLatest
+	if opt.Qualifier != nil {
+		opt.report.header.qualifier = *opt.Qualifier
+	}
 
 	var remote *types.FunctionConfiguration
 	var code *types.FunctionCodeLocation
@@ -56,15 +81,17 @@ func (app *App) Diff(ctx context.Context, opt *DiffOption) error {
 	}); err != nil {
 		var nfe *types.ResourceNotFoundException
 		if errors.As(err, &nfe) {
-			log.Printf("[info] function %s is not found. lambroll deploy will create a new function.", name)
+			app.logger.Printf("[info] function %s is not found. lambroll deploy will create a new function.", name)
+			opt.report.add(driftNotFound)
 		} else {
 			return fmt.Errorf("failed to GetFunction %s: %w", name, err)
 		}
 	} else {
 		remote = res.Configuration
 		code = res.Code
+		opt.report.header.codeSize = aws.Int64(remote.CodeSize)
 		{
-			log.Println("[debug] list tags Resource", app.functionArn(ctx, name))
+			app.logger.Println("[debug] list tags Resource", app.functionArn(ctx, name))
 			res, err := app.lambda.ListTags(ctx, &lambda.ListTagsInput{
 				// Tagging operations are permitted on Lambda functions only.
 				// Tags on aliases and versions are not supported.
@@ -81,41 +108,67 @@ func (app *App) Diff(ctx context.Context, opt *DiffOption) error {
 	remoteFunc := newFunctionFrom(remote, code, tags)
 	fillDefaultValues(remoteFunc)
 
-	opts := []jsondiff.Option{}
-	if ignore := opt.Ignore; ignore != "" {
-		if p, err := gojq.Parse(ignore); err != nil {
-			return fmt.Errorf("failed to parse ignore query: %s %w", ignore, err)
-		} else {
-			opts = append(opts, jsondiff.Ignore(p))
+	if newFunc.PackageType == types.PackageTypeImage && app.pinImageDigest(ctx, newFunc) {
+		// compare the digest which the tag points to now with the deployed digest
+		if code != nil && code.ResolvedImageUri != nil && remoteFunc.Code != nil {
+			remoteFunc.Code.ImageUri = code.ResolvedImageUri
 		}
 	}
 
 	remoteJSON, _ := marshalAny(remoteFunc)
-	newJSON, _ := marshalAny(newFunc)
+	newJSON, _ := marshalAny(newFunc.Function) // without lambroll specific attributes
+	if ignore := opt.Ignore; ignore != "" {
+		p, err := gojq.Parse(ignore)
+		if err != nil {
+			return fmt.Errorf("failed to parse ignore query: %s %w", ignore, err)
+		}
+		q := jsondiff.WithUpdate(p)
+		if remoteJSON, err = jsondiff.ModifyValue(q, remoteJSON); err != nil {
+			return fmt.Errorf("failed to ignore %s: %w", ignore, err)
+		}
+		if newJSON, err = jsondiff.ModifyValue(q, newJSON); err != nil {
+			return fmt.Errorf("failed to ignore %s: %w", ignore, err)
+		}
+	}
 	remoteArn := fullQualifiedFunctionName(app.functionArn(ctx, name), opt.Qualifier)
 
 	if diff, err := jsondiff.Diff(
 		&jsondiff.Input{Name: remoteArn, X: remoteJSON},
 		&jsondiff.Input{Name: app.functionFilePath, X: newJSON},
-		opts...,
 	); err != nil {
 		return fmt.Errorf("failed to diff: %w", err)
 	} else if diff != "" {
-		fmt.Print(coloredDiff(diff))
+		fmt.Fprint(app.stdout, coloredDiff(diff))
+		// when the function is not found, the change is an add of the whole definition
+		opt.report.addChanges(diffChanges(remoteJSON, newJSON, ""))
+	}
+
+	if err := validateUpdateFunction(remote, code, &newFunc.Function); err != nil {
+		return err
 	}
 
-	if err := validateUpdateFunction(remote, code, newFunc); err != nil {
+	if err := app.diffPermissions(ctx, newFunc, opt); err != nil {
+		return err
+	}
+	if err := app.diffConcurrency(ctx, newFunc, opt); err != nil {
+		return err
+	}
+	if err := app.diffEventInvokeConfig(ctx, newFunc, opt); err != nil {
 		return err
 	}
 
-	if opt.CodeSha256 {
+	if opt.CodeSha256 && remote != nil {
 		if packageType != types.PackageTypeZip {
 			return fmt.Errorf("code-sha256 is only supported for Zip package type")
 		}
-		zipfile, _, err := prepareZipfile(opt.Src, opt.excludes, opt.KeepSymlink)
+		if err := app.prepareSources(ctx, newFunc, &opt.BuildOption); err != nil {
+			return err
+		}
+		zipfile, info, err := prepareZipfile(opt.Src, &opt.ZipOption)
 		if err != nil {
 			return err
 		}
+		opt.report.header.newCodeSize = aws.Int64(info.Size())
 		h := sha256.New()
 		if _, err := io.Copy(h, zipfile); err != nil {
 			return err
@@ -123,22 +176,78 @@ func (app *App) Diff(ctx context.Context, opt *DiffOption) error {
 		newCodeSha256 := base64.StdEncoding.EncodeToString(h.Sum(nil))
 		prefix := "CodeSha256: "
 		if ds := diff.Diff(prefix+currentCodeSha256, prefix+newCodeSha256); ds != "" {
-			fmt.Println(color.RedString("---" + app.functionArn(ctx, name)))
-			fmt.Println(color.GreenString("+++" + "--src=" + opt.Src))
-			fmt.Println(coloredDiff(ds))
+			fmt.Fprintln(app.stdout, color.RedString("---"+app.functionArn(ctx, name)))
+			fmt.Fprintln(app.stdout, color.GreenString("+++"+"--src="+opt.Src))
+			fmt.Fprintln(app.stdout, coloredDiff(ds))
+			opt.report.add(driftCode, &DiffChange{
+				Op:     "replace",
+				Path:   "/CodeSha256",
+				Remote: currentCodeSha256,
+				Local:  newCodeSha256,
+			})
 		}
 	}
 
-	if opt.FunctionURL == "" {
-		return nil
+	if opt.FunctionURL != "" {
+		if err := app.diffFunctionURL(ctx, name, opt); err != nil {
+			return err
+		}
+	}
+	if opt.EventSourceMappings != "" {
+		if err := app.diffEventSourceMappings(ctx, name, opt); err != nil {
+			return err
+		}
 	}
 
-	if err := app.diffFunctionURL(ctx, name, opt); err != nil {
-		return err
+	if opt.Out != "" {
+		if opt.EventSourceMappings != "" {
+			app.logger.Println("[warn] event source mappings are not recorded in the plan")
+		}
+		plan, err := app.newPlan(ctx, newFunc, remote, tags, opt)
+		if err != nil {
+			return fmt.Errorf("failed to create plan: %w", err)
+		}
+		if err := plan.save(opt.Out); err != nil {
+			return err
+		}
+		app.logger.Printf("[info] plan saved to %s", opt.Out)
+	}
+
+	switch opt.Output {
+	case "json":
+		if err := printDiffJSON(stdout, opt.report); err != nil {
+			return err
+		}
+	case "patch":
+		app.warnUnpatchedChanges(opt.report)
+		if err := printDiffJSON(stdout, opt.report.jsonPatch()); err != nil {
+			return err
+		}
+	case "markdown":
+		md := opt.report.markdown(text.String())
+		fmt.Fprint(stdout, md)
+		if !opt.All { // DiffAll writes the summary of all functions
+			if err := app.writeStepSummary(md); err != nil {
+				return err
+			}
+		}
+	}
+	if opt.Report != "" {
+		if err := app.saveDiffReport(opt.Report, opt.report); err != nil {
+			return err
+		}
+	}
+	if opt.ExitCode {
+		return opt.report.result()
 	}
 	return nil
 }
 
+// structuredOutput reports whether diff prints the changes as JSON instead of text diffs
+func (opt *DiffOption) structuredOutput() bool {
+	return opt.Output == "json" || opt.Output == "patch"
+}
+
 func (app *App) diffFunctionURL(ctx context.Context, name string, opt *DiffOption) error {
 	var remote, local *types.FunctionUrlConfig
 
@@ -173,7 +282,8 @@ func (app *App) diffFunctionURL(ctx context.Context, name string, opt *DiffOptio
 			return fmt.Errorf("failed to get function url config: %w", err)
 		}
 	} else {
-		log.Println("[debug] FunctionUrlConfig found")
+		app.logger.Println("[debug] FunctionUrlConfig found")
+		opt.report.header.functionURL = aws.ToString(res.FunctionUrl)
 		remote = &types.FunctionUrlConfig{
 			AuthType:   res.AuthType,
 			Cors:       res.Cors,
@@ -189,14 +299,16 @@ func (app *App) diffFunctionURL(ctx context.Context, name string, opt *DiffOptio
 	); err != nil {
 		return fmt.Errorf("failed to diff: %w", err)
 	} else if diff != "" {
-		fmt.Print(coloredDiff(diff))
+		fmt.Fprint(app.stdout, coloredDiff(diff))
+		opt.report.addChanges(diffChanges(r, l, "/FunctionURL/Config"))
 	}
 
 	// permissions
-	adds, removes, err := app.calcFunctionURLPermissionsDiff(ctx, fu)
+	exists, err := app.getFunctionURLPermissions(ctx, *fu.Config.FunctionName, fu.Config.Qualifier)
 	if err != nil {
 		return err
 	}
+	adds, removes := permissionsDiff(exists, fu.Permissions)
 	var addsB []byte
 	for _, in := range adds {
 		b, _ := marshalJSON(in)
@@ -208,9 +320,10 @@ func (app *App) diffFunctionURL(ctx context.Context, name string, opt *DiffOptio
 		removesB = append(removesB, b...)
 	}
 	if ds := diff.Diff(string(removesB), string(addsB)); ds != "" {
-		fmt.Println(color.RedString("--- permissions"))
-		fmt.Println(color.GreenString("+++ permissions"))
-		fmt.Print(coloredDiff(ds))
+		fmt.Fprintln(app.stdout, color.RedString("--- permissions"))
+		fmt.Fprintln(app.stdout, color.GreenString("+++ permissions"))
+		fmt.Fprint(app.stdout, coloredDiff(ds))
+		opt.report.add(driftConfig, permissionChanges("/FunctionURL/Permissions", exists, fu.Permissions)...)
 	}
 
 	return nil
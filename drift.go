@@ -0,0 +1,337 @@
+package lambroll
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// Exit codes of diff --exit-code
+const (
+	ExitCodeNoChanges          = 0
+	ExitCodeConfigDrift        = 2
+	ExitCodeCodeDrift          = 3
+	ExitCodeConfigAndCodeDrift = 4
+	ExitCodeFunctionNotFound   = 5
+)
+
+// drift represents kinds of changes detected by diff
+type drift int
+
+const (
+	driftConfig drift = 1 << iota
+	driftCode
+	driftNotFound
+)
+
+func (d drift) String() string {
+	switch {
+	case d&driftNotFound != 0:
+		return "not_found"
+	case d&driftConfig != 0 && d&driftCode != 0:
+		return "config_and_code"
+	case d&driftCode != 0:
+		return "code"
+	case d&driftConfig != 0:
+		return "config"
+	}
+	return "none"
+}
+
+func (d drift) exitCode() int {
+	switch {
+	case d&driftNotFound != 0:
+		return ExitCodeFunctionNotFound
+	case d&driftConfig != 0 && d&driftCode != 0:
+		return ExitCodeConfigAndCodeDrift
+	case d&driftCode != 0:
+		return ExitCodeCodeDrift
+	case d&driftConfig != 0:
+		return ExitCodeConfigDrift
+	}
+	return ExitCodeNoChanges
+}
+
+// ExitCodeError represents a result which exits with the non-zero code, but is not a failure
+type ExitCodeError struct {
+	Code    int
+	Message string
+}
+
+func (e *ExitCodeError) Error() string {
+	return fmt.Sprintf("%s (exit code %d)", e.Message, e.Code)
+}
+
+// DiffReport represents a machine-readable report of changes detected by diff
+type DiffReport struct {
+	FunctionName string        `json:"FunctionName"`
+	Drift        string        `json:"Drift"`
+	ExitCode     int           `json:"ExitCode"`
+	Paths        []string      `json:"Paths"` // JSON pointers of changed values
+	Changes      []*DiffChange `json:"Changes"`
+
+	drift  drift
+	header diffHeader
+}
+
+// DiffChange represents a changed value. Remote is the deployed value and Local is the value in the definition.
+type DiffChange struct {
+	Op     string `json:"Op"` // add, remove or replace
+	Path   string `json:"Path"`
+	Remote any    `json:"Remote,omitempty"`
+	Local  any    `json:"Local,omitempty"`
+}
+
+func newDiffReport(name string) *DiffReport {
+	return &DiffReport{FunctionName: name, Drift: drift(0).String(), Paths: []string{}, Changes: []*DiffChange{}}
+}
+
+func (r *DiffReport) add(d drift, changes ...*DiffChange) {
+	r.drift |= d
+	for _, c := range changes {
+		r.Paths = append(r.Paths, c.Path)
+		r.Changes = append(r.Changes, c)
+	}
+	r.Drift = r.drift.String()
+	r.ExitCode = r.drift.exitCode()
+}
+
+// addChanges adds changes. Changes under /Code are code drift, others are configuration drift.
+func (r *DiffReport) addChanges(changes []*DiffChange) {
+	for _, c := range changes {
+		if c.Path == "/Code" || strings.HasPrefix(c.Path, "/Code/") {
+			r.add(driftCode, c)
+		} else {
+			r.add(driftConfig, c)
+		}
+	}
+}
+
+func (r *DiffReport) result() error {
+	if r.drift == 0 {
+		return nil
+	}
+	return &ExitCodeError{
+		Code:    r.ExitCode,
+		Message: fmt.Sprintf("%s drift of function %s is detected", r.Drift, r.FunctionName),
+	}
+}
+
+// patchDocuments maps the prefix of paths to the document which the changes belong to.
+// Changes of other paths belong to the function document.
+var patchDocuments = map[string]string{
+	"/FunctionURL":         "function-url",
+	"/EventSourceMappings": "event-source-mappings",
+}
+
+// patchDocument returns the document of the change and the path in the document
+func patchDocument(path string) (string, string) {
+	for prefix, doc := range patchDocuments {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return doc, strings.TrimPrefix(path, prefix)
+		}
+	}
+	return "function", path
+}
+
+// unpatchedPrefixes are prefixes of paths which are not included in JSON Patch,
+// because they are not the values of the deployed function document.
+var unpatchedPrefixes = []string{"/CodeSha256", "/Concurrency", "/EventInvokeConfig"}
+
+func isUnpatched(path string) bool {
+	for _, prefix := range unpatchedPrefixes {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// unpatchedPaths returns paths of the changes which are not included in JSON Patch
+func (r *DiffReport) unpatchedPaths() []string {
+	if r.drift&driftNotFound != 0 {
+		return nil
+	}
+	var paths []string
+	for _, c := range r.Changes {
+		if isUnpatched(c.Path) {
+			paths = append(paths, c.Path)
+		}
+	}
+	return paths
+}
+
+// warnUnpatchedChanges warns the changes which are not included in JSON Patch
+func (app *App) warnUnpatchedChanges(r *DiffReport) {
+	if paths := r.unpatchedPaths(); len(paths) > 0 {
+		app.logger.Printf("[warn] changes of %s of function %s are not included in the patch. use --output=json to see them", strings.Join(paths, ", "), r.FunctionName)
+	}
+}
+
+// jsonPatch returns the changes as JSON Patch (RFC 6902) operations for each document,
+// which apply the definition to the deployed resources.
+// Changes of the code, concurrency and asynchronous invocation are not included.
+// When the function is not found, the patch of the function document adds the whole document.
+func (r *DiffReport) jsonPatch() map[string][]*jsonPatchOperation {
+	patches := make(map[string][]*jsonPatchOperation)
+	var created any
+	for _, c := range r.Changes {
+		doc, path := patchDocument(c.Path)
+		if doc == "function" && r.drift&driftNotFound != 0 {
+			if c.Op != "remove" {
+				created = setJSONPointer(created, path, c.Local)
+			}
+			continue
+		}
+		if isUnpatched(c.Path) {
+			continue
+		}
+		op := &jsonPatchOperation{Op: c.Op, Path: path}
+		if c.Op != "remove" {
+			op.Value, _ = json.Marshal(c.Local)
+		}
+		patches[doc] = append(patches[doc], op)
+	}
+	if r.drift&driftNotFound != 0 {
+		op := &jsonPatchOperation{Op: "add", Path: ""}
+		op.Value, _ = json.Marshal(created)
+		patches["function"] = []*jsonPatchOperation{op}
+	}
+	return patches
+}
+
+// setJSONPointer sets v at the path (JSON pointer) of doc. Intermediate objects are created.
+func setJSONPointer(doc any, path string, v any) any {
+	if path == "" {
+		return v
+	}
+	m, ok := doc.(map[string]any)
+	if !ok {
+		m = make(map[string]any)
+	}
+	key, rest, found := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	key = unescapeJSONPointer(key)
+	if !found {
+		m[key] = v
+	} else {
+		m[key] = setJSONPointer(m[key], "/"+rest, v)
+	}
+	return m
+}
+
+type jsonPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+func (app *App) saveDiffReport(path string, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal diff report: %w", err)
+	}
+	app.logger.Printf("[info] writing diff report to %s", path)
+	if err := os.WriteFile(path, append(b, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write diff report %s: %w", path, err)
+	}
+	return nil
+}
+
+func printDiffJSON(w io.Writer, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal diff: %w", err)
+	}
+	_, err = fmt.Fprintln(w, string(b))
+	return err
+}
+
+// diffChanges returns changes from x to y. Paths are JSON pointers (RFC 6901).
+// Arrays are compared as a whole.
+func diffChanges(x, y any, prefix string) []*DiffChange {
+	xm, xok := x.(map[string]any)
+	ym, yok := y.(map[string]any)
+	if !xok || !yok {
+		switch {
+		case reflect.DeepEqual(x, y):
+			return nil
+		case x == nil:
+			return []*DiffChange{{Op: "add", Path: prefix, Local: y}}
+		case y == nil:
+			return []*DiffChange{{Op: "remove", Path: prefix, Remote: x}}
+		}
+		return []*DiffChange{{Op: "replace", Path: prefix, Remote: x, Local: y}}
+	}
+	keys := make([]string, 0, len(xm)+len(ym))
+	for k := range xm {
+		keys = append(keys, k)
+	}
+	for k := range ym {
+		if _, ok := xm[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var changes []*DiffChange
+	for _, k := range keys {
+		path := prefix + "/" + escapeJSONPointer(k)
+		xv, xok := xm[k]
+		yv, yok := ym[k]
+		switch {
+		case !xok:
+			changes = append(changes, &DiffChange{Op: "add", Path: path, Local: yv})
+		case !yok:
+			changes = append(changes, &DiffChange{Op: "remove", Path: path, Remote: xv})
+		default:
+			changes = append(changes, diffChanges(xv, yv, path)...)
+		}
+	}
+	return changes
+}
+
+// permissionChanges returns changes from the deployed permissions to the permissions in the definition.
+// Paths are indexes of the arrays. Removed permissions are in descending order of the index of remotes
+// and added permissions are in ascending order of the index of locals, so that they can be applied in order.
+func permissionChanges(prefix string, remotes, locals Permissions) []*DiffChange {
+	removeSids, addSids := lo.Difference(remotes.Sids(), locals.Sids())
+	if len(removeSids) == 0 && len(addSids) == 0 {
+		return nil
+	}
+	if len(remotes) == 0 {
+		vs := make([]any, 0, len(locals))
+		for _, p := range locals {
+			v, _ := marshalAny(p)
+			vs = append(vs, v)
+		}
+		return []*DiffChange{{Op: "add", Path: prefix, Local: vs}}
+	}
+	var changes []*DiffChange
+	for i := len(remotes) - 1; i >= 0; i-- {
+		if p := remotes[i]; lo.Contains(removeSids, p.Sid()) {
+			v, _ := marshalAny(p)
+			changes = append(changes, &DiffChange{Op: "remove", Path: prefix + "/" + strconv.Itoa(i), Remote: v})
+		}
+	}
+	for i, p := range locals {
+		if lo.Contains(addSids, p.Sid()) {
+			v, _ := marshalAny(p)
+			changes = append(changes, &DiffChange{Op: "add", Path: prefix + "/" + strconv.Itoa(i), Local: v})
+		}
+	}
+	return changes
+}
+
+func escapeJSONPointer(s string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(s)
+}
+
+func unescapeJSONPointer(s string) string {
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(s)
+}
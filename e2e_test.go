@@ -0,0 +1,1555 @@
+package lambroll_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/fujiwara/lambroll"
+	"github.com/fujiwara/lambroll/lambrolltest"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func newFakeApp(t *testing.T) (*lambroll.App, *lambrolltest.FakeLambda) {
+	t.Helper()
+	fake := lambrolltest.NewFakeLambda()
+	app, err := lambrolltest.NewApp(context.Background(), &lambroll.Option{
+		Function: "test/fake/function.json",
+	}, fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return app, fake
+}
+
+func newDeployOption() *lambroll.DeployOption {
+	return &lambroll.DeployOption{
+		Src:       "test/src",
+		Publish:   true,
+		AliasName: "current",
+		BuildOption: lambroll.BuildOption{
+			ZipOption: lambroll.ZipOption{
+				ExcludeFile: "test/src/.lambdaignore",
+			},
+		},
+	}
+}
+
+func testAliasVersion(t *testing.T, fake *lambrolltest.FakeLambda, alias, expected string) {
+	t.Helper()
+	res, err := fake.GetAlias(context.Background(), &lambda.GetAliasInput{
+		FunctionName: aws.String("fake-test"),
+		Name:         aws.String(alias),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := aws.ToString(res.FunctionVersion); v != expected {
+		t.Errorf("unexpected version of alias %s: got %s, expected %s", alias, v, expected)
+	}
+}
+
+func TestDeployAndRollbackWithFake(t *testing.T) {
+	ctx := context.Background()
+	app, fake := newFakeApp(t)
+
+	for _, desc := range []string{"v1", "v2"} {
+		t.Setenv("DESCRIPTION", desc)
+		if err := app.Deploy(ctx, newDeployOption()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testAliasVersion(t, fake, "current", "2")
+
+	res, err := fake.GetFunction(ctx, &lambda.GetFunctionInput{FunctionName: aws.String("fake-test")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := aws.ToString(res.Configuration.Description); d != "v2" {
+		t.Errorf("unexpected description %s", d)
+	}
+	if res.Tags["Env"] != "test" {
+		t.Errorf("unexpected tags %v", res.Tags)
+	}
+
+	if err := app.Rollback(ctx, &lambroll.RollbackOption{Alias: "current"}); err != nil {
+		t.Fatal(err)
+	}
+	testAliasVersion(t, fake, "current", "1")
+
+	if err := app.Versions(ctx, &lambroll.VersionsOption{Output: "json"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeployAliasRoutingWithFake(t *testing.T) {
+	ctx := context.Background()
+	app, fake := newFakeApp(t)
+
+	opt := newDeployOption()
+	opt.Publish = false
+	opt.CanaryWeight = 10
+	if err := app.Deploy(ctx, opt); err == nil {
+		t.Error("--canary-weight without --publish should fail")
+	}
+
+	for _, desc := range []string{"v1", "v2"} {
+		t.Setenv("DESCRIPTION", desc)
+		if err := app.Deploy(ctx, newDeployOption()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// an unfinished canary deployment routes 10% of traffic to version 2
+	if _, err := fake.UpdateAlias(ctx, &lambda.UpdateAliasInput{
+		FunctionName:    aws.String("fake-test"),
+		Name:            aws.String("current"),
+		FunctionVersion: aws.String("1"),
+		RoutingConfig: &types.AliasRoutingConfiguration{
+			AdditionalVersionWeights: map[string]float64{"2": 0.1},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("DESCRIPTION", "v3")
+	if err := app.Deploy(ctx, newDeployOption()); err == nil {
+		t.Error("deploy should fail when the alias has weighted routing")
+	}
+	testAliasVersion(t, fake, "current", "1")
+
+	opt = newDeployOption()
+	opt.ResetRouting = true
+	if err := app.Deploy(ctx, opt); err != nil {
+		t.Fatal(err)
+	}
+	testAliasVersion(t, fake, "current", "3")
+	res, err := fake.GetAlias(ctx, &lambda.GetAliasInput{
+		FunctionName: aws.String("fake-test"),
+		Name:         aws.String("current"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RoutingConfig != nil {
+		t.Errorf("weighted routing should be reset: %v", res.RoutingConfig.AdditionalVersionWeights)
+	}
+}
+
+// alarmingLambda puts the alarm in ALARM state when the alias starts weighted routing
+type alarmingLambda struct {
+	*lambrolltest.FakeLambda
+	cw    *lambrolltest.FakeCloudWatch
+	alarm string
+}
+
+func (a *alarmingLambda) UpdateAlias(ctx context.Context, in *lambda.UpdateAliasInput, opts ...func(*lambda.Options)) (*lambda.UpdateAliasOutput, error) {
+	out, err := a.FakeLambda.UpdateAlias(ctx, in, opts...)
+	if err == nil && in.RoutingConfig != nil && len(in.RoutingConfig.AdditionalVersionWeights) > 0 {
+		a.cw.SetAlarmState(a.alarm, cwtypes.StateValueAlarm)
+	}
+	return out, err
+}
+
+func TestDeployCanaryWithFake(t *testing.T) {
+	ctx := context.Background()
+	app, fake := newFakeApp(t)
+	cw := lambrolltest.NewFakeCloudWatch()
+	cw.SetAlarmState("fake-errors", cwtypes.StateValueOk)
+	app.SetCloudWatchAPI(cw)
+
+	t.Setenv("DESCRIPTION", "v1")
+	if err := app.Deploy(ctx, newDeployOption()); err != nil {
+		t.Fatal(err)
+	}
+	canaryOption := func() *lambroll.DeployOption {
+		opt := newDeployOption()
+		opt.CanaryWeight = 10
+		opt.CanarySteps = []int{50}
+		opt.CanaryInterval = 10 * time.Millisecond
+		opt.Alarms = []string{"fake-errors"}
+		return opt
+	}
+
+	// the alarm stays OK. the alias points to the new version finally
+	t.Setenv("DESCRIPTION", "v2")
+	if err := app.Deploy(ctx, canaryOption()); err != nil {
+		t.Fatal(err)
+	}
+	testAliasVersion(t, fake, "current", "2")
+
+	// the alarm goes to ALARM while routing traffic to the new version
+	app.SetLambdaAPI(&alarmingLambda{FakeLambda: fake, cw: cw, alarm: "fake-errors"})
+	t.Setenv("DESCRIPTION", "v3")
+	err := app.Deploy(ctx, canaryOption())
+	if err == nil {
+		t.Fatal("canary deployment should fail when the alarm goes to ALARM state")
+	}
+	if !strings.Contains(err.Error(), "rolled back") {
+		t.Errorf("unexpected error %s", err)
+	}
+	testAliasVersion(t, fake, "current", "2")
+	res, err := fake.GetAlias(ctx, &lambda.GetAliasInput{
+		FunctionName: aws.String("fake-test"),
+		Name:         aws.String("current"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RoutingConfig != nil {
+		t.Errorf("weighted routing should be reset by rollback: %v", res.RoutingConfig.AdditionalVersionWeights)
+	}
+
+	// the alarm is still in ALARM state. canary deployment does not start
+	t.Setenv("DESCRIPTION", "v4")
+	if err := app.Deploy(ctx, canaryOption()); err == nil {
+		t.Error("canary deployment should not start while the alarm is in ALARM state")
+	}
+	testAliasVersion(t, fake, "current", "2")
+}
+
+func TestDeployFunctionURLWithFake(t *testing.T) {
+	ctx := context.Background()
+	app, fake := newFakeApp(t)
+
+	opt := newDeployOption()
+	opt.FunctionURL = "test/fake/function_url.json"
+	for i := 0; i < 2; i++ {
+		if err := app.Deploy(ctx, opt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err := fake.GetFunctionUrlConfig(ctx, &lambda.GetFunctionUrlConfigInput{
+		FunctionName: aws.String("fake-test"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.AuthType != "NONE" {
+		t.Errorf("unexpected auth type %s", res.AuthType)
+	}
+
+	policy, err := fake.GetPolicy(ctx, &lambda.GetPolicyInput{
+		FunctionName: aws.String("fake-test"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var po lambroll.PolicyOutput
+	if err := json.Unmarshal([]byte(*policy.Policy), &po); err != nil {
+		t.Fatal(err)
+	}
+	if len(po.Statement) != 1 {
+		t.Errorf("unexpected statements %#v", po.Statement)
+	}
+	if p := po.Statement[0].PrincipalString(); aws.ToString(p) != "*" {
+		t.Errorf("unexpected principal %v", p)
+	}
+}
+
+// esmCountingLambda counts API calls which modify event source mappings
+type esmCountingLambda struct {
+	*lambrolltest.FakeLambda
+	calls int
+}
+
+func (c *esmCountingLambda) CreateEventSourceMapping(ctx context.Context, in *lambda.CreateEventSourceMappingInput, opts ...func(*lambda.Options)) (*lambda.CreateEventSourceMappingOutput, error) {
+	c.calls++
+	return c.FakeLambda.CreateEventSourceMapping(ctx, in, opts...)
+}
+
+func (c *esmCountingLambda) UpdateEventSourceMapping(ctx context.Context, in *lambda.UpdateEventSourceMappingInput, opts ...func(*lambda.Options)) (*lambda.UpdateEventSourceMappingOutput, error) {
+	c.calls++
+	return c.FakeLambda.UpdateEventSourceMapping(ctx, in, opts...)
+}
+
+func (c *esmCountingLambda) DeleteEventSourceMapping(ctx context.Context, in *lambda.DeleteEventSourceMappingInput, opts ...func(*lambda.Options)) (*lambda.DeleteEventSourceMappingOutput, error) {
+	c.calls++
+	return c.FakeLambda.DeleteEventSourceMapping(ctx, in, opts...)
+}
+
+func TestDeployEventSourceMappingsWithFake(t *testing.T) {
+	ctx := context.Background()
+	app, fake := newFakeApp(t)
+
+	opt := newDeployOption()
+	opt.EventSourceMappings = "test/fake/event_source_mappings.json"
+	if err := app.Deploy(ctx, opt); err != nil {
+		t.Fatal(err)
+	}
+	// the second deploy does not modify mappings
+	counter := &esmCountingLambda{FakeLambda: fake}
+	app.SetLambdaAPI(counter)
+	if err := app.Deploy(ctx, opt); err != nil {
+		t.Fatal(err)
+	}
+	if counter.calls != 0 {
+		t.Errorf("event source mappings should not be modified by the second deploy: %d calls", counter.calls)
+	}
+	app.SetLambdaAPI(fake)
+	listMappings := func(name string) []types.EventSourceMappingConfiguration {
+		t.Helper()
+		res, err := fake.ListEventSourceMappings(ctx, &lambda.ListEventSourceMappingsInput{
+			FunctionName: aws.String(name),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.EventSourceMappings
+	}
+	sqs := listMappings("fake-test:current")
+	if len(sqs) != 1 {
+		t.Fatalf("unexpected mappings of alias %#v", sqs)
+	}
+	if ms := listMappings("fake-test"); len(ms) != 1 || aws.ToInt32(ms[0].BatchSize) != 100 {
+		t.Fatalf("unexpected mappings of function %#v", ms)
+	}
+
+	// StartingPosition can not be updated. deploy fails without changing any mappings
+	opt.EventSourceMappings = "test/fake/event_source_mappings_immutable.json"
+	err := app.Deploy(ctx, opt)
+	if err == nil || !strings.Contains(err.Error(), "StartingPosition") {
+		t.Errorf("deploy should fail by the change of StartingPosition: %v", err)
+	}
+	if ms := listMappings("fake-test"); len(ms) != 1 || aws.ToInt32(ms[0].BatchSize) != 100 || ms[0].StartingPosition != types.EventSourcePositionLatest {
+		t.Errorf("mapping should not be changed %#v", ms)
+	}
+
+	opt.EventSourceMappings = "test/fake/event_source_mappings_updated.json"
+	if err := app.Deploy(ctx, opt); err != nil {
+		t.Fatal(err)
+	}
+	if ms := listMappings("fake-test"); len(ms) != 0 {
+		t.Errorf("mappings of function should be deleted %#v", ms)
+	}
+	updated := listMappings("fake-test:current")
+	if len(updated) != 1 {
+		t.Fatalf("unexpected mappings of alias %#v", updated)
+	}
+	if aws.ToString(updated[0].UUID) != aws.ToString(sqs[0].UUID) {
+		t.Errorf("mapping should be updated in place: %s -> %s", aws.ToString(sqs[0].UUID), aws.ToString(updated[0].UUID))
+	}
+	if aws.ToInt32(updated[0].BatchSize) != 5 || aws.ToString(updated[0].State) != "Disabled" {
+		t.Errorf("unexpected mapping %#v", updated[0])
+	}
+}
+
+func TestDeployPermissionsWithFake(t *testing.T) {
+	ctx := context.Background()
+	fake := lambrolltest.NewFakeLambda()
+	app, err := lambrolltest.NewApp(ctx, &lambroll.Option{
+		Function: "test/fake/function_permissions.json",
+	}, fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements := func(qualifier *string) []lambroll.PolicyStatement {
+		t.Helper()
+		res, err := fake.GetPolicy(ctx, &lambda.GetPolicyInput{
+			FunctionName: aws.String("fake-test"),
+			Qualifier:    qualifier,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var po lambroll.PolicyOutput
+		if err := json.Unmarshal([]byte(*res.Policy), &po); err != nil {
+			t.Fatal(err)
+		}
+		return po.Statement
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := app.Deploy(ctx, newDeployOption()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sts := statements(nil)
+	if len(sts) != 1 {
+		t.Fatalf("unexpected statements %#v", sts)
+	}
+	if sa := sts[0].SourceArn(); aws.ToString(sa) != "arn:aws:s3:::bucket-a" {
+		t.Errorf("unexpected source arn %v", sa)
+	}
+	if sts := statements(aws.String("current")); len(sts) != 1 || aws.ToString(sts[0].PrincipalString()) != "events.amazonaws.com" {
+		t.Errorf("unexpected statements of alias %#v", sts)
+	}
+
+	t.Setenv("SOURCE_BUCKET", "bucket-b")
+	if err := app.Deploy(ctx, newDeployOption()); err != nil {
+		t.Fatal(err)
+	}
+	updated := statements(nil)
+	if len(updated) != 1 {
+		t.Fatalf("unexpected statements %#v", updated)
+	}
+	if sa := updated[0].SourceArn(); aws.ToString(sa) != "arn:aws:s3:::bucket-b" {
+		t.Errorf("unexpected source arn %v", sa)
+	}
+	if updated[0].Sid == sts[0].Sid {
+		t.Errorf("sid should be changed %s", updated[0].Sid)
+	}
+}
+
+// permissionCountingLambda counts the calls of AddPermission and RemovePermission
+type permissionCountingLambda struct {
+	*lambrolltest.FakeLambda
+	added, removed int
+}
+
+func (p *permissionCountingLambda) AddPermission(ctx context.Context, in *lambda.AddPermissionInput, opts ...func(*lambda.Options)) (*lambda.AddPermissionOutput, error) {
+	p.added++
+	return p.FakeLambda.AddPermission(ctx, in, opts...)
+}
+
+func (p *permissionCountingLambda) RemovePermission(ctx context.Context, in *lambda.RemovePermissionInput, opts ...func(*lambda.Options)) (*lambda.RemovePermissionOutput, error) {
+	p.removed++
+	return p.FakeLambda.RemovePermission(ctx, in, opts...)
+}
+
+func TestDeployPermissionsActionWithFake(t *testing.T) {
+	ctx := context.Background()
+	fake := lambrolltest.NewFakeLambda()
+	app, err := lambrolltest.NewApp(ctx, &lambroll.Option{
+		Function: "test/fake/function_permissions_action.json",
+	}, fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &permissionCountingLambda{FakeLambda: fake}
+	app.SetLambdaAPI(p)
+	if err := app.Deploy(ctx, newDeployOption()); err != nil {
+		t.Fatal(err)
+	}
+	if p.added != 2 || p.removed != 0 {
+		t.Errorf("unexpected calls added:%d removed:%d", p.added, p.removed)
+	}
+	// a permission of the function URL is not managed by Permissions
+	if _, err := fake.AddPermission(ctx, &lambda.AddPermissionInput{
+		FunctionName:        aws.String("fake-test"),
+		StatementId:         aws.String("lambroll-0123456789abcdef"),
+		Action:              aws.String("lambda:InvokeFunctionUrl"),
+		Principal:           aws.String("*"),
+		FunctionUrlAuthType: types.FunctionUrlAuthTypeNone,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// permissions of actions other than lambda:InvokeFunction are not added again
+	p.added, p.removed = 0, 0
+	if err := app.Deploy(ctx, newDeployOption()); err != nil {
+		t.Fatal(err)
+	}
+	if p.added != 0 || p.removed != 0 {
+		t.Errorf("unexpected calls added:%d removed:%d", p.added, p.removed)
+	}
+	res, err := fake.GetPolicy(ctx, &lambda.GetPolicyInput{FunctionName: aws.String("fake-test")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var po lambroll.PolicyOutput
+	if err := json.Unmarshal([]byte(*res.Policy), &po); err != nil {
+		t.Fatal(err)
+	}
+	actions := make([]string, 0, len(po.Statement))
+	for _, st := range po.Statement {
+		actions = append(actions, st.Action)
+	}
+	sort.Strings(actions)
+	if diff := cmp.Diff([]string{"lambda:GetFunction", "lambda:InvokeFunction", "lambda:InvokeFunctionUrl"}, actions); diff != "" {
+		t.Errorf("unexpected statements %s", diff)
+	}
+}
+
+func TestDeployPlanWithFake(t *testing.T) {
+	ctx := context.Background()
+	app, fake := newFakeApp(t)
+
+	t.Setenv("DESCRIPTION", "v1")
+	if err := app.Deploy(ctx, newDeployOption()); err != nil {
+		t.Fatal(err)
+	}
+
+	planFile := filepath.Join(t.TempDir(), "plan.json")
+	t.Setenv("DESCRIPTION", "v2")
+	if err := app.Diff(ctx, &lambroll.DiffOption{
+		Src: "test/src",
+		Out: planFile,
+		BuildOption: lambroll.BuildOption{
+			ZipOption: lambroll.ZipOption{
+				ExcludeFile: "test/src/.lambdaignore",
+			},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the plan is applied regardless of the current function.json
+	t.Setenv("DESCRIPTION", "v3")
+	opt := newDeployOption()
+	opt.Plan = planFile
+	if err := app.Deploy(ctx, opt); err != nil {
+		t.Fatal(err)
+	}
+	res, err := fake.GetFunction(ctx, &lambda.GetFunctionInput{FunctionName: aws.String("fake-test")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := aws.ToString(res.Configuration.Description); d != "v2" {
+		t.Errorf("unexpected description %s", d)
+	}
+	testAliasVersion(t, fake, "current", "2")
+
+	// the remote function has been changed since the plan was made
+	opt = newDeployOption()
+	opt.Plan = planFile
+	if err := app.Deploy(ctx, opt); err == nil {
+		t.Error("deploy with the stale plan should fail")
+	} else if !strings.Contains(err.Error(), "drifted") {
+		t.Errorf("unexpected error %s", err)
+	}
+}
+
+func TestDeployPlanReproducibleWithFake(t *testing.T) {
+	ctx := context.Background()
+	app, fake := newFakeApp(t)
+
+	src := t.TempDir()
+	index := filepath.Join(src, "index.js")
+	if err := os.WriteFile(index, []byte("exports.handler = async () => 'v1';\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	planFile := filepath.Join(t.TempDir(), "plan.json")
+	if err := app.Diff(ctx, &lambroll.DiffOption{Src: src, Out: planFile}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the sources are checked out again (e.g. by another CI job). the modification times differ
+	mtime := time.Now().Add(time.Hour)
+	if err := os.Chtimes(index, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	opt := newDeployOption()
+	opt.Plan = planFile
+	opt.EventSourceMappings = "test/fake/event_source_mappings.json"
+	if err := app.Deploy(ctx, opt); err == nil {
+		t.Error("--event-source-mappings with --plan should fail")
+	}
+	opt.EventSourceMappings = ""
+	if err := app.Deploy(ctx, opt); err != nil {
+		t.Fatal(err)
+	}
+	testAliasVersion(t, fake, "current", "1")
+
+	// the sources are changed after the plan was made
+	planFile = filepath.Join(t.TempDir(), "plan.json")
+	if err := app.Diff(ctx, &lambroll.DiffOption{Src: src, Out: planFile}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(index, []byte("exports.handler = async () => 'v2';\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opt = newDeployOption()
+	opt.Plan = planFile
+	if err := app.Deploy(ctx, opt); err == nil {
+		t.Error("deploy should fail when the sources are changed after the plan was made")
+	} else if !strings.Contains(err.Error(), "CodeSha256 of the zip archive") {
+		t.Errorf("unexpected error %s", err)
+	}
+}
+
+// racingLambda simulates another deployment which updates the function right after the first GetFunction
+type racingLambda struct {
+	*lambrolltest.FakeLambda
+	raced bool
+}
+
+func (r *racingLambda) GetFunction(ctx context.Context, in *lambda.GetFunctionInput, opts ...func(*lambda.Options)) (*lambda.GetFunctionOutput, error) {
+	out, err := r.FakeLambda.GetFunction(ctx, in, opts...)
+	if err != nil || r.raced {
+		return out, err
+	}
+	r.raced = true
+	if _, err := r.FakeLambda.UpdateFunctionConfiguration(ctx, &lambda.UpdateFunctionConfigurationInput{
+		FunctionName: in.FunctionName,
+		Description:  aws.String("other"),
+	}); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func TestDeployRevisionConflictWithFake(t *testing.T) {
+	ctx := context.Background()
+	app, fake := newFakeApp(t)
+	t.Setenv("DESCRIPTION", "v1")
+	if err := app.Deploy(ctx, newDeployOption()); err != nil {
+		t.Fatal(err)
+	}
+
+	app.SetLambdaAPI(&racingLambda{FakeLambda: fake})
+	t.Setenv("DESCRIPTION", "v2")
+	err := app.Deploy(ctx, newDeployOption())
+	if err == nil {
+		t.Fatal("deploy should fail when the function is modified by others")
+	}
+	var pfe *types.PreconditionFailedException
+	if !errors.As(err, &pfe) {
+		t.Errorf("unexpected error %s", err)
+	}
+	if !strings.Contains(err.Error(), "modified by others") {
+		t.Errorf("unexpected error message %s", err)
+	}
+	res, err := fake.GetFunction(ctx, &lambda.GetFunctionInput{FunctionName: aws.String("fake-test")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := aws.ToString(res.Configuration.Description); d != "other" {
+		t.Errorf("the change by others was overwritten: %s", d)
+	}
+	testAliasVersion(t, fake, "current", "1")
+}
+
+// lateRacingLambda simulates another deployment which updates the function right after UpdateFunctionConfiguration
+type lateRacingLambda struct {
+	*lambrolltest.FakeLambda
+	raced bool
+}
+
+func (r *lateRacingLambda) UpdateFunctionConfiguration(ctx context.Context, in *lambda.UpdateFunctionConfigurationInput, opts ...func(*lambda.Options)) (*lambda.UpdateFunctionConfigurationOutput, error) {
+	out, err := r.FakeLambda.UpdateFunctionConfiguration(ctx, in, opts...)
+	if err != nil || r.raced {
+		return out, err
+	}
+	r.raced = true
+	if _, err := r.FakeLambda.UpdateFunctionConfiguration(ctx, &lambda.UpdateFunctionConfigurationInput{
+		FunctionName: in.FunctionName,
+		Description:  aws.String("other"),
+	}); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func TestDeployRevisionConflictAfterConfigurationUpdateWithFake(t *testing.T) {
+	ctx := context.Background()
+	app, fake := newFakeApp(t)
+	t.Setenv("DESCRIPTION", "v1")
+	if err := app.Deploy(ctx, newDeployOption()); err != nil {
+		t.Fatal(err)
+	}
+
+	app.SetLambdaAPI(&lateRacingLambda{FakeLambda: fake})
+	t.Setenv("DESCRIPTION", "v2")
+	err := app.Deploy(ctx, newDeployOption())
+	if err == nil {
+		t.Fatal("deploy should fail when the function is modified by others after the configuration update")
+	}
+	if !strings.Contains(err.Error(), "modified by others") {
+		t.Errorf("unexpected error message %s", err)
+	}
+	testAliasVersion(t, fake, "current", "1")
+}
+
+// busyLambda simulates another update in progress. The first UpdateFunctionConfiguration fails with ResourceConflictException
+type busyLambda struct {
+	*lambrolltest.FakeLambda
+	busy bool
+}
+
+func (b *busyLambda) UpdateFunctionConfiguration(ctx context.Context, in *lambda.UpdateFunctionConfigurationInput, opts ...func(*lambda.Options)) (*lambda.UpdateFunctionConfigurationOutput, error) {
+	if !b.busy {
+		b.busy = true
+		return nil, &types.ResourceConflictException{Message: aws.String("An update is in progress")}
+	}
+	return b.FakeLambda.UpdateFunctionConfiguration(ctx, in, opts...)
+}
+
+func TestDeployLockRevisionWithFake(t *testing.T) {
+	ctx := context.Background()
+	app, fake := newFakeApp(t)
+	t.Setenv("DESCRIPTION", "v1")
+	if err := app.Deploy(ctx, newDeployOption()); err != nil {
+		t.Fatal(err)
+	}
+
+	// ResourceConflictException is retried without --lock-revision
+	app.SetLambdaAPI(&busyLambda{FakeLambda: fake})
+	t.Setenv("DESCRIPTION", "v2")
+	if err := app.Deploy(ctx, newDeployOption()); err != nil {
+		t.Fatal(err)
+	}
+	testAliasVersion(t, fake, "current", "2")
+
+	// --lock-revision fails fast on ResourceConflictException
+	app.SetLambdaAPI(&busyLambda{FakeLambda: fake})
+	t.Setenv("DESCRIPTION", "v3")
+	opt := newDeployOption()
+	opt.LockRevision = true
+	err := app.Deploy(ctx, opt)
+	if err == nil {
+		t.Fatal("deploy should fail fast on ResourceConflictException with --lock-revision")
+	}
+	if !strings.Contains(err.Error(), "modified by others") {
+		t.Errorf("unexpected error message %s", err)
+	}
+	testAliasVersion(t, fake, "current", "2")
+}
+
+// publishCountingLambda counts the calls of PublishVersion
+type publishCountingLambda struct {
+	*lambrolltest.FakeLambda
+	published int
+}
+
+func (p *publishCountingLambda) PublishVersion(ctx context.Context, in *lambda.PublishVersionInput, opts ...func(*lambda.Options)) (*lambda.PublishVersionOutput, error) {
+	p.published++
+	return p.FakeLambda.PublishVersion(ctx, in, opts...)
+}
+
+func TestDeployUnchangedWithFake(t *testing.T) {
+	ctx := context.Background()
+	app, fake := newFakeApp(t)
+	t.Setenv("DESCRIPTION", "v1")
+	if err := app.Deploy(ctx, newDeployOption()); err != nil {
+		t.Fatal(err)
+	}
+	res, err := fake.GetFunction(ctx, &lambda.GetFunctionInput{FunctionName: aws.String("fake-test")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	revisionId := aws.ToString(res.Configuration.RevisionId)
+
+	// the code and the configuration are not changed. the update is skipped and the version of the alias is reused
+	p := &publishCountingLambda{FakeLambda: fake}
+	app.SetLambdaAPI(p)
+	if err := app.Deploy(ctx, newDeployOption()); err != nil {
+		t.Fatal(err)
+	}
+	res, err = fake.GetFunction(ctx, &lambda.GetFunctionInput{FunctionName: aws.String("fake-test")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := aws.ToString(res.Configuration.RevisionId); r != revisionId {
+		t.Errorf("the function was updated: RevisionId %s != %s", r, revisionId)
+	}
+	if p.published != 0 {
+		t.Errorf("PublishVersion should not be called for the unchanged function: %d", p.published)
+	}
+	testAliasVersion(t, fake, "current", "1")
+
+	// the alias points to another version. the latest published version is reused
+	if _, err := fake.UpdateAlias(ctx, &lambda.UpdateAliasInput{
+		FunctionName:    aws.String("fake-test"),
+		Name:            aws.String("current"),
+		FunctionVersion: aws.String("$LATEST"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Deploy(ctx, newDeployOption()); err != nil {
+		t.Fatal(err)
+	}
+	if p.published != 0 {
+		t.Errorf("PublishVersion should not be called for the unchanged function: %d", p.published)
+	}
+	testAliasVersion(t, fake, "current", "1")
+
+	// the configuration is changed
+	t.Setenv("DESCRIPTION", "v2")
+	if err := app.Deploy(ctx, newDeployOption()); err != nil {
+		t.Fatal(err)
+	}
+	testAliasVersion(t, fake, "current", "2")
+}
+
+func TestLayerWithFake(t *testing.T) {
+	ctx := context.Background()
+	fake := lambrolltest.NewFakeLambda()
+	app, err := lambrolltest.NewApp(ctx, &lambroll.Option{
+		Function: "test/fake/function_layer.json",
+	}, fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt := func(action string) *lambroll.LayerOption {
+		return &lambroll.LayerOption{
+			Action: action,
+			Layer:  "test/fake/layer.json",
+			Src:    "test/src",
+			Output: "json",
+			Force:  true,
+			ZipOption: lambroll.ZipOption{
+				ExcludeFile: "test/src/.lambdaignore",
+			},
+		}
+	}
+	latest := func() int64 {
+		t.Helper()
+		res, err := fake.ListLayerVersions(ctx, &lambda.ListLayerVersionsInput{LayerName: aws.String("fake-layer")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.LayerVersions) == 0 {
+			return 0
+		}
+		return res.LayerVersions[0].Version
+	}
+
+	// the second publish is skipped because the layer is not changed
+	for i := 0; i < 2; i++ {
+		if err := app.Layer(ctx, opt("publish")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if v := latest(); v != 1 {
+		t.Errorf("unexpected latest version %d", v)
+	}
+	t.Setenv("LAYER_DESCRIPTION", "updated")
+	if err := app.Layer(ctx, opt("publish")); err != nil {
+		t.Fatal(err)
+	}
+	if v := latest(); v != 2 {
+		t.Errorf("unexpected latest version %d", v)
+	}
+	for _, action := range []string{"versions", "diff"} {
+		if err := app.Layer(ctx, opt(action)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the latest version of the layer is resolved in the function definition
+	fn, err := app.LoadFunction("test/fake/function_layer.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if arn := "arn:aws:lambda:ap-northeast-1:123456789012:layer:fake-layer:2"; len(fn.Layers) != 1 || fn.Layers[0] != arn {
+		t.Errorf("unexpected layers %v", fn.Layers)
+	}
+
+	del := opt("delete")
+	del.KeepVersions = 1
+	if err := app.Layer(ctx, del); err != nil {
+		t.Fatal(err)
+	}
+	res, err := fake.ListLayerVersions(ctx, &lambda.ListLayerVersionsInput{LayerName: aws.String("fake-layer")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.LayerVersions) != 1 || res.LayerVersions[0].Version != 2 {
+		t.Errorf("unexpected layer versions %#v", res.LayerVersions)
+	}
+}
+
+func newTestRegistry(t *testing.T) string {
+	t.Helper()
+	s := httptest.NewServer(registry.New())
+	t.Cleanup(s.Close)
+	host := strings.TrimPrefix(s.URL, "http://")
+	t.Setenv("REGISTRY", host)
+	return host
+}
+
+func pushRandomImage(t *testing.T, uri string) string {
+	t.Helper()
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ref.Context().Digest(digest.String()).String()
+}
+
+func TestDeployImageWithFake(t *testing.T) {
+	ctx := context.Background()
+	host := newTestRegistry(t)
+	pushRandomImage(t, host+"/base:latest")
+
+	fake := lambrolltest.NewFakeLambda()
+	app, err := lambrolltest.NewApp(ctx, &lambroll.Option{
+		Function: "test/fake/function_image.json",
+	}, fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Deploy(ctx, newDeployOption()); err != nil {
+		t.Fatal(err)
+	}
+	res, err := fake.GetFunction(ctx, &lambda.GetFunctionInput{FunctionName: aws.String("fake-image")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri := aws.ToString(res.Code.ImageUri)
+	if !strings.HasPrefix(uri, host+"/fake-image@sha256:") {
+		t.Fatalf("ImageUri is not pinned to the digest %s", uri)
+	}
+
+	ref, err := name.ParseReference(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := remote.Image(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layers) != 2 {
+		t.Errorf("unexpected layers %d", len(layers))
+	}
+	tr := tar.NewReader(mutate.Extract(img))
+	var found bool
+	for {
+		h, err := tr.Next()
+		if err != nil {
+			break
+		}
+		if h.Name == "var/task/index.js" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("index.js is not found in /var/task")
+	}
+}
+
+func TestPinImageDigestWithFake(t *testing.T) {
+	ctx := context.Background()
+	host := newTestRegistry(t)
+	uri := host + "/fake-image-tag:latest"
+	pinned := pushRandomImage(t, uri)
+
+	fake := lambrolltest.NewFakeLambda()
+	app, err := lambrolltest.NewApp(ctx, &lambroll.Option{
+		Function: "test/fake/function_image_tag.json",
+	}, fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Deploy(ctx, newDeployOption()); err != nil {
+		t.Fatal(err)
+	}
+	res, err := fake.GetFunction(ctx, &lambda.GetFunctionInput{FunctionName: aws.String("fake-image-tag")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := aws.ToString(res.Code.ImageUri); got != pinned {
+		t.Errorf("ImageUri is not pinned. expected %s got %s", pinned, got)
+	}
+
+	var buf bytes.Buffer
+	app.SetStdout(&buf)
+	diffOpt := &lambroll.DiffOption{Src: "test/src"}
+	if err := app.Diff(ctx, diffOpt); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("unexpected diff %s", buf.String())
+	}
+
+	// the tag is moved
+	moved := pushRandomImage(t, uri)
+	buf.Reset()
+	if err := app.Diff(ctx, diffOpt); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, pinned) || !strings.Contains(out, moved) {
+		t.Errorf("diff does not show the moved digest %s", out)
+	}
+}
+
+func TestConcurrencyWithFake(t *testing.T) {
+	ctx := context.Background()
+	fake := lambrolltest.NewFakeLambda()
+	app, err := lambrolltest.NewApp(ctx, &lambroll.Option{
+		Function: "test/fake/function_concurrency.json",
+	}, fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := aws.String("fake-concurrency")
+	testConcurrency := func(reserved, provisioned int32) {
+		t.Helper()
+		rc, err := fake.GetFunctionConcurrency(ctx, &lambda.GetFunctionConcurrencyInput{FunctionName: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := aws.ToInt32(rc.ReservedConcurrentExecutions); got != reserved {
+			t.Errorf("unexpected reserved concurrency %d", got)
+		}
+		alias, err := fake.GetAlias(ctx, &lambda.GetAliasInput{FunctionName: name, Name: aws.String("current")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// provisioned concurrency of the alias is configured on the version
+		pc, err := fake.GetProvisionedConcurrencyConfig(ctx, &lambda.GetProvisionedConcurrencyConfigInput{
+			FunctionName: name,
+			Qualifier:    alias.FunctionVersion,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := aws.ToInt32(pc.RequestedProvisionedConcurrentExecutions); got != provisioned {
+			t.Errorf("unexpected provisioned concurrency %d", got)
+		}
+		if pc.Status != types.ProvisionedConcurrencyStatusEnumReady {
+			t.Errorf("unexpected status %s", pc.Status)
+		}
+	}
+
+	if err := app.Deploy(ctx, newDeployOption()); err != nil {
+		t.Fatal(err)
+	}
+	testConcurrency(5, 2)
+
+	var buf bytes.Buffer
+	app.SetStdout(&buf)
+	diffOpt := &lambroll.DiffOption{Src: "test/src"}
+	if err := app.Diff(ctx, diffOpt); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("unexpected diff %s", buf.String())
+	}
+
+	// modified by others
+	if _, err := fake.PutFunctionConcurrency(ctx, &lambda.PutFunctionConcurrencyInput{
+		FunctionName:                 name,
+		ReservedConcurrentExecutions: aws.Int32(10),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fake.PutProvisionedConcurrencyConfig(ctx, &lambda.PutProvisionedConcurrencyConfigInput{
+		FunctionName:                    name,
+		Qualifier:                       aws.String("1"),
+		ProvisionedConcurrentExecutions: aws.Int32(3),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Diff(ctx, diffOpt); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, `"Reserved": 10`) || !strings.Contains(out, `"current": 3`) {
+		t.Errorf("diff does not show the concurrency %s", out)
+	}
+
+	// concurrency is not included in JSON Patch
+	buf.Reset()
+	if err := app.Diff(ctx, &lambroll.DiffOption{Src: "test/src", Output: "patch"}); err != nil {
+		t.Fatal(err)
+	}
+	if out := strings.TrimSpace(buf.String()); out != "{}" {
+		t.Errorf("unexpected patch %s", out)
+	}
+
+	if err := app.Deploy(ctx, newDeployOption()); err != nil {
+		t.Fatal(err)
+	}
+	testConcurrency(5, 2)
+}
+
+// callRecordingLambda records the order of the calls of updating aliases and provisioned concurrency
+type callRecordingLambda struct {
+	*lambrolltest.FakeLambda
+	calls []string
+}
+
+func (r *callRecordingLambda) UpdateAlias(ctx context.Context, in *lambda.UpdateAliasInput, opts ...func(*lambda.Options)) (*lambda.UpdateAliasOutput, error) {
+	r.calls = append(r.calls, "UpdateAlias")
+	return r.FakeLambda.UpdateAlias(ctx, in, opts...)
+}
+
+func (r *callRecordingLambda) PutProvisionedConcurrencyConfig(ctx context.Context, in *lambda.PutProvisionedConcurrencyConfigInput, opts ...func(*lambda.Options)) (*lambda.PutProvisionedConcurrencyConfigOutput, error) {
+	r.calls = append(r.calls, "PutProvisionedConcurrencyConfig "+aws.ToString(in.Qualifier))
+	return r.FakeLambda.PutProvisionedConcurrencyConfig(ctx, in, opts...)
+}
+
+func (r *callRecordingLambda) GetProvisionedConcurrencyConfig(ctx context.Context, in *lambda.GetProvisionedConcurrencyConfigInput, opts ...func(*lambda.Options)) (*lambda.GetProvisionedConcurrencyConfigOutput, error) {
+	r.calls = append(r.calls, "GetProvisionedConcurrencyConfig "+aws.ToString(in.Qualifier))
+	return r.FakeLambda.GetProvisionedConcurrencyConfig(ctx, in, opts...)
+}
+
+func (r *callRecordingLambda) DeleteProvisionedConcurrencyConfig(ctx context.Context, in *lambda.DeleteProvisionedConcurrencyConfigInput, opts ...func(*lambda.Options)) (*lambda.DeleteProvisionedConcurrencyConfigOutput, error) {
+	r.calls = append(r.calls, "DeleteProvisionedConcurrencyConfig "+aws.ToString(in.Qualifier))
+	return r.FakeLambda.DeleteProvisionedConcurrencyConfig(ctx, in, opts...)
+}
+
+// failingProvisionLambda reports the provisioned concurrency of the version as FAILED
+type failingProvisionLambda struct {
+	*lambrolltest.FakeLambda
+	version string
+}
+
+func (f *failingProvisionLambda) GetProvisionedConcurrencyConfig(ctx context.Context, in *lambda.GetProvisionedConcurrencyConfigInput, opts ...func(*lambda.Options)) (*lambda.GetProvisionedConcurrencyConfigOutput, error) {
+	res, err := f.FakeLambda.GetProvisionedConcurrencyConfig(ctx, in, opts...)
+	if err == nil && aws.ToString(in.Qualifier) == f.version {
+		res.Status = types.ProvisionedConcurrencyStatusEnumFailed
+		res.StatusReason = aws.String("insufficient concurrency")
+	}
+	return res, err
+}
+
+func TestConcurrencyOrderWithFake(t *testing.T) {
+	ctx := context.Background()
+	fake := lambrolltest.NewFakeLambda()
+	app, err := lambrolltest.NewApp(ctx, &lambroll.Option{
+		Function: "test/fake/function_concurrency.json",
+	}, fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Deploy(ctx, newDeployOption()); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &callRecordingLambda{FakeLambda: fake}
+	app.SetLambdaAPI(r)
+	t.Setenv("DESCRIPTION", "v2")
+	if err := app.Deploy(ctx, newDeployOption()); err != nil {
+		t.Fatal(err)
+	}
+	// the new version is pre-warmed before the alias points to it,
+	// and the provisioned concurrency of the old version is deleted after that
+	expected := []string{
+		"GetProvisionedConcurrencyConfig current",
+		"GetProvisionedConcurrencyConfig 1",
+		"PutProvisionedConcurrencyConfig 2",
+		"GetProvisionedConcurrencyConfig 2", // wait for READY
+		"UpdateAlias",
+		"DeleteProvisionedConcurrencyConfig 1",
+		"GetProvisionedConcurrencyConfig current",
+		"GetProvisionedConcurrencyConfig 2",
+		"GetProvisionedConcurrencyConfig 2", // wait for READY
+	}
+	if diff := cmp.Diff(expected, r.calls); diff != "" {
+		t.Errorf("unexpected order of calls %s", diff)
+	}
+
+	// provisioned concurrency configured on the alias is moved to the new version
+	if _, err := fake.DeleteProvisionedConcurrencyConfig(ctx, &lambda.DeleteProvisionedConcurrencyConfigInput{
+		FunctionName: aws.String("fake-concurrency"),
+		Qualifier:    aws.String("2"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fake.PutProvisionedConcurrencyConfig(ctx, &lambda.PutProvisionedConcurrencyConfigInput{
+		FunctionName:                    aws.String("fake-concurrency"),
+		Qualifier:                       aws.String("current"),
+		ProvisionedConcurrentExecutions: aws.Int32(2),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	r.calls = nil
+	t.Setenv("DESCRIPTION", "v3")
+	if err := app.Deploy(ctx, newDeployOption()); err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{
+		"GetProvisionedConcurrencyConfig current",
+		"PutProvisionedConcurrencyConfig 3",
+		"GetProvisionedConcurrencyConfig 3", // wait for READY
+		"UpdateAlias",
+		"DeleteProvisionedConcurrencyConfig current",
+		"GetProvisionedConcurrencyConfig current",
+		"GetProvisionedConcurrencyConfig 3",
+		"GetProvisionedConcurrencyConfig 3", // wait for READY
+	}
+	if diff := cmp.Diff(expected, r.calls); diff != "" {
+		t.Errorf("unexpected order of calls %s", diff)
+	}
+}
+
+func TestConcurrencyPrewarmFailedWithFake(t *testing.T) {
+	ctx := context.Background()
+	fake := lambrolltest.NewFakeLambda()
+	app, err := lambrolltest.NewApp(ctx, &lambroll.Option{
+		Function: "test/fake/function_concurrency.json",
+	}, fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Deploy(ctx, newDeployOption()); err != nil {
+		t.Fatal(err)
+	}
+
+	app.SetLambdaAPI(&failingProvisionLambda{FakeLambda: fake, version: "2"})
+	t.Setenv("DESCRIPTION", "v2")
+	err = app.Deploy(ctx, newDeployOption())
+	if err == nil || !strings.Contains(err.Error(), "failed to pre-warm version 2") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	// the alias is not updated and the provisioned concurrency of the new version is removed
+	if res, err := fake.GetAlias(ctx, &lambda.GetAliasInput{FunctionName: aws.String("fake-concurrency"), Name: aws.String("current")}); err != nil {
+		t.Fatal(err)
+	} else if v := aws.ToString(res.FunctionVersion); v != "1" {
+		t.Errorf("alias should not be updated: %s", v)
+	}
+	if _, err := fake.GetProvisionedConcurrencyConfig(ctx, &lambda.GetProvisionedConcurrencyConfigInput{
+		FunctionName: aws.String("fake-concurrency"),
+		Qualifier:    aws.String("2"),
+	}); err == nil {
+		t.Error("provisioned concurrency of version 2 should be deleted")
+	}
+}
+
+func TestEventInvokeConfigWithFake(t *testing.T) {
+	ctx := context.Background()
+	fake := lambrolltest.NewFakeLambda()
+	app, err := lambrolltest.NewApp(ctx, &lambroll.Option{
+		Function: "test/fake/function_event_invoke_config.json",
+	}, fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := aws.String("fake-event-invoke-config")
+	testConfigs := func(expected map[string]string) {
+		t.Helper()
+		res, err := fake.ListFunctionEventInvokeConfigs(ctx, &lambda.ListFunctionEventInvokeConfigsInput{FunctionName: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]string)
+		for _, c := range res.FunctionEventInvokeConfigs {
+			arn := aws.ToString(c.FunctionArn)
+			q := arn[strings.LastIndex(arn, ":")+1:]
+			var dest string
+			if d := c.DestinationConfig; d != nil && d.OnFailure != nil {
+				dest = aws.ToString(d.OnFailure.Destination)
+			}
+			got[q] = fmt.Sprintf("%d/%d/%s", aws.ToInt32(c.MaximumRetryAttempts), aws.ToInt32(c.MaximumEventAgeInSeconds), dest)
+		}
+		if diff := cmp.Diff(expected, got); diff != "" {
+			t.Errorf("unexpected event invoke configs %s", diff)
+		}
+	}
+	dlq := "arn:aws:sqs:ap-northeast-1:123456789012:dlq"
+
+	if err := app.Deploy(ctx, newDeployOption()); err != nil {
+		t.Fatal(err)
+	}
+	testConfigs(map[string]string{
+		"$LATEST": "1/0/" + dlq,
+		"current": "0/3600/", // not inherited from the function
+	})
+
+	var buf bytes.Buffer
+	app.SetStdout(&buf)
+	diffOpt := &lambroll.DiffOption{Src: "test/src"}
+	if err := app.Diff(ctx, diffOpt); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("unexpected diff %s", buf.String())
+	}
+
+	// modified by others. the config of the version is not managed
+	for _, q := range []*string{nil, aws.String("1")} {
+		if _, err := fake.PutFunctionEventInvokeConfig(ctx, &lambda.PutFunctionEventInvokeConfigInput{
+			FunctionName:         name,
+			Qualifier:            q,
+			MaximumRetryAttempts: aws.Int32(2),
+			DestinationConfig: &types.DestinationConfig{
+				OnFailure: &types.OnFailure{Destination: aws.String(dlq)},
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := app.Diff(ctx, diffOpt); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, `"MaximumRetryAttempts": 2`) {
+		t.Errorf("diff does not show the event invoke config %s", out)
+	}
+
+	if err := app.Deploy(ctx, newDeployOption()); err != nil {
+		t.Fatal(err)
+	}
+	testConfigs(map[string]string{
+		"$LATEST": "1/0/" + dlq,
+		"current": "0/3600/",
+		"1":       "2/0/" + dlq,
+	})
+}
+
+func TestDiffExitCodeWithFake(t *testing.T) {
+	ctx := context.Background()
+	app, fake := newFakeApp(t)
+	var buf bytes.Buffer
+	app.SetStdout(&buf)
+	report := filepath.Join(t.TempDir(), "report.json")
+	diffOpt := &lambroll.DiffOption{
+		Src:        "test/src",
+		CodeSha256: true,
+		ExitCode:   true,
+		Report:     report,
+		BuildOption: lambroll.BuildOption{
+			ZipOption: lambroll.ZipOption{
+				ExcludeFile: "test/src/.lambdaignore",
+			},
+		},
+	}
+	testDiff := func(code int, expected lambroll.DiffReport) {
+		t.Helper()
+		err := app.Diff(ctx, diffOpt)
+		var ece *lambroll.ExitCodeError
+		if code == lambroll.ExitCodeNoChanges {
+			if err != nil {
+				t.Fatal(err)
+			}
+		} else if !errors.As(err, &ece) {
+			t.Fatalf("expected ExitCodeError but got %v", err)
+		} else if ece.Code != code {
+			t.Errorf("unexpected exit code %d, expected %d", ece.Code, code)
+		}
+		b, err := os.ReadFile(report)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got lambroll.DiffReport
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(expected, got, cmpopts.IgnoreUnexported(lambroll.DiffReport{}), cmpopts.IgnoreFields(lambroll.DiffReport{}, "Changes")); diff != "" {
+			t.Errorf("unexpected report %s", diff)
+		}
+	}
+
+	testDiff(lambroll.ExitCodeFunctionNotFound, lambroll.DiffReport{
+		FunctionName: "fake-test",
+		Drift:        "not_found",
+		ExitCode:     lambroll.ExitCodeFunctionNotFound,
+		Paths:        []string{""}, // add the whole definition
+	})
+
+	if err := app.Deploy(ctx, newDeployOption()); err != nil {
+		t.Fatal(err)
+	}
+	testDiff(lambroll.ExitCodeNoChanges, lambroll.DiffReport{
+		FunctionName: "fake-test",
+		Drift:        "none",
+		ExitCode:     lambroll.ExitCodeNoChanges,
+		Paths:        []string{},
+	})
+
+	// modified by others
+	if _, err := fake.UpdateFunctionConfiguration(ctx, &lambda.UpdateFunctionConfigurationInput{
+		FunctionName: aws.String("fake-test"),
+		MemorySize:   aws.Int32(256),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	testDiff(lambroll.ExitCodeConfigDrift, lambroll.DiffReport{
+		FunctionName: "fake-test",
+		Drift:        "config",
+		ExitCode:     lambroll.ExitCodeConfigDrift,
+		Paths:        []string{"/MemorySize"},
+	})
+
+	if _, err := fake.UpdateFunctionCode(ctx, &lambda.UpdateFunctionCodeInput{
+		FunctionName: aws.String("fake-test"),
+		ZipFile:      []byte("modified"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	testDiff(lambroll.ExitCodeConfigAndCodeDrift, lambroll.DiffReport{
+		FunctionName: "fake-test",
+		Drift:        "config_and_code",
+		ExitCode:     lambroll.ExitCodeConfigAndCodeDrift,
+		Paths:        []string{"/MemorySize", "/CodeSha256"},
+	})
+}
+
+func TestDiffOutputWithFake(t *testing.T) {
+	ctx := context.Background()
+	fake := lambrolltest.NewFakeLambda()
+	app, err := lambrolltest.NewApp(ctx, &lambroll.Option{
+		Function: "test/fake/function_permissions.json",
+	}, fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Deploy(ctx, newDeployOption()); err != nil {
+		t.Fatal(err)
+	}
+
+	// modified by others
+	if _, err := fake.UpdateFunctionConfiguration(ctx, &lambda.UpdateFunctionConfigurationInput{
+		FunctionName: aws.String("fake-test"),
+		MemorySize:   aws.Int32(256),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fake.TagResource(ctx, &lambda.TagResourceInput{
+		Resource: aws.String("arn:aws:lambda:ap-northeast-1:123456789012:function:fake-test"),
+		Tags:     map[string]string{"Team": "others"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SOURCE_BUCKET", "bucket-b")
+
+	var buf bytes.Buffer
+	app.SetStdout(&buf)
+	if err := app.Diff(ctx, &lambroll.DiffOption{Src: "test/src", Output: "json"}); err != nil {
+		t.Fatal(err)
+	}
+	var report lambroll.DiffReport
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("output is not JSON: %s %s", err, buf.String())
+	}
+	ops := make([]string, 0, len(report.Changes))
+	for _, c := range report.Changes {
+		path := c.Path
+		if strings.HasPrefix(path, "/Permissions/") {
+			path = "/Permissions/*"
+		}
+		ops = append(ops, c.Op+" "+path)
+	}
+	if diff := cmp.Diff([]string{
+		"replace /MemorySize",
+		"remove /Tags",
+		"remove /Permissions/*",
+		"add /Permissions/*",
+	}, ops); diff != "" {
+		t.Errorf("unexpected changes %s", diff)
+	}
+	if c := report.Changes[0]; c.Remote != float64(256) || c.Local != float64(128) {
+		t.Errorf("unexpected change of MemorySize %v", c)
+	}
+	if report.Drift != "config" {
+		t.Errorf("unexpected drift %s", report.Drift)
+	}
+
+	buf.Reset()
+	if err := app.Diff(ctx, &lambroll.DiffOption{Src: "test/src", Output: "patch"}); err != nil {
+		t.Fatal(err)
+	}
+	var patches map[string][]map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &patches); err != nil {
+		t.Fatalf("output is not JSON: %s %s", err, buf.String())
+	}
+	patch := patches["function"]
+	if len(patches) != 1 || len(patch) != 4 {
+		t.Fatalf("unexpected patch %s", buf.String())
+	}
+	if diff := cmp.Diff(map[string]any{"op": "replace", "path": "/MemorySize", "value": float64(128)}, patch[0]); diff != "" {
+		t.Errorf("unexpected patch %s", diff)
+	}
+	if diff := cmp.Diff(map[string]any{"op": "remove", "path": "/Tags"}, patch[1]); diff != "" {
+		t.Errorf("unexpected patch %s", diff)
+	}
+	if v, _ := patch[3]["value"].(map[string]any); v["SourceArn"] != "arn:aws:s3:::bucket-b" {
+		t.Errorf("unexpected patch %v", patch[3])
+	}
+	// permissions are pointed by the index of the arrays
+	if patch[2]["op"] != "remove" || patch[2]["path"] != "/Permissions/0" || patch[3]["op"] != "add" || patch[3]["path"] != "/Permissions/0" {
+		t.Errorf("unexpected patch of permissions %v %v", patch[2], patch[3])
+	}
+
+	// the function is not found. the patch adds the whole document
+	if _, err := fake.DeleteFunction(ctx, &lambda.DeleteFunctionInput{FunctionName: aws.String("fake-test")}); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := app.Diff(ctx, &lambroll.DiffOption{Src: "test/src", Output: "patch"}); err != nil {
+		t.Fatal(err)
+	}
+	patches = nil
+	if err := json.Unmarshal(buf.Bytes(), &patches); err != nil {
+		t.Fatalf("output is not JSON: %s %s", err, buf.String())
+	}
+	patch = patches["function"]
+	if len(patch) != 1 || patch[0]["op"] != "add" || patch[0]["path"] != "" {
+		t.Fatalf("unexpected patch %s", buf.String())
+	}
+	v, _ := patch[0]["value"].(map[string]any)
+	if v["FunctionName"] != "fake-test" {
+		t.Errorf("unexpected document %v", v)
+	}
+	if ps, _ := v["Permissions"].([]any); len(ps) != 2 {
+		t.Errorf("unexpected permissions in the document %v", v["Permissions"])
+	}
+}
+
+func TestDiffMarkdownWithFake(t *testing.T) {
+	ctx := context.Background()
+	app, fake := newFakeApp(t)
+	if err := app.Deploy(ctx, newDeployOption()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fake.UpdateFunctionConfiguration(ctx, &lambda.UpdateFunctionConfigurationInput{
+		FunctionName: aws.String("fake-test"),
+		MemorySize:   aws.Int32(256),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	summary := filepath.Join(t.TempDir(), "summary.md")
+	t.Setenv(lambroll.GitHubStepSummaryEnv, summary)
+
+	var buf bytes.Buffer
+	app.SetStdout(&buf)
+	if err := app.Diff(ctx, &lambroll.DiffOption{
+		Src:        "test/src",
+		CodeSha256: true,
+		Output:     "markdown",
+		BuildOption: lambroll.BuildOption{
+			ZipOption: lambroll.ZipOption{
+				ExcludeFile: "test/src/.lambdaignore",
+			},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, s := range []string{
+		"### fake-test\n",
+		"| `arn:aws:lambda:ap-northeast-1:123456789012:function:fake-test` | `$LATEST` |",
+		"bytes (+0) |",
+		"<details><summary>1 change (config drift)</summary>",
+		"```diff\n",
+		`+  "MemorySize": 128,`,
+		"</details>",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("markdown does not contain %q", s)
+		}
+	}
+	if strings.Contains(out, "\x1b[") {
+		t.Error("markdown contains escape sequences")
+	}
+	if b, err := os.ReadFile(summary); err != nil {
+		t.Fatal(err)
+	} else if string(b) != out {
+		t.Errorf("unexpected step summary %s", string(b))
+	}
+}
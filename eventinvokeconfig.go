@@ -0,0 +1,243 @@
+package lambroll
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aereal/jsondiff"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// EventInvokeConfig represents the configuration of asynchronous invocation of the function.
+// The settings of the function are applied to the unqualified function, and Aliases are applied to each alias.
+type EventInvokeConfig struct {
+	EventInvokeSettings
+
+	// Aliases are the settings for each alias. They are applied as written, not inherited from the settings of the function.
+	Aliases map[string]*EventInvokeSettings `json:"Aliases,omitempty"`
+}
+
+// EventInvokeSettings represents the parameters of PutFunctionEventInvokeConfig
+type EventInvokeSettings struct {
+	DestinationConfig        *types.DestinationConfig `json:"DestinationConfig,omitempty"`
+	MaximumEventAgeInSeconds *int32                   `json:"MaximumEventAgeInSeconds,omitempty"`
+	MaximumRetryAttempts     *int32                   `json:"MaximumRetryAttempts,omitempty"`
+}
+
+func (s *EventInvokeSettings) isEmpty() bool {
+	return s.DestinationConfig == nil && s.MaximumEventAgeInSeconds == nil && s.MaximumRetryAttempts == nil
+}
+
+// newEventInvokeSettings converts the remote config. Empty destinations are omitted.
+func newEventInvokeSettings(c types.FunctionEventInvokeConfig) *EventInvokeSettings {
+	s := &EventInvokeSettings{
+		MaximumEventAgeInSeconds: c.MaximumEventAgeInSeconds,
+		MaximumRetryAttempts:     c.MaximumRetryAttempts,
+	}
+	if d := c.DestinationConfig; d != nil {
+		dc := &types.DestinationConfig{}
+		if d.OnSuccess != nil && d.OnSuccess.Destination != nil {
+			dc.OnSuccess = d.OnSuccess
+		}
+		if d.OnFailure != nil && d.OnFailure.Destination != nil {
+			dc.OnFailure = d.OnFailure
+		}
+		if dc.OnSuccess != nil || dc.OnFailure != nil {
+			s.DestinationConfig = dc
+		}
+	}
+	return s
+}
+
+// settings returns the settings for each qualifier. The key of the unqualified function is "".
+func (c *EventInvokeConfig) settings() map[string]*EventInvokeSettings {
+	m := make(map[string]*EventInvokeSettings)
+	if !c.EventInvokeSettings.isEmpty() {
+		m[""] = &c.EventInvokeSettings
+	}
+	for alias, s := range c.Aliases {
+		if s == nil {
+			s = &EventInvokeSettings{}
+		}
+		m[alias] = s
+	}
+	return m
+}
+
+// newEventInvokeConfigFrom creates EventInvokeConfig from the settings for each qualifier
+func newEventInvokeConfigFrom(m map[string]*EventInvokeSettings) *EventInvokeConfig {
+	c := &EventInvokeConfig{}
+	for q, s := range m {
+		if q == "" {
+			c.EventInvokeSettings = *s
+			continue
+		}
+		if c.Aliases == nil {
+			c.Aliases = make(map[string]*EventInvokeSettings)
+		}
+		c.Aliases[q] = s
+	}
+	return c
+}
+
+// isVersionQualifier reports whether q is a version number. Configs of versions are not managed by lambroll.
+func isVersionQualifier(q string) bool {
+	if q == "" {
+		return false
+	}
+	return strings.Trim(q, "0123456789") == ""
+}
+
+// getEventInvokeConfigs returns the settings of the unqualified function and aliases
+func (app *App) getEventInvokeConfigs(ctx context.Context, name string) (map[string]*EventInvokeSettings, error) {
+	m := make(map[string]*EventInvokeSettings)
+	var marker *string
+	for {
+		res, err := app.lambda.ListFunctionEventInvokeConfigs(ctx, &lambda.ListFunctionEventInvokeConfigsInput{
+			FunctionName: aws.String(name),
+			Marker:       marker,
+		})
+		if err != nil {
+			var nfe *types.ResourceNotFoundException
+			if errors.As(err, &nfe) {
+				return m, nil
+			}
+			return nil, fmt.Errorf("failed to list function event invoke configs: %w", err)
+		}
+		for _, c := range res.FunctionEventInvokeConfigs {
+			// arn:aws:lambda:region:account:function:name:qualifier
+			var q string
+			if parts := strings.Split(aws.ToString(c.FunctionArn), ":"); len(parts) >= 8 {
+				q = parts[7]
+			}
+			if q == versionLatest {
+				q = ""
+			}
+			if isVersionQualifier(q) {
+				continue
+			}
+			m[q] = newEventInvokeSettings(c)
+		}
+		if marker = res.NextMarker; marker == nil {
+			break
+		}
+	}
+	return m, nil
+}
+
+// mergeEventInvokeConfigs merges old/new settings for each qualifier like mergeTags
+func mergeEventInvokeConfigs(oldConfigs, newConfigs map[string]*EventInvokeSettings) (puts map[string]*EventInvokeSettings, removes []string) {
+	puts = make(map[string]*EventInvokeSettings)
+	removes = make([]string, 0)
+	for q, oldValue := range oldConfigs {
+		if newValue, ok := newConfigs[q]; ok {
+			if jsonStr(newValue) != jsonStr(oldValue) {
+				puts[q] = newValue
+			}
+		} else {
+			removes = append(removes, q)
+		}
+	}
+	for q, newValue := range newConfigs {
+		if _, ok := oldConfigs[q]; !ok {
+			puts[q] = newValue
+		}
+	}
+	sort.Strings(removes)
+	return
+}
+
+func qualifierLabel(q string) string {
+	if q == "" {
+		return "function"
+	}
+	return "alias " + q
+}
+
+func (app *App) deployEventInvokeConfig(ctx context.Context, fn *FunctionDefinition, opt *DeployOption) error {
+	if fn.EventInvokeConfig == nil {
+		app.logger.Println("[debug] EventInvokeConfig not defined in function.json skip updating event invoke config")
+		return nil
+	}
+	name := *fn.FunctionName
+	current, err := app.getEventInvokeConfigs(ctx, name)
+	if err != nil {
+		return err
+	}
+	puts, removes := mergeEventInvokeConfigs(current, fn.EventInvokeConfig.settings())
+	if len(puts) == 0 && len(removes) == 0 {
+		app.logger.Println("[info] no changes in event invoke config.")
+		return nil
+	}
+
+	qualifiers := make([]string, 0, len(puts))
+	for q := range puts {
+		qualifiers = append(qualifiers, q)
+	}
+	sort.Strings(qualifiers)
+	for _, q := range qualifiers {
+		s := puts[q]
+		app.logger.Printf("[info] putting event invoke config of %s %s", qualifierLabel(q), opt.label())
+		if opt.DryRun {
+			continue
+		}
+		in := &lambda.PutFunctionEventInvokeConfigInput{
+			FunctionName:             aws.String(name),
+			DestinationConfig:        s.DestinationConfig,
+			MaximumEventAgeInSeconds: s.MaximumEventAgeInSeconds,
+			MaximumRetryAttempts:     s.MaximumRetryAttempts,
+		}
+		if q != "" {
+			in.Qualifier = aws.String(q)
+		}
+		if _, err := app.lambda.PutFunctionEventInvokeConfig(ctx, in); err != nil {
+			return fmt.Errorf("failed to put event invoke config of %s: %w", qualifierLabel(q), err)
+		}
+	}
+	for _, q := range removes {
+		app.logger.Printf("[info] deleting event invoke config of %s %s", qualifierLabel(q), opt.label())
+		if opt.DryRun {
+			continue
+		}
+		in := &lambda.DeleteFunctionEventInvokeConfigInput{
+			FunctionName: aws.String(name),
+		}
+		if q != "" {
+			in.Qualifier = aws.String(q)
+		}
+		if _, err := app.lambda.DeleteFunctionEventInvokeConfig(ctx, in); err != nil {
+			return fmt.Errorf("failed to delete event invoke config of %s: %w", qualifierLabel(q), err)
+		}
+	}
+	return nil
+}
+
+func (app *App) diffEventInvokeConfig(ctx context.Context, fn *FunctionDefinition, opt *DiffOption) error {
+	if fn.EventInvokeConfig == nil {
+		return nil
+	}
+	name := *fn.FunctionName
+	current, err := app.getEventInvokeConfigs(ctx, name)
+	if err != nil {
+		return err
+	}
+	remote := map[string]*EventInvokeConfig{"EventInvokeConfig": newEventInvokeConfigFrom(current)}
+	local := map[string]*EventInvokeConfig{"EventInvokeConfig": newEventInvokeConfigFrom(fn.EventInvokeConfig.settings())}
+	r, _ := toGeneralMap(remote, false)
+	l, _ := toGeneralMap(local, false)
+	if diff, err := jsondiff.Diff(
+		&jsondiff.Input{Name: app.functionArn(ctx, name), X: r},
+		&jsondiff.Input{Name: app.functionFilePath, X: l},
+	); err != nil {
+		return fmt.Errorf("failed to diff: %w", err)
+	} else if diff != "" {
+		fmt.Fprint(app.stdout, coloredDiff(diff))
+		opt.report.addChanges(diffChanges(r, l, ""))
+	}
+	return nil
+}
@@ -0,0 +1,382 @@
+package lambroll
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/aereal/jsondiff"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/samber/lo"
+)
+
+// EventSourceMapping represents an event source mapping in event_source_mappings.json(net)
+type EventSourceMapping = lambda.CreateEventSourceMappingInput
+
+// EventSourceMappings represents a definition of event source mappings of the function
+type EventSourceMappings []*EventSourceMapping
+
+// eventSourceMappingImmutableFields are fields that can not be changed by UpdateEventSourceMapping
+var eventSourceMappingImmutableFields = []string{
+	"AmazonManagedKafkaEventSourceConfig",
+	"Queues",
+	"SelfManagedEventSource",
+	"SelfManagedKafkaEventSourceConfig",
+	"StartingPosition",
+	"StartingPositionTimestamp",
+	"Topics",
+}
+
+// eventSourceMappingKey returns a key to identify the event source mapping.
+// Mappings are identified by the target function (with qualifier) and the event source.
+func eventSourceMappingKey(functionName string, eventSourceArn *string, selfManaged *types.SelfManagedEventSource, topics []string) string {
+	fn := functionNameFromArn(functionName)
+	if eventSourceArn != nil {
+		return fn + " " + *eventSourceArn
+	}
+	var endpoints []string
+	if selfManaged != nil {
+		for k, v := range selfManaged.Endpoints {
+			for _, e := range v {
+				endpoints = append(endpoints, k+"="+e)
+			}
+		}
+	}
+	sort.Strings(endpoints)
+	topics = append([]string{}, topics...)
+	sort.Strings(topics)
+	return fn + " " + strings.Join(endpoints, ",") + " " + strings.Join(topics, ",")
+}
+
+// functionNameFromArn returns name[:qualifier] from the function name or ARN
+func functionNameFromArn(s string) string {
+	if _, after, found := strings.Cut(s, ":function:"); found {
+		return after
+	}
+	return s
+}
+
+func (app *App) loadEventSourceMappings(path string, functionName string) (EventSourceMappings, error) {
+	f, err := loadDefinitionFile[EventSourceMappings](app, path, DefaultEventSourceMappingsFilenames)
+	if err != nil {
+		return nil, err
+	}
+	esms := *f
+	keys := make(map[string]struct{}, len(esms))
+	for i, m := range esms {
+		if m == nil {
+			return nil, fmt.Errorf("event source mapping [%d] is empty", i)
+		}
+		if m.FunctionName == nil {
+			m.FunctionName = aws.String(functionName)
+		}
+		if m.EventSourceArn == nil && m.SelfManagedEventSource == nil {
+			return nil, fmt.Errorf("event source mapping [%d] requires EventSourceArn or SelfManagedEventSource", i)
+		}
+		key := eventSourceMappingKey(*m.FunctionName, m.EventSourceArn, m.SelfManagedEventSource, m.Topics)
+		if _, exists := keys[key]; exists {
+			return nil, fmt.Errorf("event source mapping [%d] is duplicated: %s", i, key)
+		}
+		keys[key] = struct{}{}
+	}
+	return esms, nil
+}
+
+func (app *App) listEventSourceMappings(ctx context.Context, functionName string) ([]types.EventSourceMappingConfiguration, error) {
+	var marker *string
+	var ms []types.EventSourceMappingConfiguration
+	for {
+		res, err := app.lambda.ListEventSourceMappings(ctx, &lambda.ListEventSourceMappingsInput{
+			FunctionName: aws.String(functionName),
+			Marker:       marker,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list event source mappings of %s: %w", functionName, err)
+		}
+		ms = append(ms, res.EventSourceMappings...)
+		if marker = res.NextMarker; marker == nil {
+			break
+		}
+	}
+	return ms, nil
+}
+
+// toMap converts v to a map omitting empty values
+func toMap(v any) map[string]any {
+	m, _ := toGeneralMap(v, true)
+	if mm, ok := m.(map[string]any); ok {
+		return mm
+	}
+	return map[string]any{}
+}
+
+// eventSourceMappingToMap converts the remote event source mapping to the form of the definition
+func eventSourceMappingToMap(c types.EventSourceMappingConfiguration) map[string]any {
+	m := toMap(c)
+	// boolean fields are compared explicitly because false is omitted as an empty value
+	m["Enabled"] = aws.ToString(c.State) != "Disabled" && aws.ToString(c.State) != "Disabling"
+	m["BisectBatchOnFunctionError"] = aws.ToBool(c.BisectBatchOnFunctionError)
+	return m
+}
+
+type eventSourceMappingChange struct {
+	local  *EventSourceMapping
+	remote *types.EventSourceMappingConfiguration
+}
+
+func (c *eventSourceMappingChange) name() string {
+	if c.remote != nil {
+		return aws.ToString(c.remote.UUID)
+	}
+	return aws.ToString(c.local.EventSourceArn)
+}
+
+// diff returns local and remote values to compare. remote values are limited to the fields defined in local.
+func (c *eventSourceMappingChange) diff() (remote, local map[string]any) {
+	local = map[string]any{}
+	if c.local != nil {
+		local = toMap(c.local)
+		if c.local.Enabled != nil {
+			local["Enabled"] = *c.local.Enabled
+		}
+		if c.local.BisectBatchOnFunctionError != nil {
+			local["BisectBatchOnFunctionError"] = *c.local.BisectBatchOnFunctionError
+		}
+		delete(local, "FunctionName")
+		delete(local, "Tags") // tags are applied only at creation
+	}
+	remote = map[string]any{}
+	if c.remote != nil {
+		r := eventSourceMappingToMap(*c.remote)
+		if c.local == nil {
+			for _, k := range []string{"UUID", "EventSourceMappingArn", "FunctionArn", "LastModified", "LastProcessingResult", "State", "StateTransitionReason", "FilterCriteriaError"} {
+				delete(r, k)
+			}
+			return r, local
+		}
+		for k := range local {
+			if v, ok := r[k]; ok {
+				remote[k] = v
+			}
+		}
+	}
+	return remote, local
+}
+
+func (c *eventSourceMappingChange) changed() bool {
+	remote, local := c.diff()
+	return !reflect.DeepEqual(remote, local)
+}
+
+// immutableChanges returns the fields which differ but can not be changed by UpdateEventSourceMapping
+func (c *eventSourceMappingChange) immutableChanges() []string {
+	if c.local == nil || c.remote == nil {
+		return nil
+	}
+	remote, local := c.diff()
+	var fields []string
+	for _, k := range eventSourceMappingImmutableFields {
+		if !reflect.DeepEqual(remote[k], local[k]) {
+			fields = append(fields, k)
+		}
+	}
+	return fields
+}
+
+// calcEventSourceMappingsDiff returns mappings to be created, updated and deleted
+func (app *App) calcEventSourceMappingsDiff(ctx context.Context, functionName string, esms EventSourceMappings) ([]*eventSourceMappingChange, error) {
+	// list remote mappings of the function and the qualified functions in the definition
+	names := []string{functionName}
+	for _, m := range esms {
+		if n := functionNameFromArn(*m.FunctionName); !lo.Contains(names, n) {
+			names = append(names, n)
+		}
+	}
+	remotes := make(map[string]*types.EventSourceMappingConfiguration)
+	var remoteKeys []string
+	for _, name := range names {
+		ms, err := app.listEventSourceMappings(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for i := range ms {
+			m := &ms[i]
+			key := eventSourceMappingKey(aws.ToString(m.FunctionArn), m.EventSourceArn, m.SelfManagedEventSource, m.Topics)
+			if _, exists := remotes[key]; exists {
+				continue
+			}
+			remotes[key] = m
+			remoteKeys = append(remoteKeys, key)
+		}
+	}
+
+	var changes []*eventSourceMappingChange
+	locals := make(map[string]struct{}, len(esms))
+	for _, m := range esms {
+		key := eventSourceMappingKey(*m.FunctionName, m.EventSourceArn, m.SelfManagedEventSource, m.Topics)
+		locals[key] = struct{}{}
+		c := &eventSourceMappingChange{local: m, remote: remotes[key]}
+		if c.changed() {
+			changes = append(changes, c)
+		}
+	}
+	for _, key := range remoteKeys {
+		if _, exists := locals[key]; !exists {
+			changes = append(changes, &eventSourceMappingChange{remote: remotes[key]})
+		}
+	}
+	return changes, nil
+}
+
+func (app *App) deployEventSourceMappings(ctx context.Context, functionName string, esms EventSourceMappings, opt *DeployOption) error {
+	app.logger.Printf("[info] deploying event source mappings... %s", opt.label())
+	changes, err := app.calcEventSourceMappingsDiff(ctx, functionName, esms)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		app.logger.Println("[info] no changes in event source mappings.")
+		return nil
+	}
+	// fail before applying any changes. UpdateEventSourceMapping can not apply them,
+	// and recreating the mapping loses the position of the event source.
+	for _, c := range changes {
+		if fields := c.immutableChanges(); len(fields) > 0 {
+			return fmt.Errorf("%s of event source mapping UUID: %s can not be updated. delete the mapping to recreate it, or revert the definition", strings.Join(fields, ","), aws.ToString(c.remote.UUID))
+		}
+	}
+	for _, c := range changes {
+		switch {
+		case c.remote == nil:
+			app.logger.Printf("[info] creating event source mapping %s -> %s %s", aws.ToString(c.local.EventSourceArn), *c.local.FunctionName, opt.label())
+			if opt.DryRun {
+				continue
+			}
+			res, err := app.lambda.CreateEventSourceMapping(ctx, c.local)
+			if err != nil {
+				return fmt.Errorf("failed to create event source mapping: %w", err)
+			}
+			app.logger.Printf("[info] created event source mapping UUID: %s", aws.ToString(res.UUID))
+		case c.local == nil:
+			app.logger.Printf("[info] deleting event source mapping UUID: %s %s", aws.ToString(c.remote.UUID), opt.label())
+			if opt.DryRun {
+				continue
+			}
+			if _, err := app.lambda.DeleteEventSourceMapping(ctx, &lambda.DeleteEventSourceMappingInput{
+				UUID: c.remote.UUID,
+			}); err != nil {
+				return fmt.Errorf("failed to delete event source mapping: %w", err)
+			}
+			app.logger.Printf("[info] deleted event source mapping UUID: %s", aws.ToString(c.remote.UUID))
+		default:
+			app.logger.Printf("[info] updating event source mapping UUID: %s %s", aws.ToString(c.remote.UUID), opt.label())
+			if opt.DryRun {
+				continue
+			}
+			if _, err := app.lambda.UpdateEventSourceMapping(ctx, &lambda.UpdateEventSourceMappingInput{
+				UUID:                           c.remote.UUID,
+				BatchSize:                      c.local.BatchSize,
+				BisectBatchOnFunctionError:     c.local.BisectBatchOnFunctionError,
+				DestinationConfig:              c.local.DestinationConfig,
+				DocumentDBEventSourceConfig:    c.local.DocumentDBEventSourceConfig,
+				Enabled:                        c.local.Enabled,
+				FilterCriteria:                 c.local.FilterCriteria,
+				FunctionName:                   c.local.FunctionName,
+				FunctionResponseTypes:          c.local.FunctionResponseTypes,
+				KMSKeyArn:                      c.local.KMSKeyArn,
+				MaximumBatchingWindowInSeconds: c.local.MaximumBatchingWindowInSeconds,
+				MaximumRecordAgeInSeconds:      c.local.MaximumRecordAgeInSeconds,
+				MaximumRetryAttempts:           c.local.MaximumRetryAttempts,
+				ParallelizationFactor:          c.local.ParallelizationFactor,
+				ScalingConfig:                  c.local.ScalingConfig,
+				SourceAccessConfigurations:     c.local.SourceAccessConfigurations,
+				TumblingWindowInSeconds:        c.local.TumblingWindowInSeconds,
+			}); err != nil {
+				return fmt.Errorf("failed to update event source mapping: %w", err)
+			}
+			app.logger.Printf("[info] updated event source mapping UUID: %s", aws.ToString(c.remote.UUID))
+		}
+	}
+	app.logger.Println("[info] deployed event source mappings", opt.label())
+	return nil
+}
+
+func (app *App) diffEventSourceMappings(ctx context.Context, name string, opt *DiffOption) error {
+	esms, err := app.loadEventSourceMappings(opt.EventSourceMappings, name)
+	if err != nil {
+		return fmt.Errorf("failed to load event source mappings: %w", err)
+	}
+	changes, err := app.calcEventSourceMappingsDiff(ctx, name, esms)
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		remote, local := c.diff()
+		remoteName := "event source mapping " + c.name()
+		if c.remote == nil {
+			remoteName = "(new) " + remoteName
+		}
+		localName := opt.EventSourceMappings
+		if c.local == nil {
+			localName = "(deleted) " + localName
+		}
+		if diff, err := jsondiff.Diff(
+			&jsondiff.Input{Name: remoteName, X: remote},
+			&jsondiff.Input{Name: localName, X: local},
+		); err != nil {
+			return fmt.Errorf("failed to diff: %w", err)
+		} else if diff != "" {
+			fmt.Fprint(app.stdout, coloredDiff(diff))
+			opt.report.addChanges(diffChanges(remote, local, "/EventSourceMappings/"+escapeJSONPointer(c.name())))
+		}
+	}
+	return nil
+}
+
+func (app *App) initEventSourceMappings(ctx context.Context, fn *FunctionDefinition, opt *InitOption) error {
+	name := *fn.FunctionName
+	if opt.Qualifier != nil {
+		name = name + ":" + *opt.Qualifier
+	}
+	ms, err := app.listEventSourceMappings(ctx, name)
+	if err != nil {
+		return err
+	}
+	esms := make([]any, 0, len(ms))
+	for _, m := range ms {
+		var esm EventSourceMapping
+		b, _ := json.Marshal(eventSourceMappingToMap(m))
+		if err := json.Unmarshal(b, &esm); err != nil {
+			return fmt.Errorf("failed to convert event source mapping %s: %w", aws.ToString(m.UUID), err)
+		}
+		if n := functionNameFromArn(aws.ToString(m.FunctionArn)); n != *fn.FunctionName {
+			esm.FunctionName = aws.String(n)
+		}
+		v := toMap(esm)
+		v["Enabled"] = aws.ToBool(esm.Enabled)
+		esms = append(esms, v)
+	}
+
+	var filename string
+	if opt.Jsonnet {
+		filename = DefaultEventSourceMappingsFilenames[1]
+	} else {
+		filename = DefaultEventSourceMappingsFilenames[0]
+	}
+	app.logger.Printf("[info] creating %s", filename)
+	b, _ := json.MarshalIndent(esms, "", "  ")
+	b = append(b, '\n')
+	if opt.Jsonnet {
+		b, err = jsonToJsonnet(b, filename)
+		if err != nil {
+			return err
+		}
+	}
+	return app.saveFile(filename, b, os.FileMode(0644), opt.ForceOverwrite)
+}
@@ -1,7 +1,12 @@
 package lambroll
 
+import (
+	"context"
+	"io"
+	"os"
+)
+
 var (
-	CreateZipArchive  = createZipArchive
 	ExpandExcludeFile = expandExcludeFile
 	LoadZipArchive    = loadZipArchive
 	MergeTags         = mergeTags
@@ -10,15 +15,73 @@ var (
 	MarshalJSON       = marshalJSON
 	NewFunctionFrom   = newFunctionFrom
 	NewCallerIdentity = newCallerIdentity
+	CanarySteps       = canarySteps
 )
 
 type VersionsOutput = versionsOutput
 type VersionsOutputs = versionsOutputs
 
-func (app *App) CallerIdentity() *CallerIdentity {
-	return app.callerIdentity
+func (app *App) LoadFunction(f string) (*Function, error) {
+	def, err := app.loadFunction(f)
+	if err != nil {
+		return nil, err
+	}
+	return &def.Function, nil
 }
 
-func (app *App) LoadFunction(f string) (*Function, error) {
-	return app.loadFunction(f)
+var ParseSince = parseSince
+
+var LogGroupArnOf = logGroupArnOf
+
+type LogEventSet = logEventSet
+
+var NewLogEventSet = newLogEventSet
+
+func (s *logEventSet) Add(ts, ingestionTime int64, stream, message string) bool {
+	return s.add(ts, ingestionTime, stream, message)
+}
+
+func (s *logEventSet) Prune(before int64) {
+	s.prune(before)
+}
+
+func FormatLogMessage(message string, jsonLog bool) string {
+	f := &logFormatter{jsonLog: jsonLog}
+	return f.formatMessage(message)
+}
+
+func CreateZipArchive(src string, excludes []string, keepSymlink bool) (*os.File, os.FileInfo, error) {
+	return createZipArchive(src, &ZipOption{KeepSymlink: keepSymlink, excludes: excludes})
+}
+
+func CreateZipArchiveWithGitignore(src string, excludes []string) (*os.File, os.FileInfo, error) {
+	return createZipArchive(src, &ZipOption{IgnoreSyntax: "gitignore", excludes: excludes})
+}
+
+func CreateZipArchiveWithOption(src string, opt *ZipOption) (*os.File, os.FileInfo, error) {
+	return createZipArchive(src, opt)
+}
+
+var LoadIncludeFile = loadIncludeFile
+
+func CreateZipArchiveWithIncludes(includes []*PackageInclude, excludes []string) (*os.File, os.FileInfo, error) {
+	return createZipArchive("", &ZipOption{includes: includes, excludes: excludes})
+}
+
+func (app *App) RunBuild(ctx context.Context, b *Build, opt *BuildOption) error {
+	return app.runBuild(ctx, b, opt)
+}
+
+var GoArch = goarch
+
+func CreateZipArchiveWithBootstrap(src string, bootstrap []byte) (*os.File, os.FileInfo, error) {
+	return createZipArchive(src, &ZipOption{bootstrap: bootstrap})
+}
+
+func (app *App) SetStdout(w io.Writer) {
+	app.stdout = w
+}
+
+func (opt *ZipOption) SrcGiven() bool {
+	return opt.srcGiven
 }
@@ -6,7 +6,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"os"
 	"regexp"
 	"sort"
@@ -79,9 +78,16 @@ func (fc *FunctionURL) RemovePermissionInput(sid string) *lambda.RemovePermissio
 
 type FunctionURLConfig = lambda.CreateFunctionUrlConfigInput
 
-type FunctionURLPermissions []*FunctionURLPermission
+// FunctionURLPermissions is an alias of Permissions for compatibility
+type FunctionURLPermissions = Permissions
 
-func (ps FunctionURLPermissions) Sids() []string {
+// FunctionURLPermission is an alias of Permission for compatibility
+type FunctionURLPermission = Permission
+
+// Permissions represents statements of the resource-based policy managed by lambroll
+type Permissions []*Permission
+
+func (ps Permissions) Sids() []string {
 	sids := make([]string, 0, len(ps))
 	for _, p := range ps {
 		sids = append(sids, p.Sid())
@@ -90,7 +96,7 @@ func (ps FunctionURLPermissions) Sids() []string {
 	return sids
 }
 
-func (ps FunctionURLPermissions) Find(sid string) *FunctionURLPermission {
+func (ps Permissions) Find(sid string) *Permission {
 	for _, p := range ps {
 		if p.Sid() == sid {
 			return p
@@ -99,14 +105,16 @@ func (ps FunctionURLPermissions) Find(sid string) *FunctionURLPermission {
 	return nil
 }
 
-type FunctionURLPermission struct {
+// Permission represents a statement of the resource-based policy.
+// Sid is generated from the hash of the permission unless StatementId is specified.
+type Permission struct {
 	lambda.AddPermissionInput
 
 	sid  string
 	once sync.Once
 }
 
-func (p *FunctionURLPermission) Sid() string {
+func (p *Permission) Sid() string {
 	if p.sid != "" {
 		return p.sid
 	} else if p.StatementId != nil {
@@ -236,7 +244,7 @@ func (app *App) loadFunctionUrl(path string, functionName string) (*FunctionURL,
 }
 
 func (app *App) deployFunctionURL(ctx context.Context, fc *FunctionURL, opt *DeployOption) error {
-	log.Printf("[info] deploying function url... %s", opt.label())
+	app.logger.Printf("[info] deploying function url... %s", opt.label())
 
 	if err := app.deployFunctionURLConfig(ctx, fc, opt); err != nil {
 		return fmt.Errorf("failed to deploy function url config: %w", err)
@@ -246,7 +254,7 @@ func (app *App) deployFunctionURL(ctx context.Context, fc *FunctionURL, opt *Dep
 		return fmt.Errorf("failed to deploy function url permissions: %w", err)
 	}
 
-	log.Println("[info] deployed function url", opt.label())
+	app.logger.Println("[info] deployed function url", opt.label())
 	return nil
 }
 
@@ -260,7 +268,7 @@ func (app *App) deployFunctionURLConfig(ctx context.Context, fc *FunctionURL, op
 	if err != nil {
 		var nfe *types.ResourceNotFoundException
 		if errors.As(err, &nfe) {
-			log.Printf("[info] function url config for %s not found. creating %s", fqFunctionName, opt.label())
+			app.logger.Printf("[info] function url config for %s not found. creating %s", fqFunctionName, opt.label())
 			create = true
 		} else {
 			return fmt.Errorf("failed to get function url config: %w", err)
@@ -268,7 +276,7 @@ func (app *App) deployFunctionURLConfig(ctx context.Context, fc *FunctionURL, op
 	}
 
 	if opt.DryRun {
-		log.Println("[info] dry-run mode. skipping function url config deployment")
+		app.logger.Println("[info] dry-run mode. skipping function url config deployment")
 		return nil
 	}
 
@@ -277,10 +285,10 @@ func (app *App) deployFunctionURLConfig(ctx context.Context, fc *FunctionURL, op
 		if err != nil {
 			return fmt.Errorf("failed to create function url config: %w", err)
 		}
-		log.Printf("[info] created function url config for %s", fqFunctionName)
-		log.Printf("[info] Function URL: %s", *res.FunctionUrl)
+		app.logger.Printf("[info] created function url config for %s", fqFunctionName)
+		app.logger.Printf("[info] Function URL: %s", *res.FunctionUrl)
 	} else {
-		log.Printf("[info] updating function url config for %s", fqFunctionName)
+		app.logger.Printf("[info] updating function url config for %s", fqFunctionName)
 		if functionUrlConfig.Cors != nil && fc.Config.Cors == nil {
 			// reset cors config
 			fc.Config.Cors = &types.Cors{}
@@ -295,8 +303,8 @@ func (app *App) deployFunctionURLConfig(ctx context.Context, fc *FunctionURL, op
 		if err != nil {
 			return fmt.Errorf("failed to update function url config: %w", err)
 		}
-		log.Printf("[info] updated function url config for %s", fqFunctionName)
-		log.Printf("[info] Function URL: %s", *res.FunctionUrl)
+		app.logger.Printf("[info] updated function url config for %s", fqFunctionName)
+		app.logger.Printf("[info] Function URL: %s", *res.FunctionUrl)
 	}
 	return nil
 }
@@ -306,28 +314,32 @@ func (app *App) deployFunctionURLPermissions(ctx context.Context, fc *FunctionUR
 	if err != nil {
 		return err
 	}
+	return app.applyFunctionURLPermissions(ctx, fc, adds, removes, opt)
+}
+
+func (app *App) applyFunctionURLPermissions(ctx context.Context, fc *FunctionURL, adds, removes FunctionURLPermissions, opt *DeployOption) error {
 	if len(adds) == 0 && len(removes) == 0 {
-		log.Println("[info] no changes in permissions.")
+		app.logger.Println("[info] no changes in permissions.")
 		return nil
 	}
 
-	log.Printf("[info] adding %d permissions %s", len(adds), opt.label())
+	app.logger.Printf("[info] adding %d permissions %s", len(adds), opt.label())
 	if !opt.DryRun {
 		for _, p := range adds {
 			if _, err := app.lambda.AddPermission(ctx, fc.AddPermissionInput(p)); err != nil {
 				return fmt.Errorf("failed to add permission: %w", err)
 			}
-			log.Printf("[info] added permission Sid: %s", p.Sid())
+			app.logger.Printf("[info] added permission Sid: %s", p.Sid())
 		}
 	}
 
-	log.Printf("[info] removing %d permissions %s", len(removes), opt.label())
+	app.logger.Printf("[info] removing %d permissions %s", len(removes), opt.label())
 	if !opt.DryRun {
 		for _, p := range removes {
 			if _, err := app.lambda.RemovePermission(ctx, fc.RemovePermissionInput(*p.StatementId)); err != nil {
 				return fmt.Errorf("failed to remove permission: %w", err)
 			}
-			log.Printf("[info] removed permission Sid: %s", *p.StatementId)
+			app.logger.Printf("[info] removed permission Sid: %s", *p.StatementId)
 		}
 	}
 	return nil
@@ -386,7 +398,7 @@ func (app *App) getFunctionURLPermissions(ctx context.Context, functionName stri
 	}
 	ps := make(FunctionURLPermissions, 0)
 	if res != nil {
-		log.Printf("[debug] policy for %s: %s", fqFunctionName, *res.Policy)
+		app.logger.Printf("[debug] policy for %s: %s", fqFunctionName, *res.Policy)
 		var policy PolicyOutput
 		if err := json.Unmarshal([]byte(*res.Policy), &policy); err != nil {
 			return nil, fmt.Errorf("failed to unmarshal policy: %w", err)
@@ -397,7 +409,7 @@ func (app *App) getFunctionURLPermissions(ctx context.Context, functionName stri
 				continue
 			}
 			st, _ := json.Marshal(s)
-			log.Println("[debug] exists sid", s.Sid, string(st))
+			app.logger.Println("[debug] exists sid", s.Sid, string(st))
 			ps = append(ps, &FunctionURLPermission{
 				sid: s.Sid,
 				AddPermissionInput: lambda.AddPermissionInput{
@@ -412,7 +424,7 @@ func (app *App) getFunctionURLPermissions(ctx context.Context, functionName stri
 	return ps, nil
 }
 
-func (app *App) initFunctionURL(ctx context.Context, fn *Function, exists bool, opt *InitOption) error {
+func (app *App) initFunctionURL(ctx context.Context, fn *FunctionDefinition, exists bool, opt *InitOption) error {
 	fc, err := app.lambda.GetFunctionUrlConfig(ctx, &lambda.GetFunctionUrlConfigInput{
 		FunctionName: fn.FunctionName,
 		Qualifier:    opt.Qualifier,
@@ -421,10 +433,10 @@ func (app *App) initFunctionURL(ctx context.Context, fn *Function, exists bool,
 		var nfe *types.ResourceNotFoundException
 		if errors.As(err, &nfe) {
 			if exists {
-				log.Printf("[warn] function url config for %s not found", *fn.FunctionName)
+				app.logger.Printf("[warn] function url config for %s not found", *fn.FunctionName)
 				return nil
 			} else {
-				log.Printf("[info] initializing function url config for %s", *fn.FunctionName)
+				app.logger.Printf("[info] initializing function url config for %s", *fn.FunctionName)
 				// default settings will be used
 				fc = &lambda.GetFunctionUrlConfigOutput{
 					AuthType: types.FunctionUrlAuthTypeNone,
@@ -456,7 +468,7 @@ func (app *App) initFunctionURL(ctx context.Context, fn *Function, exists bool,
 	} else {
 		name = DefaultFunctionURLFilenames[0]
 	}
-	log.Printf("[info] creating %s", name)
+	app.logger.Printf("[info] creating %s", name)
 	b, _ := marshalJSON(fu)
 	if opt.Jsonnet {
 		b, err = jsonToJsonnet(b, name)
@@ -0,0 +1,191 @@
+// Package ignore implements the pattern format of .gitignore files.
+// See https://git-scm.com/docs/gitignore#_pattern_format
+package ignore
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// Pattern represents a line of the ignore file.
+type Pattern struct {
+	// base is the directory of the ignore file (slash separated, relative to the root). "" means the root.
+	base     string
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// String returns the representation of the pattern for debugging.
+func (p *Pattern) String() string {
+	var b strings.Builder
+	if p.negate {
+		b.WriteString("!")
+	}
+	if p.base != "" {
+		b.WriteString(p.base + ":")
+	}
+	b.WriteString(strings.Join(p.segments, "/"))
+	if p.dirOnly {
+		b.WriteString("/")
+	}
+	return b.String()
+}
+
+// ParsePattern parses a line of the ignore file located in the base directory.
+// It returns nil for a blank line or a comment line.
+func ParsePattern(line, base string) *Pattern {
+	line = strings.TrimSuffix(line, "\r")
+	line = trimTrailingSpaces(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+	p := &Pattern{base: strings.Trim(base, "/")}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return nil
+	}
+	// a pattern without a slash matches at any level below the base
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	for _, s := range strings.Split(line, "/") {
+		if s == "" {
+			continue
+		}
+		p.segments = append(p.segments, convertClass(s))
+	}
+	if !anchored {
+		p.segments = append([]string{"**"}, p.segments...)
+	}
+	return p
+}
+
+// trimTrailingSpaces trims trailing spaces unless they are escaped with a backslash.
+func trimTrailingSpaces(s string) string {
+	for strings.HasSuffix(s, " ") && !strings.HasSuffix(s, `\ `) {
+		s = s[:len(s)-1]
+	}
+	if strings.HasSuffix(s, `\ `) {
+		s = s[:len(s)-2] + " "
+	}
+	return s
+}
+
+// convertClass converts the negated character class [!...] to [^...] of path.Match.
+func convertClass(s string) string {
+	return strings.ReplaceAll(s, "[!", "[^")
+}
+
+// Match reports whether the pattern matches the path (slash separated, relative to the root).
+func (p *Pattern) Match(name string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if p.base != "" {
+		if !strings.HasPrefix(name, p.base+"/") {
+			return false
+		}
+		name = strings.TrimPrefix(name, p.base+"/")
+	}
+	return matchSegments(p.segments, strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, names []string) bool {
+	if len(pattern) == 0 {
+		return len(names) == 0
+	}
+	if pattern[0] == "**" {
+		if len(pattern) == 1 {
+			// a trailing "/**" matches everything inside, but not the directory itself
+			return len(names) > 0
+		}
+		for i := 0; i <= len(names); i++ {
+			if matchSegments(pattern[1:], names[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(names) == 0 {
+		return false
+	}
+	if ok, err := path.Match(pattern[0], names[0]); err != nil || !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], names[1:])
+}
+
+// Matcher matches paths with patterns. The last matched pattern wins.
+type Matcher struct {
+	patterns []*Pattern
+}
+
+// NewMatcher creates a Matcher from lines of the ignore file located in the root.
+func NewMatcher(lines []string) *Matcher {
+	m := &Matcher{}
+	m.AddLines(lines, "")
+	return m
+}
+
+// AddLines adds patterns of the ignore file located in the base directory.
+// Patterns added later take precedence.
+func (m *Matcher) AddLines(lines []string, base string) {
+	for _, line := range lines {
+		if p := ParsePattern(line, base); p != nil {
+			m.patterns = append(m.patterns, p)
+		}
+	}
+}
+
+// AddFile adds patterns read from the ignore file located in the base directory.
+// A file which does not exist is ignored.
+func (m *Matcher) AddFile(filename, base string) error {
+	lines, err := ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	m.AddLines(lines, base)
+	return nil
+}
+
+// Match reports whether the path (slash separated, relative to the root) is ignored.
+// Parent directories of the path are not evaluated. The caller should not descend into ignored directories.
+func (m *Matcher) Match(name string, isDir bool) bool {
+	ignored := false
+	for _, p := range m.patterns {
+		if p.Match(name, isDir) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+// ReadFile reads lines of the ignore file. It returns nil when the file does not exist.
+func ReadFile(filename string) ([]string, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", filename, err)
+	}
+	var lines []string
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+	return lines, s.Err()
+}
@@ -0,0 +1,81 @@
+package ignore_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fujiwara/lambroll/ignore"
+)
+
+var matchTests = []struct {
+	lines   []string
+	name    string
+	isDir   bool
+	ignored bool
+}{
+	{[]string{"*.zip"}, "function.zip", false, true},
+	{[]string{"*.zip"}, "dir/function.zip", false, true},
+	{[]string{"*.zip", "!keep.zip"}, "dir/keep.zip", false, false},
+	{[]string{"!keep.zip", "*.zip"}, "keep.zip", false, true},
+	{[]string{"# comment", ""}, "# comment", false, false},
+	{[]string{`\#hash`}, "#hash", false, true},
+	{[]string{`\!bang`}, "!bang", false, true},
+	{[]string{"build/"}, "build", true, true},
+	{[]string{"build/"}, "build", false, false},
+	{[]string{"build/"}, "src/build", true, true},
+	{[]string{"/build"}, "build", false, true},
+	{[]string{"/build"}, "src/build", false, false},
+	{[]string{"doc/*.txt"}, "doc/a.txt", false, true},
+	{[]string{"doc/*.txt"}, "doc/sub/a.txt", false, false},
+	{[]string{"doc/*.txt"}, "src/doc/a.txt", false, false},
+	{[]string{"**/foo"}, "foo", false, true},
+	{[]string{"**/foo"}, "a/b/foo", false, true},
+	{[]string{"**/foo/bar"}, "a/foo/bar", false, true},
+	{[]string{"abc/**"}, "abc", true, false},
+	{[]string{"abc/**"}, "abc/x/y", false, true},
+	{[]string{"a/**/b"}, "a/b", false, true},
+	{[]string{"a/**/b"}, "a/x/y/b", false, true},
+	{[]string{"a/**/b"}, "x/a/b", false, false},
+	{[]string{"file?.txt"}, "file1.txt", false, true},
+	{[]string{"file[!0-9].txt"}, "file1.txt", false, false},
+	{[]string{"file[!0-9].txt"}, "filex.txt", false, true},
+	{[]string{"trailing   "}, "trailing", false, true},
+	{[]string{`space\ `}, "space ", false, true},
+}
+
+func TestMatch(t *testing.T) {
+	for _, tt := range matchTests {
+		m := ignore.NewMatcher(tt.lines)
+		if got := m.Match(tt.name, tt.isDir); got != tt.ignored {
+			t.Errorf("%q.Match(%q, %v) = %v, expected %v", tt.lines, tt.name, tt.isDir, got, tt.ignored)
+		}
+	}
+}
+
+func TestNestedFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".lambdaignore"), []byte("*.log\n!keep.txt\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := ignore.NewMatcher([]string{"*.txt"})
+	if err := m.AddFile(filepath.Join(dir, ".lambdaignore"), "sub"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddFile(filepath.Join(dir, "not-found"), "sub"); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		"a.txt":        true,
+		"sub/a.txt":    true,
+		"sub/keep.txt": false,
+		"keep.txt":     true,
+		"sub/a.log":    true,
+		"a.log":        false,
+	}
+	for name, ignored := range tests {
+		if got := m.Match(name, false); got != ignored {
+			t.Errorf("Match(%q) = %v, expected %v", name, got, ignored)
+		}
+	}
+}
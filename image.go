@@ -0,0 +1,328 @@
+package lambroll
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	pathpkg "path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// Image defines a container image built by lambroll for PackageType=Image.
+// The image is pushed to Code.ImageUri, and Code.ImageUri is replaced with the digest of the pushed image.
+type Image struct {
+	// Base is a reference of the base image (e.g. public.ecr.aws/lambda/provided:al2023). Files of --src are added to the base image.
+	Base string `json:"Base,omitempty"`
+	// Layout is a path to a local OCI image layout. The image in the layout is pushed as is.
+	Layout string `json:"Layout,omitempty"`
+	// Dir is a directory in the image where files of --src are placed (default: /var/task)
+	Dir string `json:"Dir,omitempty"`
+}
+
+// DefaultImageDir is the directory of the function code in Lambda base images
+const DefaultImageDir = "/var/task"
+
+// ecrRegistryRegexp matches the host of Amazon ECR private registries
+var ecrRegistryRegexp = regexp.MustCompile(`^\d{12}\.dkr\.ecr(?:-fips)?\.([a-z0-9-]+)\.amazonaws\.com(?:\.cn)?$`)
+
+// ecrKeychain resolves credentials of Amazon ECR private registries by GetAuthorizationToken
+type ecrKeychain struct {
+	ctx    context.Context
+	cfg    aws.Config
+	logger *log.Logger
+	mu     sync.Mutex
+	auths  map[string]authn.Authenticator
+}
+
+func (k *ecrKeychain) Resolve(res authn.Resource) (authn.Authenticator, error) {
+	host := res.RegistryStr()
+	m := ecrRegistryRegexp.FindStringSubmatch(host)
+	if m == nil {
+		return authn.Anonymous, nil
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if auth, ok := k.auths[host]; ok {
+		return auth, nil
+	}
+	k.logger.Printf("[debug] getting authorization token of %s", host)
+	svc := ecr.NewFromConfig(k.cfg, func(o *ecr.Options) {
+		o.Region = m[1]
+	})
+	out, err := svc.GetAuthorizationToken(k.ctx, &ecr.GetAuthorizationTokenInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get authorization token of %s: %w", host, err)
+	}
+	if len(out.AuthorizationData) == 0 {
+		return nil, fmt.Errorf("no authorization data of %s", host)
+	}
+	b, err := base64.StdEncoding.DecodeString(aws.ToString(out.AuthorizationData[0].AuthorizationToken))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode authorization token of %s: %w", host, err)
+	}
+	user, pass, _ := strings.Cut(string(b), ":")
+	auth := authn.FromConfig(authn.AuthConfig{Username: user, Password: pass})
+	k.auths[host] = auth
+	return auth, nil
+}
+
+func (app *App) imageKeychain(ctx context.Context) authn.Keychain {
+	return authn.NewMultiKeychain(
+		&ecrKeychain{ctx: ctx, cfg: app.awsConfig, logger: app.logger, auths: make(map[string]authn.Authenticator)},
+		authn.DefaultKeychain,
+	)
+}
+
+// imagePlatform returns the platform of the image for the architecture of the function
+func imagePlatform(fn *Function) (v1.Platform, error) {
+	arch, err := goarch(fn)
+	if err != nil {
+		return v1.Platform{}, err
+	}
+	return v1.Platform{OS: "linux", Architecture: arch}, nil
+}
+
+// buildImage builds the container image of the function
+func (app *App) buildImage(ctx context.Context, fn *FunctionDefinition, src string, opt *BuildOption, keychain authn.Keychain) (v1.Image, error) {
+	platform, err := imagePlatform(&fn.Function)
+	if err != nil {
+		return nil, err
+	}
+	if p := fn.Image.Layout; p != "" {
+		return app.imageFromLayout(joinPath(app.functionDir(), p), platform)
+	}
+	if fn.Image.Base == "" {
+		return nil, fmt.Errorf("Image.Base or Image.Layout is required")
+	}
+	baseRef, err := name.ParseReference(fn.Image.Base)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base image %s: %w", fn.Image.Base, err)
+	}
+	app.logger.Printf("[info] pulling base image %s for %s/%s", baseRef, platform.OS, platform.Architecture)
+	base, err := remote.Image(baseRef,
+		remote.WithPlatform(platform),
+		remote.WithAuthFromKeychain(keychain),
+		remote.WithContext(ctx),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pull base image %s: %w", baseRef, err)
+	}
+
+	if err := app.prepareSources(ctx, fn, opt); err != nil {
+		return nil, err
+	}
+	zipfile, info, err := prepareZipfile(src, &opt.ZipOption)
+	if err != nil {
+		return nil, err
+	}
+	defer zipfile.Close()
+	dir := fn.Image.Dir
+	if dir == "" {
+		dir = DefaultImageDir
+	}
+	b, err := zipToTar(zipfile, info.Size(), dir)
+	if err != nil {
+		return nil, err
+	}
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(b)), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create layer: %w", err)
+	}
+	img, err := mutate.AppendLayers(base, layer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to append layer to base image: %w", err)
+	}
+	app.logger.Printf("[info] added files of %s to %s in the image", src, dir)
+	return img, nil
+}
+
+// imageFromLayout returns the image for the platform in the OCI image layout
+func (app *App) imageFromLayout(path string, platform v1.Platform) (v1.Image, error) {
+	app.logger.Printf("[info] loading image from OCI layout %s", path)
+	p, err := layout.FromPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load OCI layout %s: %w", path, err)
+	}
+	idx, err := p.ImageIndex()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index of %s: %w", path, err)
+	}
+	m, err := idx.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index manifest of %s: %w", path, err)
+	}
+	for _, desc := range m.Manifests {
+		if !desc.MediaType.IsImage() {
+			continue
+		}
+		if desc.Platform != nil && (desc.Platform.OS != platform.OS || desc.Platform.Architecture != platform.Architecture) {
+			continue
+		}
+		return idx.Image(desc.Digest)
+	}
+	return nil, fmt.Errorf("no image for %s/%s in %s", platform.OS, platform.Architecture, path)
+}
+
+// zipToTar converts the zip archive to a tar archive placed in dir
+func zipToTar(f *os.File, size int64, dir string) ([]byte, error) {
+	zr, err := zip.NewReader(f, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read zip archive: %w", err)
+	}
+	dir = strings.Trim(pathpkg.Clean("/"+dir), "/")
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	dirs := make(map[string]struct{})
+	var addDir func(string, *zip.File) error
+	addDir = func(d string, zf *zip.File) error {
+		if d == "." || d == "" {
+			return nil
+		}
+		if _, ok := dirs[d]; ok {
+			return nil
+		}
+		if err := addDir(pathpkg.Dir(d), zf); err != nil {
+			return err
+		}
+		dirs[d] = struct{}{}
+		return tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeDir,
+			Name:     d + "/",
+			Mode:     0755,
+			ModTime:  zf.Modified,
+		})
+	}
+	for _, zf := range zr.File {
+		name := pathpkg.Join(dir, zf.Name)
+		if err := addDir(pathpkg.Dir(name), zf); err != nil {
+			return nil, fmt.Errorf("failed to write tar header: %w", err)
+		}
+		r, err := zf.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s in zip archive: %w", zf.Name, err)
+		}
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s in zip archive: %w", zf.Name, err)
+		}
+		header := &tar.Header{
+			Name:    name,
+			Mode:    int64(zf.Mode().Perm()),
+			ModTime: zf.Modified,
+		}
+		if zf.Mode()&fs.ModeSymlink != 0 {
+			header.Typeflag = tar.TypeSymlink
+			header.Linkname = string(content)
+			content = nil
+		} else {
+			header.Typeflag = tar.TypeReg
+			header.Size = int64(len(content))
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, fmt.Errorf("failed to write tar header: %w", err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			return nil, fmt.Errorf("failed to write %s to tar: %w", name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to create tar archive: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// pushImage builds and pushes the container image of the function to Code.ImageUri,
+// and replaces Code.ImageUri with the digest of the pushed image.
+func (app *App) pushImage(ctx context.Context, fn *FunctionDefinition, opt *DeployOption) error {
+	if fn.Code == nil || fn.Code.ImageUri == nil {
+		return fmt.Errorf("Image requires Code.ImageUri in function definition to push the image")
+	}
+	ref, err := name.ParseReference(*fn.Code.ImageUri)
+	if err != nil {
+		return fmt.Errorf("invalid Code.ImageUri %s: %w", *fn.Code.ImageUri, err)
+	}
+	keychain := app.imageKeychain(ctx)
+	img, err := app.buildImage(ctx, fn, opt.Src, &opt.BuildOption, keychain)
+	if err != nil {
+		return err
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		return fmt.Errorf("failed to get digest of the image: %w", err)
+	}
+	app.logger.Printf("[info] pushing image %s (%s) %s", ref, digest, opt.label())
+	if opt.DryRun {
+		return nil
+	}
+	if err := remote.Write(ref, img,
+		remote.WithAuthFromKeychain(keychain),
+		remote.WithContext(ctx),
+	); err != nil {
+		return fmt.Errorf("failed to push image %s: %w", ref, err)
+	}
+	uri := ref.Context().Digest(digest.String()).String()
+	app.logger.Printf("[info] pushed image %s", uri)
+	fn.Code.ImageUri = aws.String(uri)
+	return nil
+}
+
+// resolveImageDigest resolves the tag of the image to the digest by the registry API.
+// The image referenced by the digest is returned as is.
+func (app *App) resolveImageDigest(ctx context.Context, uri string) (string, error) {
+	ref, err := name.ParseReference(uri)
+	if err != nil {
+		return "", fmt.Errorf("invalid image %s: %w", uri, err)
+	}
+	if _, ok := ref.(name.Digest); ok {
+		return uri, nil
+	}
+	desc, err := remote.Head(ref,
+		remote.WithAuthFromKeychain(app.imageKeychain(ctx)),
+		remote.WithContext(ctx),
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve digest of %s: %w", uri, err)
+	}
+	return ref.Context().Digest(desc.Digest.String()).String(), nil
+}
+
+// pinImageDigest replaces the tag of Code.ImageUri with the digest which the tag points to now.
+// When the tag can not be resolved, Code.ImageUri is left as is.
+// It returns true if Code.ImageUri references the digest.
+func (app *App) pinImageDigest(ctx context.Context, fn *FunctionDefinition) bool {
+	if fn.Code == nil || fn.Code.ImageUri == nil {
+		return false
+	}
+	uri, err := app.resolveImageDigest(ctx, *fn.Code.ImageUri)
+	if err != nil {
+		app.logger.Printf("[warn] %s. using %s as is", err, *fn.Code.ImageUri)
+		return false
+	}
+	if uri != *fn.Code.ImageUri {
+		app.logger.Printf("[info] image %s is resolved to %s", *fn.Code.ImageUri, uri)
+		fn.Code.ImageUri = aws.String(uri)
+	}
+	return true
+}
@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"os"
 	"strings"
@@ -17,12 +16,13 @@ import (
 
 // InitOption represents options for Init()
 type InitOption struct {
-	FunctionName   *string `help:"Function name for init" required:"true" default:""`
-	DownloadZip    bool    `name:"download" help:"Download function.zip" default:"false"`
-	Jsonnet        bool    `help:"render function.json as jsonnet" default:"false"`
-	Qualifier      *string `help:"function version or alias"`
-	FunctionURL    bool    `help:"create function url definition file" default:"false"`
-	ForceOverwrite bool    `help:"Overwrite existing files without prompting" default:"false"`
+	FunctionName        *string `help:"Function name for init" required:"true" default:""`
+	DownloadZip         bool    `name:"download" help:"Download function.zip" default:"false"`
+	Jsonnet             bool    `help:"render function.json as jsonnet" default:"false"`
+	Qualifier           *string `help:"function version or alias"`
+	FunctionURL         bool    `help:"create function url definition file" default:"false"`
+	EventSourceMappings bool    `help:"create event source mappings definition file" default:"false"`
+	ForceOverwrite      bool    `help:"Overwrite existing files without prompting" default:"false"`
 }
 
 // Init initializes function.json
@@ -36,7 +36,7 @@ func (app *App) Init(ctx context.Context, opt *InitOption) error {
 	if err != nil {
 		var nfe *types.ResourceNotFoundException
 		if errors.As(err, &nfe) {
-			log.Printf("[info] function %s is not found", *opt.FunctionName)
+			app.logger.Printf("[info] function %s is not found", *opt.FunctionName)
 			c = &types.FunctionConfiguration{
 				FunctionName: opt.FunctionName,
 				MemorySize:   aws.Int32(128),
@@ -56,14 +56,14 @@ func (app *App) Init(ctx context.Context, opt *InitOption) error {
 			return fmt.Errorf("failed to GetFunction %s: %w", *opt.FunctionName, err)
 		}
 	} else {
-		log.Printf("[info] function %s found", *opt.FunctionName)
+		app.logger.Printf("[info] function %s found", *opt.FunctionName)
 		c = res.Configuration
 	}
 
 	var tags Tags
 	if exists {
 		arn := app.functionArn(ctx, *c.FunctionName)
-		log.Printf("[debug] listing tags of %s", arn)
+		app.logger.Printf("[debug] listing tags of %s", arn)
 		res, err := app.lambda.ListTags(ctx, &lambda.ListTagsInput{
 			Resource: aws.String(arn), // tags are not supported for alias
 		})
@@ -77,16 +77,32 @@ func (app *App) Init(ctx context.Context, opt *InitOption) error {
 	if res != nil {
 		code = res.Code
 	}
-	fn := newFunctionFrom(c, code, tags)
+	fn := &FunctionDefinition{Function: *newFunctionFrom(c, code, tags)}
+	if exists {
+		ps, err := app.getPermissions(ctx, *c.FunctionName, opt.Qualifier, nil)
+		if err != nil {
+			return err
+		}
+		if len(ps) > 0 {
+			fn.Permissions = ps
+		}
+		eics, err := app.getEventInvokeConfigs(ctx, *c.FunctionName)
+		if err != nil {
+			return err
+		}
+		if len(eics) > 0 {
+			fn.EventInvokeConfig = newEventInvokeConfigFrom(eics)
+		}
+	}
 
 	if opt.DownloadZip && res.Code != nil && *res.Code.RepositoryType == "S3" {
-		log.Printf("[info] downloading %s", FunctionZipFilename)
+		app.logger.Printf("[info] downloading %s", FunctionZipFilename)
 		if err := download(*res.Code.Location, FunctionZipFilename); err != nil {
 			return err
 		}
 	}
 
-	log.Printf("[info] creating %s", IgnoreFilename)
+	app.logger.Printf("[info] creating %s", IgnoreFilename)
 	err = app.saveFile(
 		IgnoreFilename,
 		[]byte(strings.Join(DefaultExcludes, "\n")+"\n"),
@@ -103,7 +119,7 @@ func (app *App) Init(ctx context.Context, opt *InitOption) error {
 	} else {
 		name = DefaultFunctionFilenames[0]
 	}
-	log.Printf("[info] creating %s", name)
+	app.logger.Printf("[info] creating %s", name)
 	b, _ := marshalJSON(fn)
 	if opt.Jsonnet {
 		b, err = jsonToJsonnet(b, name)
@@ -121,6 +137,12 @@ func (app *App) Init(ctx context.Context, opt *InitOption) error {
 		}
 	}
 
+	if opt.EventSourceMappings && exists {
+		if err := app.initEventSourceMappings(ctx, fn, opt); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
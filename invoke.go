@@ -7,7 +7,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"strings"
 
@@ -72,19 +71,19 @@ PAYLOAD:
 			Payload:        b,
 		}
 		in.Qualifier = opt.Qualifier
-		log.Println("[debug] invoking function", in)
+		app.logger.Println("[debug] invoking function", in)
 		res, err := app.lambda.Invoke(ctx, in)
 		if err != nil {
-			log.Println("[error] failed to invoke function", err.Error())
+			app.logger.Println("[error] failed to invoke function", err.Error())
 			continue PAYLOAD
 		}
 		stdout.Write(res.Payload)
 		stdout.Write([]byte("\n"))
 		stdout.Flush()
 
-		log.Printf("[info] StatusCode:%d", res.StatusCode)
+		app.logger.Printf("[info] StatusCode:%d", res.StatusCode)
 		if res.ExecutedVersion != nil {
-			log.Printf("[info] ExecutionVersion:%s", *res.ExecutedVersion)
+			app.logger.Printf("[info] ExecutionVersion:%s", *res.ExecutedVersion)
 		}
 		if res.LogResult != nil {
 			b, _ := base64.StdEncoding.DecodeString(*res.LogResult)
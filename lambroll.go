@@ -3,6 +3,7 @@ package lambroll
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
@@ -11,6 +12,8 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go-v2/service/lambda"
 	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
@@ -40,6 +43,33 @@ var retryPolicy = retry.Policy{
 // type Function = lambda.CreateFunctionInput
 type Function lambda.CreateFunctionInput
 
+// FunctionDefinition represents the function definition file.
+// It consists of the configuration of Lambda function and lambroll specific elements which are not sent to the Lambda API.
+type FunctionDefinition struct {
+	Function
+
+	// Alarms are CloudWatch alarm names to watch during canary deployment
+	Alarms []string `json:"Alarms,omitempty"`
+
+	// Permissions are statements of the resource-based policy to allow lambda:InvokeFunction
+	Permissions Permissions `json:"Permissions,omitempty"`
+
+	// Package defines the sources of the zip archive
+	Package *Package `json:"Package,omitempty"`
+
+	// Build defines a command to build the function code before creating a zip archive
+	Build *Build `json:"Build,omitempty"`
+
+	// Image defines a container image built and pushed by lambroll for PackageType=Image
+	Image *Image `json:"Image,omitempty"`
+
+	// Concurrency defines the reserved concurrency and the provisioned concurrency of aliases
+	Concurrency *Concurrency `json:"Concurrency,omitempty"`
+
+	// EventInvokeConfig defines the configuration of asynchronous invocation of the function and aliases
+	EventInvokeConfig *EventInvokeConfig `json:"EventInvokeConfig,omitempty"`
+}
+
 // Tags represents tags of function
 type Tags map[string]string
 
@@ -56,6 +86,9 @@ var (
 	// IgnoreFilename defines file name includes ignore patterns at creating zip archive.
 	IgnoreFilename = ".lambdaignore"
 
+	// IncludeFilename defines file name includes the sources of zip archive.
+	IncludeFilename = ".lambdainclude"
+
 	// DefaultFunctionFilename defines file name for function definition.
 	DefaultFunctionFilenames = []string{
 		"function.json",
@@ -67,16 +100,31 @@ var (
 		"function_url.jsonnet",
 	}
 
+	DefaultEventSourceMappingsFilenames = []string{
+		"event_source_mappings.json",
+		"event_source_mappings.jsonnet",
+	}
+
+	DefaultLayerFilenames = []string{
+		"layer.json",
+		"layer.jsonnet",
+	}
+
 	// FunctionZipFilename defines file name for zip archive downloaded at init.
 	FunctionZipFilename = "function.zip"
 
 	// DefaultExcludes is a preset excludes file list
 	DefaultExcludes = []string{
 		IgnoreFilename,
+		IncludeFilename,
 		DefaultFunctionFilenames[0],
 		DefaultFunctionFilenames[1],
 		DefaultFunctionURLFilenames[0],
 		DefaultFunctionURLFilenames[1],
+		DefaultEventSourceMappingsFilenames[0],
+		DefaultEventSourceMappingsFilenames[1],
+		DefaultLayerFilenames[0],
+		DefaultLayerFilenames[1],
 		FunctionZipFilename,
 		".git/*",
 		".terraform/*",
@@ -90,17 +138,19 @@ var (
 // App represents lambroll application
 type App struct {
 	callerIdentity *CallerIdentity
-	profile        string
 	loader         *config.Loader
 
-	awsConfig aws.Config
-	lambda    *lambda.Client
+	awsConfig  aws.Config
+	lambda     LambdaAPI
+	cloudwatch CloudWatchAPI
 
 	extStr      map[string]string
 	extCode     map[string]string
 	nativeFuncs []*jsonnet.NativeFunction
 
 	functionFilePath string
+	stdout           io.Writer
+	logger           *log.Logger
 }
 
 func newAwsConfig(ctx context.Context, opt *Option) (aws.Config, error) {
@@ -113,7 +163,8 @@ func newAwsConfig(ctx context.Context, opt *Option) (aws.Config, error) {
 	}
 	if opt.Endpoint != nil && *opt.Endpoint != "" {
 		customResolver := aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
-			if service == lambda.ServiceID || service == sts.ServiceID || service == s3.ServiceID {
+			switch service {
+			case lambda.ServiceID, sts.ServiceID, s3.ServiceID, cloudwatch.ServiceID, cloudwatchlogs.ServiceID:
 				return aws.Endpoint{
 					PartitionID:   "aws",
 					URL:           *opt.Endpoint,
@@ -144,11 +195,6 @@ func New(ctx context.Context, opt *Option) (*App, error) {
 		return nil, err
 	}
 
-	var profile string
-	if opt.Profile != nil && *opt.Profile != "" {
-		profile = *opt.Profile
-	}
-
 	loader := config.New()
 	nativeFuncs := DefaultJsonnetNativeFuncs()
 
@@ -197,28 +243,65 @@ func New(ctx context.Context, opt *Option) (*App, error) {
 
 	app := &App{
 		callerIdentity:   callerIdentity,
-		profile:          profile,
 		loader:           loader,
 		awsConfig:        v2cfg,
 		lambda:           lambda.NewFromConfig(v2cfg),
+		cloudwatch:       cloudwatch.NewFromConfig(v2cfg),
 		functionFilePath: opt.Function,
 		nativeFuncs:      nativeFuncs,
 		extStr:           opt.ExtStr,
 		extCode:          opt.ExtCode,
+		stdout:           os.Stdout,
+		logger:           log.Default(),
 	}
+
+	// resolve the latest version of layers by the Lambda API of the app
+	layers := &layerResolver{app: app, arns: make(map[string]string)}
+	loader.Funcs(layers.FuncMap(ctx))
+	app.nativeFuncs = append(app.nativeFuncs, layers.JsonnetNativeFuncs(ctx)...)
 	return app, nil
 }
 
+// SetLambdaAPI replaces the Lambda API client of the application.
+// It is useful to run lambroll against a fake implementation (see lambrolltest package).
+func (app *App) SetLambdaAPI(api LambdaAPI) {
+	app.lambda = api
+}
+
+// SetCloudWatchAPI replaces the CloudWatch API client of the application.
+// CloudWatch alarms are watched during canary deployment.
+func (app *App) SetCloudWatchAPI(api CloudWatchAPI) {
+	app.cloudwatch = api
+}
+
+// CallerIdentity returns the caller identity of the application
+func (app *App) CallerIdentity() *CallerIdentity {
+	return app.callerIdentity
+}
+
 // AWSAccountID returns AWS account ID in current session
 func (app *App) AWSAccountID(ctx context.Context) string {
 	return app.callerIdentity.Account(ctx)
 }
 
 func loadDefinitionFile[T any](app *App, path string, defaults []string) (*T, error) {
+	src, path, err := app.renderDefinitionFile(path, defaults)
+	if err != nil {
+		return nil, err
+	}
+	var v T
+	if err := unmarshalJSON(src, &v, path, app.logger); err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", path, err)
+	}
+	return &v, nil
+}
+
+// renderDefinitionFile renders the definition file as JSON, and returns it with the path of the file
+func (app *App) renderDefinitionFile(path string, defaults []string) ([]byte, string, error) {
 	if path == "" {
 		p, err := findDefinitionFile("", defaults)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 		path = p
 	}
@@ -241,27 +324,23 @@ func loadDefinitionFile[T any](app *App, path string, defaults []string) (*T, er
 		}
 		jsonStr, err := vm.EvaluateFile(path)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 		src, err = app.loader.ReadWithEnvBytes([]byte(jsonStr))
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 	default:
 		src, err = app.loader.ReadWithEnv(path)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 	}
-	var v T
-	if err := unmarshalJSON(src, &v, path); err != nil {
-		return nil, fmt.Errorf("failed to load %s: %w", path, err)
-	}
-	return &v, nil
+	return src, path, nil
 }
 
-func (app *App) loadFunction(path string) (*Function, error) {
-	return loadDefinitionFile[Function](app, path, DefaultFunctionFilenames)
+func (app *App) loadFunction(path string) (*FunctionDefinition, error) {
+	return loadDefinitionFile[FunctionDefinition](app, path, DefaultFunctionFilenames)
 }
 
 func newFunctionFrom(c *types.FunctionConfiguration, code *types.FunctionCodeLocation, tags Tags) *Function {
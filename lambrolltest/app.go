@@ -0,0 +1,30 @@
+package lambrolltest
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/fujiwara/lambroll"
+)
+
+// NewApp creates a lambroll application which runs against the fake.
+// The caller identity of the application is resolved to the account of the fake without STS.
+func NewApp(ctx context.Context, opt *lambroll.Option, fake *FakeLambda) (*lambroll.App, error) {
+	if opt.Region == nil || *opt.Region == "" {
+		opt.Region = aws.String(fake.Region)
+	}
+	app, err := lambroll.New(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+	app.SetLambdaAPI(fake)
+	app.CallerIdentity().Resolver = func(_ context.Context) (*sts.GetCallerIdentityOutput, error) {
+		return &sts.GetCallerIdentityOutput{
+			Account: aws.String(fake.AccountID),
+			Arn:     aws.String("arn:aws:iam::" + fake.AccountID + ":user/lambrolltest"),
+			UserId:  aws.String("AIDAXXXXXXXXXXXXXXXXX"),
+		}, nil
+	}
+	return app, nil
+}
@@ -0,0 +1,52 @@
+package lambrolltest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/fujiwara/lambroll"
+)
+
+// FakeCloudWatch is an in-memory implementation of lambroll.CloudWatchAPI.
+// It holds the states of metric alarms.
+type FakeCloudWatch struct {
+	mu     sync.Mutex
+	alarms map[string]cwtypes.StateValue
+}
+
+var _ lambroll.CloudWatchAPI = (*FakeCloudWatch)(nil)
+
+// NewFakeCloudWatch creates a new FakeCloudWatch
+func NewFakeCloudWatch() *FakeCloudWatch {
+	return &FakeCloudWatch{
+		alarms: make(map[string]cwtypes.StateValue),
+	}
+}
+
+// SetAlarmState sets the state of the metric alarm. The alarm is created when it does not exist.
+func (f *FakeCloudWatch) SetAlarmState(name string, state cwtypes.StateValue) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.alarms[name] = state
+}
+
+// DescribeAlarms returns the metric alarms specified by AlarmNames
+func (f *FakeCloudWatch) DescribeAlarms(ctx context.Context, in *cloudwatch.DescribeAlarmsInput, _ ...func(*cloudwatch.Options)) (*cloudwatch.DescribeAlarmsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := &cloudwatch.DescribeAlarmsOutput{}
+	for _, name := range in.AlarmNames {
+		state, ok := f.alarms[name]
+		if !ok {
+			continue
+		}
+		out.MetricAlarms = append(out.MetricAlarms, cwtypes.MetricAlarm{
+			AlarmName:  aws.String(name),
+			StateValue: state,
+		})
+	}
+	return out, nil
+}
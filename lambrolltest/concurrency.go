@@ -0,0 +1,111 @@
+package lambrolltest
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// PutFunctionConcurrency sets the reserved concurrency of the function
+func (f *FakeLambda) PutFunctionConcurrency(ctx context.Context, in *lambda.PutFunctionConcurrencyInput, _ ...func(*lambda.Options)) (*lambda.PutFunctionConcurrencyOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn, _, err := f.lookup(in.FunctionName, nil)
+	if err != nil {
+		return nil, err
+	}
+	if in.ReservedConcurrentExecutions == nil || *in.ReservedConcurrentExecutions < 0 {
+		return nil, invalidParameter("ReservedConcurrentExecutions must be greater than or equal to 0")
+	}
+	fn.reserved = aws.Int32(*in.ReservedConcurrentExecutions)
+	return &lambda.PutFunctionConcurrencyOutput{ReservedConcurrentExecutions: fn.reserved}, nil
+}
+
+// GetFunctionConcurrency returns the reserved concurrency of the function
+func (f *FakeLambda) GetFunctionConcurrency(ctx context.Context, in *lambda.GetFunctionConcurrencyInput, _ ...func(*lambda.Options)) (*lambda.GetFunctionConcurrencyOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn, _, err := f.lookup(in.FunctionName, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &lambda.GetFunctionConcurrencyOutput{ReservedConcurrentExecutions: fn.reserved}, nil
+}
+
+// PutProvisionedConcurrencyConfig sets the provisioned concurrency of the alias or the version.
+// The provisioned concurrency is READY immediately.
+func (f *FakeLambda) PutProvisionedConcurrencyConfig(ctx context.Context, in *lambda.PutProvisionedConcurrencyConfigInput, _ ...func(*lambda.Options)) (*lambda.PutProvisionedConcurrencyConfigOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn, q, err := f.lookup(in.FunctionName, in.Qualifier)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := fn.resolve(q); !ok {
+		return nil, notFound("Function not found: %s", f.qualifiedArn(fn, q))
+	} else if v == versionLatest {
+		return nil, invalidParameter("Provisioned Concurrency Configs cannot be applied to unpublished function versions.")
+	}
+	n := aws.ToInt32(in.ProvisionedConcurrentExecutions)
+	if n <= 0 {
+		return nil, invalidParameter("ProvisionedConcurrentExecutions must be greater than 0")
+	}
+	if fn.reserved != nil && n > *fn.reserved {
+		return nil, invalidParameter("ProvisionedConcurrentExecutions %d exceeds the reserved concurrency %d", n, *fn.reserved)
+	}
+	c := &types.ProvisionedConcurrencyConfigListItem{
+		FunctionArn:                              aws.String(f.qualifiedArn(fn, q)),
+		RequestedProvisionedConcurrentExecutions: aws.Int32(n),
+		AllocatedProvisionedConcurrentExecutions: aws.Int32(n),
+		AvailableProvisionedConcurrentExecutions: aws.Int32(n),
+		Status:                                   types.ProvisionedConcurrencyStatusEnumReady,
+		LastModified:                             aws.String(time.Now().Format(lastModifiedFormat)),
+	}
+	fn.provisioned[q] = c
+	var out lambda.PutProvisionedConcurrencyConfigOutput
+	convert(c, &out)
+	return &out, nil
+}
+
+// GetProvisionedConcurrencyConfig returns the provisioned concurrency of the alias or the version
+func (f *FakeLambda) GetProvisionedConcurrencyConfig(ctx context.Context, in *lambda.GetProvisionedConcurrencyConfigInput, _ ...func(*lambda.Options)) (*lambda.GetProvisionedConcurrencyConfigOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn, q, err := f.lookup(in.FunctionName, in.Qualifier)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := fn.resolve(q); !ok {
+		return nil, notFound("Function not found: %s", f.qualifiedArn(fn, q))
+	}
+	c, ok := fn.provisioned[q]
+	if !ok {
+		return nil, &types.ProvisionedConcurrencyConfigNotFoundException{
+			Message: aws.String(fmt.Sprintf("No Provisioned Concurrency Config found for this function: %s", f.qualifiedArn(fn, q))),
+		}
+	}
+	var out lambda.GetProvisionedConcurrencyConfigOutput
+	convert(c, &out)
+	return &out, nil
+}
+
+// DeleteProvisionedConcurrencyConfig deletes the provisioned concurrency of the alias or the version
+func (f *FakeLambda) DeleteProvisionedConcurrencyConfig(ctx context.Context, in *lambda.DeleteProvisionedConcurrencyConfigInput, _ ...func(*lambda.Options)) (*lambda.DeleteProvisionedConcurrencyConfigOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn, q, err := f.lookup(in.FunctionName, in.Qualifier)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := fn.provisioned[q]; !ok {
+		return nil, &types.ProvisionedConcurrencyConfigNotFoundException{
+			Message: aws.String(fmt.Sprintf("No Provisioned Concurrency Config found for this function: %s", f.qualifiedArn(fn, q))),
+		}
+	}
+	delete(fn.provisioned, q)
+	return &lambda.DeleteProvisionedConcurrencyConfigOutput{}, nil
+}
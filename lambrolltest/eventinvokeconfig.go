@@ -0,0 +1,86 @@
+package lambrolltest
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// PutFunctionEventInvokeConfig replaces the configuration of asynchronous invocation of the function, the alias or the version
+func (f *FakeLambda) PutFunctionEventInvokeConfig(ctx context.Context, in *lambda.PutFunctionEventInvokeConfigInput, _ ...func(*lambda.Options)) (*lambda.PutFunctionEventInvokeConfigOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn, q, err := f.lookup(in.FunctionName, in.Qualifier)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := fn.resolve(q); !ok {
+		return nil, notFound("Function not found: %s", f.qualifiedArn(fn, q))
+	}
+	if v := in.MaximumRetryAttempts; v != nil && (*v < 0 || *v > 2) {
+		return nil, invalidParameter("MaximumRetryAttempts must be between 0 and 2")
+	}
+	if v := in.MaximumEventAgeInSeconds; v != nil && (*v < 60 || *v > 21600) {
+		return nil, invalidParameter("MaximumEventAgeInSeconds must be between 60 and 21600")
+	}
+	if q == versionLatest {
+		q = ""
+	}
+	arn := f.qualifiedArn(fn, q)
+	if q == "" {
+		arn = f.qualifiedArn(fn, versionLatest)
+	}
+	c := &types.FunctionEventInvokeConfig{
+		FunctionArn:              aws.String(arn),
+		DestinationConfig:        in.DestinationConfig,
+		MaximumEventAgeInSeconds: in.MaximumEventAgeInSeconds,
+		MaximumRetryAttempts:     in.MaximumRetryAttempts,
+		LastModified:             aws.Time(time.Now()),
+	}
+	fn.invokeConfigs[q] = c
+	var out lambda.PutFunctionEventInvokeConfigOutput
+	convert(c, &out)
+	return &out, nil
+}
+
+// ListFunctionEventInvokeConfigs lists the configurations of asynchronous invocation of the function
+func (f *FakeLambda) ListFunctionEventInvokeConfigs(ctx context.Context, in *lambda.ListFunctionEventInvokeConfigsInput, _ ...func(*lambda.Options)) (*lambda.ListFunctionEventInvokeConfigsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn, _, err := f.lookup(in.FunctionName, nil)
+	if err != nil {
+		return nil, err
+	}
+	qs := make([]string, 0, len(fn.invokeConfigs))
+	for q := range fn.invokeConfigs {
+		qs = append(qs, q)
+	}
+	sort.Strings(qs)
+	out := &lambda.ListFunctionEventInvokeConfigsOutput{}
+	for _, q := range qs {
+		out.FunctionEventInvokeConfigs = append(out.FunctionEventInvokeConfigs, *fn.invokeConfigs[q])
+	}
+	return out, nil
+}
+
+// DeleteFunctionEventInvokeConfig deletes the configuration of asynchronous invocation of the function, the alias or the version
+func (f *FakeLambda) DeleteFunctionEventInvokeConfig(ctx context.Context, in *lambda.DeleteFunctionEventInvokeConfigInput, _ ...func(*lambda.Options)) (*lambda.DeleteFunctionEventInvokeConfigOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn, q, err := f.lookup(in.FunctionName, in.Qualifier)
+	if err != nil {
+		return nil, err
+	}
+	if q == versionLatest {
+		q = ""
+	}
+	if _, ok := fn.invokeConfigs[q]; !ok {
+		return nil, notFound("The function %s doesn't have an EventInvokeConfig", f.qualifiedArn(fn, q))
+	}
+	delete(fn.invokeConfigs, q)
+	return &lambda.DeleteFunctionEventInvokeConfigOutput{}, nil
+}
@@ -0,0 +1,147 @@
+package lambrolltest
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+func (f *FakeLambda) findEventSourceMapping(uuid *string) (int, error) {
+	for i, m := range f.eventSourceMappings {
+		if aws.ToString(m.UUID) == aws.ToString(uuid) {
+			return i, nil
+		}
+	}
+	return 0, notFound("The resource you requested does not exist. (Service: Lambda, Status Code: 404, Request ID: %s)", aws.ToString(uuid))
+}
+
+// qualifiedFunctionArn returns the ARN of the function name with the qualifier
+func (f *FakeLambda) qualifiedFunctionArn(functionName *string) (string, error) {
+	fn, q, err := f.lookup(functionName, nil)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := fn.resolve(q); !ok {
+		return "", notFound("Function not found: %s", f.qualifiedArn(fn, q))
+	}
+	return f.qualifiedArn(fn, q), nil
+}
+
+// CreateEventSourceMapping creates an event source mapping. The mapping is Enabled immediately.
+func (f *FakeLambda) CreateEventSourceMapping(ctx context.Context, in *lambda.CreateEventSourceMappingInput, _ ...func(*lambda.Options)) (*lambda.CreateEventSourceMappingOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	functionArn, err := f.qualifiedFunctionArn(in.FunctionName)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range f.eventSourceMappings {
+		if in.EventSourceArn != nil && aws.ToString(m.EventSourceArn) == *in.EventSourceArn && aws.ToString(m.FunctionArn) == functionArn {
+			return nil, conflict("The event source arn (%s) and function (%s) provided mapping already exists. Please update or delete the existing mapping with UUID %s", *in.EventSourceArn, functionArn, aws.ToString(m.UUID))
+		}
+	}
+	var m types.EventSourceMappingConfiguration
+	convert(in, &m)
+	f.revision++
+	m.UUID = aws.String(fmt.Sprintf("00000000-0000-0000-0000-%012d", f.revision))
+	m.FunctionArn = aws.String(functionArn)
+	m.State = aws.String("Enabled")
+	if in.Enabled != nil && !*in.Enabled {
+		m.State = aws.String("Disabled")
+	}
+	if m.BatchSize == nil {
+		m.BatchSize = aws.Int32(10)
+	}
+	m.LastModified = aws.Time(time.Now())
+	f.eventSourceMappings = append(f.eventSourceMappings, &m)
+	var out lambda.CreateEventSourceMappingOutput
+	convert(m, &out)
+	return &out, nil
+}
+
+// UpdateEventSourceMapping updates the event source mapping
+func (f *FakeLambda) UpdateEventSourceMapping(ctx context.Context, in *lambda.UpdateEventSourceMappingInput, _ ...func(*lambda.Options)) (*lambda.UpdateEventSourceMappingOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i, err := f.findEventSourceMapping(in.UUID)
+	if err != nil {
+		return nil, err
+	}
+	m := *f.eventSourceMappings[i]
+	var update types.EventSourceMappingConfiguration
+	convert(in, &update)
+	// overwrite fields specified
+	fields := map[string]any{}
+	convert(update, &fields)
+	for k, v := range fields {
+		if v == nil || v == "" {
+			delete(fields, k)
+		}
+	}
+	convert(fields, &m)
+	if in.FunctionName != nil {
+		functionArn, err := f.qualifiedFunctionArn(in.FunctionName)
+		if err != nil {
+			return nil, err
+		}
+		m.FunctionArn = aws.String(functionArn)
+	}
+	if in.Enabled != nil {
+		if *in.Enabled {
+			m.State = aws.String("Enabled")
+		} else {
+			m.State = aws.String("Disabled")
+		}
+	}
+	m.UUID = in.UUID
+	m.LastModified = aws.Time(time.Now())
+	f.eventSourceMappings[i] = &m
+	var out lambda.UpdateEventSourceMappingOutput
+	convert(m, &out)
+	return &out, nil
+}
+
+// DeleteEventSourceMapping deletes the event source mapping
+func (f *FakeLambda) DeleteEventSourceMapping(ctx context.Context, in *lambda.DeleteEventSourceMappingInput, _ ...func(*lambda.Options)) (*lambda.DeleteEventSourceMappingOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i, err := f.findEventSourceMapping(in.UUID)
+	if err != nil {
+		return nil, err
+	}
+	m := f.eventSourceMappings[i]
+	f.eventSourceMappings = append(f.eventSourceMappings[:i], f.eventSourceMappings[i+1:]...)
+	var out lambda.DeleteEventSourceMappingOutput
+	convert(m, &out)
+	out.State = aws.String("Deleting")
+	return &out, nil
+}
+
+// ListEventSourceMappings lists event source mappings of the function (exact match with the qualifier)
+func (f *FakeLambda) ListEventSourceMappings(ctx context.Context, in *lambda.ListEventSourceMappingsInput, _ ...func(*lambda.Options)) (*lambda.ListEventSourceMappingsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var functionArn string
+	if in.FunctionName != nil {
+		fn, q, err := f.lookup(in.FunctionName, nil)
+		if err != nil {
+			return nil, err
+		}
+		functionArn = f.qualifiedArn(fn, q)
+	}
+	out := &lambda.ListEventSourceMappingsOutput{}
+	for _, m := range f.eventSourceMappings {
+		if functionArn != "" && aws.ToString(m.FunctionArn) != functionArn {
+			continue
+		}
+		if in.EventSourceArn != nil && aws.ToString(m.EventSourceArn) != *in.EventSourceArn {
+			continue
+		}
+		out.EventSourceMappings = append(out.EventSourceMappings, *m)
+	}
+	return out, nil
+}
@@ -0,0 +1,222 @@
+package lambrolltest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/fujiwara/lambroll"
+)
+
+type urlConfig struct {
+	AuthType         types.FunctionUrlAuthType
+	Cors             *types.Cors
+	InvokeMode       types.InvokeMode
+	FunctionArn      *string
+	FunctionUrl      *string
+	CreationTime     *string
+	LastModifiedTime *string
+}
+
+var accountIDPattern = regexp.MustCompile(`^[0-9]{12}$`)
+
+func (f *FakeLambda) qualifiedArn(fn *function, qualifier string) string {
+	if qualifier == "" {
+		return aws.ToString(fn.latest.FunctionArn)
+	}
+	return aws.ToString(fn.latest.FunctionArn) + ":" + qualifier
+}
+
+// CreateFunctionUrlConfig creates a function URL config
+func (f *FakeLambda) CreateFunctionUrlConfig(ctx context.Context, in *lambda.CreateFunctionUrlConfigInput, _ ...func(*lambda.Options)) (*lambda.CreateFunctionUrlConfigOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn, q, err := f.lookup(in.FunctionName, in.Qualifier)
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := fn.urlConfigs[q]; exists {
+		return nil, conflict("Failed to create function url config for [functionArn = %s]. Error message: FunctionUrlConfig exists for this Lambda function", f.qualifiedArn(fn, q))
+	}
+	if in.AuthType == "" {
+		return nil, invalidParameter("AuthType is required")
+	}
+	now := aws.String(time.Now().Format(time.RFC3339))
+	c := &urlConfig{
+		AuthType:         in.AuthType,
+		Cors:             in.Cors,
+		InvokeMode:       in.InvokeMode,
+		FunctionArn:      aws.String(f.qualifiedArn(fn, q)),
+		FunctionUrl:      aws.String(fmt.Sprintf("https://%s.lambda-url.%s.on.aws/", strings.ToLower(aws.ToString(fn.latest.FunctionName)), f.Region)),
+		CreationTime:     now,
+		LastModifiedTime: now,
+	}
+	if c.InvokeMode == "" {
+		c.InvokeMode = types.InvokeModeBuffered
+	}
+	fn.urlConfigs[q] = c
+	var out lambda.CreateFunctionUrlConfigOutput
+	convert(c, &out)
+	return &out, nil
+}
+
+// GetFunctionUrlConfig returns the function URL config
+func (f *FakeLambda) GetFunctionUrlConfig(ctx context.Context, in *lambda.GetFunctionUrlConfigInput, _ ...func(*lambda.Options)) (*lambda.GetFunctionUrlConfigOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn, q, err := f.lookup(in.FunctionName, in.Qualifier)
+	if err != nil {
+		return nil, err
+	}
+	c, ok := fn.urlConfigs[q]
+	if !ok {
+		return nil, notFound("The resource you requested does not exist.")
+	}
+	var out lambda.GetFunctionUrlConfigOutput
+	convert(c, &out)
+	return &out, nil
+}
+
+// UpdateFunctionUrlConfig updates the function URL config
+func (f *FakeLambda) UpdateFunctionUrlConfig(ctx context.Context, in *lambda.UpdateFunctionUrlConfigInput, _ ...func(*lambda.Options)) (*lambda.UpdateFunctionUrlConfigOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn, q, err := f.lookup(in.FunctionName, in.Qualifier)
+	if err != nil {
+		return nil, err
+	}
+	c, ok := fn.urlConfigs[q]
+	if !ok {
+		return nil, notFound("The resource you requested does not exist.")
+	}
+	if in.AuthType != "" {
+		c.AuthType = in.AuthType
+	}
+	if in.InvokeMode != "" {
+		c.InvokeMode = in.InvokeMode
+	}
+	if in.Cors != nil {
+		if isEmptyCors(in.Cors) {
+			c.Cors = nil
+		} else {
+			c.Cors = in.Cors
+		}
+	}
+	c.LastModifiedTime = aws.String(time.Now().Format(time.RFC3339))
+	var out lambda.UpdateFunctionUrlConfigOutput
+	convert(c, &out)
+	return &out, nil
+}
+
+func isEmptyCors(c *types.Cors) bool {
+	return c.AllowCredentials == nil && len(c.AllowHeaders) == 0 && len(c.AllowMethods) == 0 &&
+		len(c.AllowOrigins) == 0 && len(c.ExposeHeaders) == 0 && c.MaxAge == nil
+}
+
+func principal(p string) any {
+	switch {
+	case p == "*":
+		return p
+	case accountIDPattern.MatchString(p):
+		return map[string]any{"AWS": fmt.Sprintf("arn:aws:iam::%s:root", p)}
+	case strings.HasPrefix(p, "arn:"):
+		return map[string]any{"AWS": p}
+	default:
+		return map[string]any{"Service": p}
+	}
+}
+
+// AddPermission adds a statement to the resource-based policy of the function
+func (f *FakeLambda) AddPermission(ctx context.Context, in *lambda.AddPermissionInput, _ ...func(*lambda.Options)) (*lambda.AddPermissionOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn, q, err := f.lookup(in.FunctionName, in.Qualifier)
+	if err != nil {
+		return nil, err
+	}
+	sid := aws.ToString(in.StatementId)
+	for _, st := range fn.policies[q] {
+		if st.Sid == sid {
+			return nil, conflict("The statement id (%s) provided already exists. Please provide a new statement id, or remove the existing statement.", sid)
+		}
+	}
+	st := lambroll.PolicyStatement{
+		Sid:       sid,
+		Effect:    "Allow",
+		Principal: principal(aws.ToString(in.Principal)),
+		Action:    aws.ToString(in.Action),
+		Resource:  f.qualifiedArn(fn, q),
+	}
+	condition := map[string]any{}
+	stringEquals := map[string]any{}
+	if in.FunctionUrlAuthType != "" {
+		stringEquals["lambda:FunctionUrlAuthType"] = string(in.FunctionUrlAuthType)
+	}
+	if in.PrincipalOrgID != nil {
+		stringEquals["aws:PrincipalOrgID"] = *in.PrincipalOrgID
+	}
+	if in.SourceAccount != nil {
+		stringEquals["AWS:SourceAccount"] = *in.SourceAccount
+	}
+	if in.EventSourceToken != nil {
+		stringEquals["lambda:EventSourceToken"] = *in.EventSourceToken
+	}
+	if len(stringEquals) > 0 {
+		condition["StringEquals"] = stringEquals
+	}
+	if in.SourceArn != nil {
+		condition["ArnLike"] = map[string]any{"AWS:SourceArn": *in.SourceArn}
+	}
+	if len(condition) > 0 {
+		st.Condition = condition
+	}
+	fn.policies[q] = append(fn.policies[q], st)
+	b, _ := json.Marshal(st)
+	return &lambda.AddPermissionOutput{Statement: aws.String(string(b))}, nil
+}
+
+// RemovePermission removes a statement from the resource-based policy of the function
+func (f *FakeLambda) RemovePermission(ctx context.Context, in *lambda.RemovePermissionInput, _ ...func(*lambda.Options)) (*lambda.RemovePermissionOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn, q, err := f.lookup(in.FunctionName, in.Qualifier)
+	if err != nil {
+		return nil, err
+	}
+	sid := aws.ToString(in.StatementId)
+	for i, st := range fn.policies[q] {
+		if st.Sid == sid {
+			fn.policies[q] = append(fn.policies[q][:i], fn.policies[q][i+1:]...)
+			return &lambda.RemovePermissionOutput{}, nil
+		}
+	}
+	return nil, notFound("Statement %s is not found in resource policy.", sid)
+}
+
+// GetPolicy returns the resource-based policy of the function
+func (f *FakeLambda) GetPolicy(ctx context.Context, in *lambda.GetPolicyInput, _ ...func(*lambda.Options)) (*lambda.GetPolicyOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn, q, err := f.lookup(in.FunctionName, in.Qualifier)
+	if err != nil {
+		return nil, err
+	}
+	if len(fn.policies[q]) == 0 {
+		return nil, notFound("The resource you requested does not exist.")
+	}
+	b, _ := json.Marshal(lambroll.PolicyOutput{
+		Id:        "default",
+		Version:   "2012-10-17",
+		Statement: fn.policies[q],
+	})
+	return &lambda.GetPolicyOutput{
+		Policy:     aws.String(string(b)),
+		RevisionId: f.nextRevision(),
+	}, nil
+}
@@ -0,0 +1,707 @@
+// Package lambrolltest provides an in-memory fake of the Lambda API for testing lambroll.
+package lambrolltest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/fujiwara/lambroll"
+)
+
+const (
+	// DefaultAccountID is an AWS account ID of the fake
+	DefaultAccountID = "123456789012"
+	// DefaultRegion is a region of the fake
+	DefaultRegion = "ap-northeast-1"
+
+	versionLatest      = "$LATEST"
+	lastModifiedFormat = "2006-01-02T15:04:05.999-0700"
+)
+
+// FakeLambda is an in-memory implementation of lambroll.LambdaAPI.
+// Function updates complete immediately (State=Active, LastUpdateStatus=Successful).
+type FakeLambda struct {
+	AccountID string
+	Region    string
+
+	// InvokeFunc handles Invoke. When nil, Invoke returns the payload as is.
+	InvokeFunc func(ctx context.Context, in *lambda.InvokeInput) (*lambda.InvokeOutput, error)
+
+	mu                  sync.Mutex
+	functions           map[string]*function
+	eventSourceMappings []*types.EventSourceMappingConfiguration
+	layers              map[string]*layer
+	revision            int
+}
+
+var _ lambroll.LambdaAPI = (*FakeLambda)(nil)
+
+type function struct {
+	latest         types.FunctionConfiguration
+	code           types.FunctionCodeLocation
+	versions       []types.FunctionConfiguration
+	codes          map[string]types.FunctionCodeLocation
+	lastVersion    int
+	publishedState string
+	aliases        map[string]*types.AliasConfiguration
+	tags           map[string]string
+	urlConfigs     map[string]*urlConfig
+	policies       map[string][]lambroll.PolicyStatement
+	reserved       *int32
+	provisioned    map[string]*types.ProvisionedConcurrencyConfigListItem
+	invokeConfigs  map[string]*types.FunctionEventInvokeConfig
+}
+
+// NewFakeLambda creates a FakeLambda with no functions
+func NewFakeLambda() *FakeLambda {
+	return &FakeLambda{
+		AccountID: DefaultAccountID,
+		Region:    DefaultRegion,
+		functions: make(map[string]*function),
+		layers:    make(map[string]*layer),
+	}
+}
+
+func notFound(format string, args ...any) error {
+	return &types.ResourceNotFoundException{Message: aws.String(fmt.Sprintf(format, args...))}
+}
+
+func conflict(format string, args ...any) error {
+	return &types.ResourceConflictException{Message: aws.String(fmt.Sprintf(format, args...))}
+}
+
+func preconditionFailed(format string, args ...any) error {
+	return &types.PreconditionFailedException{Message: aws.String(fmt.Sprintf(format, args...))}
+}
+
+func invalidParameter(format string, args ...any) error {
+	return &types.InvalidParameterValueException{Message: aws.String(fmt.Sprintf(format, args...))}
+}
+
+// convert copies fields of src to dst which have the same names, by JSON.
+func convert(src, dst any) {
+	b, err := json.Marshal(src)
+	if err != nil {
+		panic(err)
+	}
+	if err := json.Unmarshal(b, dst); err != nil {
+		panic(err)
+	}
+}
+
+func (f *FakeLambda) nextRevision() *string {
+	f.revision++
+	return aws.String(fmt.Sprintf("00000000-0000-0000-0000-%012d", f.revision))
+}
+
+func (f *FakeLambda) functionArn(name string) string {
+	return fmt.Sprintf("arn:aws:lambda:%s:%s:function:%s", f.Region, f.AccountID, name)
+}
+
+// parseFunctionName parses a function name, a partial ARN or an ARN into a name and a qualifier.
+func parseFunctionName(s string) (string, string) {
+	if strings.HasPrefix(s, "arn:") {
+		// arn:aws:lambda:region:account:function:name[:qualifier]
+		parts := strings.Split(s, ":")
+		if len(parts) >= 8 {
+			return parts[6], parts[7]
+		} else if len(parts) == 7 {
+			return parts[6], ""
+		}
+		return s, ""
+	}
+	name, qualifier, _ := strings.Cut(s, ":")
+	return name, qualifier
+}
+
+func (f *FakeLambda) lookup(functionName *string, qualifier *string) (*function, string, error) {
+	name, q := parseFunctionName(aws.ToString(functionName))
+	if qualifier != nil {
+		q = *qualifier
+	}
+	fn, ok := f.functions[name]
+	if !ok {
+		return nil, "", notFound("Function not found: %s", f.functionArn(name))
+	}
+	return fn, q, nil
+}
+
+// resolve resolves the qualifier (version or alias) to a version
+func (fn *function) resolve(qualifier string) (string, bool) {
+	if qualifier == "" || qualifier == versionLatest {
+		return versionLatest, true
+	}
+	if a, ok := fn.aliases[qualifier]; ok {
+		return aws.ToString(a.FunctionVersion), true
+	}
+	for _, v := range fn.versions {
+		if aws.ToString(v.Version) == qualifier {
+			return qualifier, true
+		}
+	}
+	return "", false
+}
+
+func (fn *function) configuration(version string) (types.FunctionConfiguration, types.FunctionCodeLocation) {
+	if version == versionLatest {
+		return fn.latest, fn.code
+	}
+	for _, v := range fn.versions {
+		if aws.ToString(v.Version) == version {
+			return v, fn.codes[version]
+		}
+	}
+	return types.FunctionConfiguration{}, types.FunctionCodeLocation{}
+}
+
+// state returns a fingerprint of the code and configuration of $LATEST
+func (fn *function) state() string {
+	c := fn.latest
+	c.RevisionId = nil
+	c.LastModified = nil
+	b, _ := json.Marshal(c)
+	return string(b)
+}
+
+func (f *FakeLambda) publish(fn *function) types.FunctionConfiguration {
+	if len(fn.versions) > 0 && fn.publishedState == fn.state() {
+		// no changes since the last version
+		return fn.versions[len(fn.versions)-1]
+	}
+	fn.lastVersion++
+	version := strconv.Itoa(fn.lastVersion)
+	c := fn.latest
+	c.Version = aws.String(version)
+	c.FunctionArn = aws.String(aws.ToString(fn.latest.FunctionArn) + ":" + version)
+	c.RevisionId = f.nextRevision()
+	fn.versions = append(fn.versions, c)
+	fn.codes[version] = fn.code
+	fn.publishedState = fn.state()
+	return c
+}
+
+func codeSha256(code *types.FunctionCode) (string, int64) {
+	var b []byte
+	switch {
+	case code == nil:
+	case code.ZipFile != nil:
+		b = code.ZipFile
+	case code.ImageUri != nil:
+		b = []byte(*code.ImageUri)
+	default:
+		b = []byte(fmt.Sprintf("s3://%s/%s?versionId=%s",
+			aws.ToString(code.S3Bucket), aws.ToString(code.S3Key), aws.ToString(code.S3ObjectVersion)))
+	}
+	h := sha256.Sum256(b)
+	return base64.StdEncoding.EncodeToString(h[:]), int64(len(b))
+}
+
+func (f *FakeLambda) updateCode(fn *function, code *types.FunctionCode) {
+	sum, size := codeSha256(code)
+	fn.latest.CodeSha256 = aws.String(sum)
+	fn.latest.CodeSize = size
+	if code != nil && code.ImageUri != nil {
+		fn.code = types.FunctionCodeLocation{
+			RepositoryType:   aws.String("ECR"),
+			ImageUri:         code.ImageUri,
+			ResolvedImageUri: code.ImageUri,
+		}
+	} else {
+		fn.code = types.FunctionCodeLocation{
+			RepositoryType: aws.String("S3"),
+			Location:       aws.String("https://example.com/" + aws.ToString(fn.latest.FunctionName) + ".zip"),
+		}
+	}
+}
+
+func updateConfiguration(c *types.FunctionConfiguration, in *lambda.UpdateFunctionConfigurationInput) {
+	if in.DeadLetterConfig != nil {
+		c.DeadLetterConfig = in.DeadLetterConfig
+	}
+	if in.Description != nil {
+		c.Description = in.Description
+	}
+	if in.Environment != nil {
+		c.Environment = &types.EnvironmentResponse{Variables: in.Environment.Variables}
+	}
+	if in.EphemeralStorage != nil {
+		c.EphemeralStorage = in.EphemeralStorage
+	}
+	if in.FileSystemConfigs != nil {
+		c.FileSystemConfigs = in.FileSystemConfigs
+	}
+	if in.Handler != nil {
+		c.Handler = in.Handler
+	}
+	if in.ImageConfig != nil {
+		c.ImageConfigResponse = &types.ImageConfigResponse{ImageConfig: in.ImageConfig}
+	}
+	if in.KMSKeyArn != nil {
+		c.KMSKeyArn = in.KMSKeyArn
+	}
+	if in.Layers != nil {
+		c.Layers = make([]types.Layer, 0, len(in.Layers))
+		for _, arn := range in.Layers {
+			c.Layers = append(c.Layers, types.Layer{Arn: aws.String(arn)})
+		}
+	}
+	if in.LoggingConfig != nil {
+		c.LoggingConfig = in.LoggingConfig
+	}
+	if in.MemorySize != nil {
+		c.MemorySize = in.MemorySize
+	}
+	if in.Role != nil {
+		c.Role = in.Role
+	}
+	if in.Runtime != "" {
+		c.Runtime = in.Runtime
+	}
+	if in.SnapStart != nil {
+		c.SnapStart = &types.SnapStartResponse{ApplyOn: in.SnapStart.ApplyOn}
+	}
+	if in.Timeout != nil {
+		c.Timeout = in.Timeout
+	}
+	if in.TracingConfig != nil {
+		c.TracingConfig = &types.TracingConfigResponse{Mode: in.TracingConfig.Mode}
+	}
+	if v := in.VpcConfig; v != nil {
+		vpcID := ""
+		if len(v.SubnetIds) > 0 {
+			vpcID = "vpc-00000000"
+		}
+		c.VpcConfig = &types.VpcConfigResponse{
+			SubnetIds:               v.SubnetIds,
+			SecurityGroupIds:        v.SecurityGroupIds,
+			Ipv6AllowedForDualStack: v.Ipv6AllowedForDualStack,
+			VpcId:                   aws.String(vpcID),
+		}
+	}
+	c.LastModified = aws.String(time.Now().Format(lastModifiedFormat))
+}
+
+// CreateFunction creates a function
+func (f *FakeLambda) CreateFunction(ctx context.Context, in *lambda.CreateFunctionInput, _ ...func(*lambda.Options)) (*lambda.CreateFunctionOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	name := aws.ToString(in.FunctionName)
+	if name == "" {
+		return nil, invalidParameter("FunctionName is required")
+	}
+	if _, exists := f.functions[name]; exists {
+		return nil, conflict("Function already exist: %s", name)
+	}
+	fn := &function{
+		latest: types.FunctionConfiguration{
+			FunctionName:  aws.String(name),
+			FunctionArn:   aws.String(f.functionArn(name)),
+			Version:       aws.String(versionLatest),
+			Architectures: []types.Architecture{types.ArchitectureX8664},
+			Description:   aws.String(""),
+			MemorySize:    aws.Int32(128),
+			Timeout:       aws.Int32(3),
+			PackageType:   types.PackageTypeZip,
+			EphemeralStorage: &types.EphemeralStorage{
+				Size: aws.Int32(512),
+			},
+			LoggingConfig: &types.LoggingConfig{
+				LogFormat: types.LogFormatText,
+				LogGroup:  aws.String("/aws/lambda/" + name),
+			},
+			SnapStart:        &types.SnapStartResponse{ApplyOn: types.SnapStartApplyOnNone},
+			TracingConfig:    &types.TracingConfigResponse{Mode: types.TracingModePassThrough},
+			State:            types.StateActive,
+			LastUpdateStatus: types.LastUpdateStatusSuccessful,
+		},
+		codes:         make(map[string]types.FunctionCodeLocation),
+		aliases:       make(map[string]*types.AliasConfiguration),
+		tags:          make(map[string]string),
+		urlConfigs:    make(map[string]*urlConfig),
+		policies:      make(map[string][]lambroll.PolicyStatement),
+		provisioned:   make(map[string]*types.ProvisionedConcurrencyConfigListItem),
+		invokeConfigs: make(map[string]*types.FunctionEventInvokeConfig),
+	}
+	if len(in.Architectures) > 0 {
+		fn.latest.Architectures = in.Architectures
+	}
+	if in.PackageType != "" {
+		fn.latest.PackageType = in.PackageType
+	}
+	var confIn lambda.UpdateFunctionConfigurationInput
+	convert(in, &confIn)
+	updateConfiguration(&fn.latest, &confIn)
+	f.updateCode(fn, in.Code)
+	fn.latest.RevisionId = f.nextRevision()
+	for k, v := range in.Tags {
+		fn.tags[k] = v
+	}
+	f.functions[name] = fn
+
+	c := fn.latest
+	if in.Publish {
+		c = f.publish(fn)
+	}
+	var out lambda.CreateFunctionOutput
+	convert(c, &out)
+	return &out, nil
+}
+
+// GetFunction returns the function configuration of the version or alias
+func (f *FakeLambda) GetFunction(ctx context.Context, in *lambda.GetFunctionInput, _ ...func(*lambda.Options)) (*lambda.GetFunctionOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn, q, err := f.lookup(in.FunctionName, in.Qualifier)
+	if err != nil {
+		return nil, err
+	}
+	version, ok := fn.resolve(q)
+	if !ok {
+		return nil, notFound("Function not found: %s:%s", aws.ToString(fn.latest.FunctionArn), q)
+	}
+	c, code := fn.configuration(version)
+	tags := make(map[string]string, len(fn.tags))
+	for k, v := range fn.tags {
+		tags[k] = v
+	}
+	return &lambda.GetFunctionOutput{
+		Configuration: &c,
+		Code:          &code,
+		Tags:          tags,
+	}, nil
+}
+
+// UpdateFunctionConfiguration updates the configuration of $LATEST
+func (f *FakeLambda) UpdateFunctionConfiguration(ctx context.Context, in *lambda.UpdateFunctionConfigurationInput, _ ...func(*lambda.Options)) (*lambda.UpdateFunctionConfigurationOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn, _, err := f.lookup(in.FunctionName, nil)
+	if err != nil {
+		return nil, err
+	}
+	if in.RevisionId != nil && *in.RevisionId != aws.ToString(fn.latest.RevisionId) {
+		return nil, preconditionFailed("The Revision Id provided does not match the latest Revision Id")
+	}
+	updateConfiguration(&fn.latest, in)
+	fn.latest.RevisionId = f.nextRevision()
+	var out lambda.UpdateFunctionConfigurationOutput
+	convert(fn.latest, &out)
+	return &out, nil
+}
+
+// UpdateFunctionCode updates the code of $LATEST and publishes a version optionally
+func (f *FakeLambda) UpdateFunctionCode(ctx context.Context, in *lambda.UpdateFunctionCodeInput, _ ...func(*lambda.Options)) (*lambda.UpdateFunctionCodeOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn, _, err := f.lookup(in.FunctionName, nil)
+	if err != nil {
+		return nil, err
+	}
+	if in.RevisionId != nil && *in.RevisionId != aws.ToString(fn.latest.RevisionId) {
+		return nil, preconditionFailed("The Revision Id provided does not match the latest Revision Id")
+	}
+	var out lambda.UpdateFunctionCodeOutput
+	if in.DryRun {
+		convert(fn.latest, &out)
+		return &out, nil
+	}
+	code := &types.FunctionCode{
+		ZipFile:         in.ZipFile,
+		S3Bucket:        in.S3Bucket,
+		S3Key:           in.S3Key,
+		S3ObjectVersion: in.S3ObjectVersion,
+		ImageUri:        in.ImageUri,
+	}
+	f.updateCode(fn, code)
+	if len(in.Architectures) > 0 {
+		fn.latest.Architectures = in.Architectures
+	}
+	fn.latest.RevisionId = f.nextRevision()
+	fn.latest.LastModified = aws.String(time.Now().Format(lastModifiedFormat))
+	c := fn.latest
+	if in.Publish {
+		c = f.publish(fn)
+	}
+	convert(c, &out)
+	return &out, nil
+}
+
+// PublishVersion publishes a version from $LATEST. The latest version is returned when $LATEST is not changed since the last publish.
+func (f *FakeLambda) PublishVersion(ctx context.Context, in *lambda.PublishVersionInput, _ ...func(*lambda.Options)) (*lambda.PublishVersionOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn, _, err := f.lookup(in.FunctionName, nil)
+	if err != nil {
+		return nil, err
+	}
+	if in.RevisionId != nil && *in.RevisionId != aws.ToString(fn.latest.RevisionId) {
+		return nil, preconditionFailed("The Revision Id provided does not match the latest Revision Id")
+	}
+	if in.CodeSha256 != nil && *in.CodeSha256 != aws.ToString(fn.latest.CodeSha256) {
+		return nil, invalidParameter("CodeSHA256 (%s) is different from current CodeSHA256 in $LATEST (%s). Please try again with the CodeSHA256 in $LATEST.", *in.CodeSha256, aws.ToString(fn.latest.CodeSha256))
+	}
+	c := f.publish(fn)
+	var out lambda.PublishVersionOutput
+	convert(c, &out)
+	return &out, nil
+}
+
+// DeleteFunction deletes the function or the version
+func (f *FakeLambda) DeleteFunction(ctx context.Context, in *lambda.DeleteFunctionInput, _ ...func(*lambda.Options)) (*lambda.DeleteFunctionOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn, q, err := f.lookup(in.FunctionName, in.Qualifier)
+	if err != nil {
+		return nil, err
+	}
+	if q == "" {
+		delete(f.functions, aws.ToString(fn.latest.FunctionName))
+		return &lambda.DeleteFunctionOutput{}, nil
+	}
+	if q == versionLatest {
+		return nil, invalidParameter("$LATEST version cannot be deleted without deleting the function")
+	}
+	for _, a := range fn.aliases {
+		if aws.ToString(a.FunctionVersion) == q {
+			return nil, conflict("Unable to delete version because the following aliases reference it: [%s]", aws.ToString(a.Name))
+		}
+		if rc := a.RoutingConfig; rc != nil {
+			if _, ok := rc.AdditionalVersionWeights[q]; ok {
+				return nil, conflict("Unable to delete version because the following aliases reference it: [%s]", aws.ToString(a.Name))
+			}
+		}
+	}
+	for i, v := range fn.versions {
+		if aws.ToString(v.Version) == q {
+			fn.versions = append(fn.versions[:i], fn.versions[i+1:]...)
+			delete(fn.codes, q)
+			return &lambda.DeleteFunctionOutput{}, nil
+		}
+	}
+	return nil, notFound("Function not found: %s:%s", aws.ToString(fn.latest.FunctionArn), q)
+}
+
+// ListFunctions lists $LATEST of all functions
+func (f *FakeLambda) ListFunctions(ctx context.Context, in *lambda.ListFunctionsInput, _ ...func(*lambda.Options)) (*lambda.ListFunctionsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	names := make([]string, 0, len(f.functions))
+	for name := range f.functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := &lambda.ListFunctionsOutput{}
+	for _, name := range names {
+		out.Functions = append(out.Functions, f.functions[name].latest)
+	}
+	return out, nil
+}
+
+// ListVersionsByFunction lists $LATEST and the published versions
+func (f *FakeLambda) ListVersionsByFunction(ctx context.Context, in *lambda.ListVersionsByFunctionInput, _ ...func(*lambda.Options)) (*lambda.ListVersionsByFunctionOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn, _, err := f.lookup(in.FunctionName, nil)
+	if err != nil {
+		return nil, err
+	}
+	out := &lambda.ListVersionsByFunctionOutput{}
+	out.Versions = append(out.Versions, fn.latest)
+	out.Versions = append(out.Versions, fn.versions...)
+	return out, nil
+}
+
+func (f *FakeLambda) aliasOutput(a *types.AliasConfiguration, out any) {
+	convert(a, out)
+}
+
+// CreateAlias creates an alias
+func (f *FakeLambda) CreateAlias(ctx context.Context, in *lambda.CreateAliasInput, _ ...func(*lambda.Options)) (*lambda.CreateAliasOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn, _, err := f.lookup(in.FunctionName, nil)
+	if err != nil {
+		return nil, err
+	}
+	name := aws.ToString(in.Name)
+	if _, exists := fn.aliases[name]; exists {
+		return nil, conflict("Alias already exists: %s:%s", aws.ToString(fn.latest.FunctionArn), name)
+	}
+	if _, ok := fn.resolve(aws.ToString(in.FunctionVersion)); !ok {
+		return nil, notFound("Function not found: %s:%s", aws.ToString(fn.latest.FunctionArn), aws.ToString(in.FunctionVersion))
+	}
+	a := &types.AliasConfiguration{
+		AliasArn:        aws.String(aws.ToString(fn.latest.FunctionArn) + ":" + name),
+		Description:     in.Description,
+		FunctionVersion: in.FunctionVersion,
+		Name:            aws.String(name),
+		RevisionId:      f.nextRevision(),
+	}
+	if rc := in.RoutingConfig; rc != nil && len(rc.AdditionalVersionWeights) > 0 {
+		a.RoutingConfig = rc
+	}
+	fn.aliases[name] = a
+	var out lambda.CreateAliasOutput
+	f.aliasOutput(a, &out)
+	return &out, nil
+}
+
+// GetAlias returns the alias
+func (f *FakeLambda) GetAlias(ctx context.Context, in *lambda.GetAliasInput, _ ...func(*lambda.Options)) (*lambda.GetAliasOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn, _, err := f.lookup(in.FunctionName, nil)
+	if err != nil {
+		return nil, err
+	}
+	a, ok := fn.aliases[aws.ToString(in.Name)]
+	if !ok {
+		return nil, notFound("Alias not found: %s:%s", aws.ToString(fn.latest.FunctionArn), aws.ToString(in.Name))
+	}
+	var out lambda.GetAliasOutput
+	f.aliasOutput(a, &out)
+	return &out, nil
+}
+
+// UpdateAlias updates the alias. An empty RoutingConfig removes the weighted routing.
+func (f *FakeLambda) UpdateAlias(ctx context.Context, in *lambda.UpdateAliasInput, _ ...func(*lambda.Options)) (*lambda.UpdateAliasOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn, _, err := f.lookup(in.FunctionName, nil)
+	if err != nil {
+		return nil, err
+	}
+	a, ok := fn.aliases[aws.ToString(in.Name)]
+	if !ok {
+		return nil, notFound("Alias not found: %s:%s", aws.ToString(fn.latest.FunctionArn), aws.ToString(in.Name))
+	}
+	if in.RevisionId != nil && *in.RevisionId != aws.ToString(a.RevisionId) {
+		return nil, preconditionFailed("The Revision Id provided does not match the latest Revision Id")
+	}
+	if in.FunctionVersion != nil {
+		if _, ok := fn.resolve(*in.FunctionVersion); !ok {
+			return nil, notFound("Function not found: %s:%s", aws.ToString(fn.latest.FunctionArn), *in.FunctionVersion)
+		}
+		a.FunctionVersion = in.FunctionVersion
+	}
+	if in.Description != nil {
+		a.Description = in.Description
+	}
+	if rc := in.RoutingConfig; rc != nil {
+		if len(rc.AdditionalVersionWeights) == 0 {
+			a.RoutingConfig = nil
+		} else {
+			a.RoutingConfig = rc
+		}
+	}
+	a.RevisionId = f.nextRevision()
+	var out lambda.UpdateAliasOutput
+	f.aliasOutput(a, &out)
+	return &out, nil
+}
+
+// ListAliases lists aliases of the function
+func (f *FakeLambda) ListAliases(ctx context.Context, in *lambda.ListAliasesInput, _ ...func(*lambda.Options)) (*lambda.ListAliasesOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn, _, err := f.lookup(in.FunctionName, nil)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(fn.aliases))
+	for name := range fn.aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := &lambda.ListAliasesOutput{}
+	for _, name := range names {
+		a := fn.aliases[name]
+		if in.FunctionVersion != nil && aws.ToString(a.FunctionVersion) != *in.FunctionVersion {
+			continue
+		}
+		out.Aliases = append(out.Aliases, *a)
+	}
+	return out, nil
+}
+
+// ListTags lists tags of the function
+func (f *FakeLambda) ListTags(ctx context.Context, in *lambda.ListTagsInput, _ ...func(*lambda.Options)) (*lambda.ListTagsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn, _, err := f.lookup(in.Resource, nil)
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]string, len(fn.tags))
+	for k, v := range fn.tags {
+		tags[k] = v
+	}
+	return &lambda.ListTagsOutput{Tags: tags}, nil
+}
+
+// TagResource sets tags to the function
+func (f *FakeLambda) TagResource(ctx context.Context, in *lambda.TagResourceInput, _ ...func(*lambda.Options)) (*lambda.TagResourceOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn, _, err := f.lookup(in.Resource, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range in.Tags {
+		fn.tags[k] = v
+	}
+	return &lambda.TagResourceOutput{}, nil
+}
+
+// UntagResource removes tags from the function
+func (f *FakeLambda) UntagResource(ctx context.Context, in *lambda.UntagResourceInput, _ ...func(*lambda.Options)) (*lambda.UntagResourceOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn, _, err := f.lookup(in.Resource, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range in.TagKeys {
+		delete(fn.tags, k)
+	}
+	return &lambda.UntagResourceOutput{}, nil
+}
+
+// Invoke invokes the function by InvokeFunc
+func (f *FakeLambda) Invoke(ctx context.Context, in *lambda.InvokeInput, _ ...func(*lambda.Options)) (*lambda.InvokeOutput, error) {
+	f.mu.Lock()
+	fn, q, err := f.lookup(in.FunctionName, in.Qualifier)
+	if err != nil {
+		f.mu.Unlock()
+		return nil, err
+	}
+	version, ok := fn.resolve(q)
+	f.mu.Unlock()
+	if !ok {
+		return nil, notFound("Function not found: %s:%s", aws.ToString(fn.latest.FunctionArn), q)
+	}
+	if f.InvokeFunc != nil {
+		return f.InvokeFunc(ctx, in)
+	}
+	out := &lambda.InvokeOutput{
+		ExecutedVersion: aws.String(version),
+		Payload:         in.Payload,
+		StatusCode:      200,
+	}
+	if in.InvocationType == types.InvocationTypeEvent {
+		out.StatusCode = 202
+		out.Payload = nil
+	}
+	return out, nil
+}
@@ -0,0 +1,134 @@
+package lambrolltest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+type layerVersion struct {
+	item    types.LayerVersionsListItem
+	content types.LayerVersionContentOutput
+}
+
+type layer struct {
+	versions    []*layerVersion
+	lastVersion int64
+}
+
+func (f *FakeLambda) layerArn(name string) string {
+	return fmt.Sprintf("arn:aws:lambda:%s:%s:layer:%s", f.Region, f.AccountID, name)
+}
+
+// PublishLayerVersion publishes a new version of the layer. A layer is created by the first publish.
+func (f *FakeLambda) PublishLayerVersion(ctx context.Context, in *lambda.PublishLayerVersionInput, _ ...func(*lambda.Options)) (*lambda.PublishLayerVersionOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	name := aws.ToString(in.LayerName)
+	if name == "" {
+		return nil, invalidParameter("LayerName is required")
+	}
+	if in.Content == nil {
+		return nil, invalidParameter("Content is required")
+	}
+	l, ok := f.layers[name]
+	if !ok {
+		l = &layer{}
+		f.layers[name] = l
+	}
+	l.lastVersion++
+	sum, size := codeSha256(&types.FunctionCode{
+		ZipFile:         in.Content.ZipFile,
+		S3Bucket:        in.Content.S3Bucket,
+		S3Key:           in.Content.S3Key,
+		S3ObjectVersion: in.Content.S3ObjectVersion,
+	})
+	v := &layerVersion{
+		item: types.LayerVersionsListItem{
+			Version:                 l.lastVersion,
+			LayerVersionArn:         aws.String(fmt.Sprintf("%s:%d", f.layerArn(name), l.lastVersion)),
+			CreatedDate:             aws.String(time.Now().Format(lastModifiedFormat)),
+			Description:             in.Description,
+			LicenseInfo:             in.LicenseInfo,
+			CompatibleRuntimes:      in.CompatibleRuntimes,
+			CompatibleArchitectures: in.CompatibleArchitectures,
+		},
+		content: types.LayerVersionContentOutput{
+			CodeSha256: aws.String(sum),
+			CodeSize:   size,
+			Location:   aws.String(fmt.Sprintf("https://example.com/%s-%d.zip", name, l.lastVersion)),
+		},
+	}
+	l.versions = append(l.versions, v)
+	out := &lambda.PublishLayerVersionOutput{Content: &v.content}
+	convert(v.item, out)
+	out.LayerArn = aws.String(f.layerArn(name))
+	return out, nil
+}
+
+func (f *FakeLambda) findLayerVersion(name *string, version *int64) (*layer, int, error) {
+	l, ok := f.layers[aws.ToString(name)]
+	if ok {
+		for i, v := range l.versions {
+			if v.item.Version == aws.ToInt64(version) {
+				return l, i, nil
+			}
+		}
+	}
+	return nil, 0, notFound("The resource you requested does not exist. (Service: Lambda, Status Code: 404) %s:%d", aws.ToString(name), aws.ToInt64(version))
+}
+
+// GetLayerVersion returns the version of the layer
+func (f *FakeLambda) GetLayerVersion(ctx context.Context, in *lambda.GetLayerVersionInput, _ ...func(*lambda.Options)) (*lambda.GetLayerVersionOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	l, i, err := f.findLayerVersion(in.LayerName, in.VersionNumber)
+	if err != nil {
+		return nil, err
+	}
+	v := l.versions[i]
+	content := v.content
+	out := &lambda.GetLayerVersionOutput{Content: &content}
+	convert(v.item, out)
+	out.LayerArn = aws.String(f.layerArn(aws.ToString(in.LayerName)))
+	return out, nil
+}
+
+// ListLayerVersions lists the versions of the layer in descending order
+func (f *FakeLambda) ListLayerVersions(ctx context.Context, in *lambda.ListLayerVersionsInput, _ ...func(*lambda.Options)) (*lambda.ListLayerVersionsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := &lambda.ListLayerVersionsOutput{}
+	l, ok := f.layers[aws.ToString(in.LayerName)]
+	if !ok {
+		return out, nil
+	}
+	for _, v := range l.versions {
+		out.LayerVersions = append(out.LayerVersions, v.item)
+	}
+	sort.Slice(out.LayerVersions, func(i, j int) bool {
+		return out.LayerVersions[i].Version > out.LayerVersions[j].Version
+	})
+	if n := int(aws.ToInt32(in.MaxItems)); n > 0 && n < len(out.LayerVersions) {
+		out.LayerVersions = out.LayerVersions[:n]
+	}
+	return out, nil
+}
+
+// DeleteLayerVersion deletes the version of the layer
+func (f *FakeLambda) DeleteLayerVersion(ctx context.Context, in *lambda.DeleteLayerVersionInput, _ ...func(*lambda.Options)) (*lambda.DeleteLayerVersionOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	l, i, err := f.findLayerVersion(in.LayerName, in.VersionNumber)
+	if err != nil {
+		// DeleteLayerVersion does not fail for a version which does not exist
+		return &lambda.DeleteLayerVersionOutput{}, nil
+	}
+	l.versions = append(l.versions[:i], l.versions[i+1:]...)
+	return &lambda.DeleteLayerVersionOutput{}, nil
+}
@@ -0,0 +1,470 @@
+package lambroll
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Songmu/prompter"
+	"github.com/aereal/jsondiff"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/fatih/color"
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	"github.com/kylelemons/godebug/diff"
+	"github.com/olekukonko/tablewriter"
+)
+
+// LayerOption represents options for Layer()
+type LayerOption struct {
+	Action       string `arg:"" enum:"publish,versions,diff,delete" help:"publish, versions, diff or delete"`
+	Layer        string `help:"path to layer definition" default:"" env:"LAMBROLL_LAYER"`
+	Src          string `help:"layer zip archive or src dir" default:"."`
+	SkipArchive  bool   `help:"skip to create zip archive. requires Content.S3Bucket and Content.S3Key in layer definition" default:"false"`
+	DryRun       bool   `help:"dry run" default:"false"`
+	CodeSha256   bool   `name:"code" help:"diff of code sha256" default:"false"`
+	Output       string `default:"table" enum:"table,json,tsv" help:"output format of versions (table,json,tsv)"`
+	Version      int64  `help:"version of the layer to delete" default:"0"`
+	KeepVersions int    `help:"Number of latest versions to keep at delete. Older versions will be deleted." default:"0"`
+	Force        bool   `help:"delete without confirmation" default:"false"`
+
+	ZipOption
+}
+
+func (opt LayerOption) label() string {
+	if opt.DryRun {
+		return "**DRY RUN**"
+	}
+	return ""
+}
+
+// Layer represents a definition of Lambda layer in layer.json(net)
+type Layer struct {
+	lambda.PublishLayerVersionInput
+}
+
+// Layer manages the layer defined in layer.json(net)
+func (app *App) Layer(ctx context.Context, opt *LayerOption) error {
+	layer, err := app.loadLayer(opt.Layer)
+	if err != nil {
+		return fmt.Errorf("failed to load layer: %w", err)
+	}
+	switch opt.Action {
+	case "publish":
+		return app.publishLayer(ctx, layer, opt)
+	case "versions":
+		return app.layerVersions(ctx, layer, opt)
+	case "diff":
+		return app.diffLayer(ctx, layer, opt)
+	case "delete":
+		return app.deleteLayerVersions(ctx, layer, opt)
+	default:
+		return fmt.Errorf("unknown action: %s", opt.Action)
+	}
+}
+
+func (app *App) loadLayer(path string) (*Layer, error) {
+	layer, err := loadDefinitionFile[Layer](app, path, DefaultLayerFilenames)
+	if err != nil {
+		return nil, err
+	}
+	if aws.ToString(layer.LayerName) == "" {
+		return nil, fmt.Errorf("LayerName is required in layer definition")
+	}
+	return layer, nil
+}
+
+// latestLayerVersion returns the latest version of the layer. It returns nil when no versions exist.
+func (app *App) latestLayerVersion(ctx context.Context, name string) (*types.LayerVersionsListItem, error) {
+	res, err := app.lambda.ListLayerVersions(ctx, &lambda.ListLayerVersionsInput{
+		LayerName: aws.String(name),
+		MaxItems:  aws.Int32(1),
+	})
+	if err != nil {
+		var nfe *types.ResourceNotFoundException
+		if errors.As(err, &nfe) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list layer versions of %s: %w", name, err)
+	}
+	if len(res.LayerVersions) == 0 {
+		return nil, nil
+	}
+	return &res.LayerVersions[0], nil
+}
+
+// layerConfig returns the attributes of the layer version to compare
+func layerConfig(description, license *string, runtimes []types.Runtime, archs []types.Architecture) map[string]any {
+	m, _ := toGeneralMap(struct {
+		Description             *string
+		LicenseInfo             *string
+		CompatibleRuntimes      []types.Runtime
+		CompatibleArchitectures []types.Architecture
+	}{description, license, runtimes, archs}, true)
+	if mm, ok := m.(map[string]any); ok {
+		return mm
+	}
+	return map[string]any{}
+}
+
+func (layer *Layer) config() map[string]any {
+	return layerConfig(layer.Description, layer.LicenseInfo, layer.CompatibleRuntimes, layer.CompatibleArchitectures)
+}
+
+func remoteLayerConfig(v *types.LayerVersionsListItem) map[string]any {
+	if v == nil {
+		return map[string]any{}
+	}
+	return layerConfig(v.Description, v.LicenseInfo, v.CompatibleRuntimes, v.CompatibleArchitectures)
+}
+
+// layerCodeSha256 returns CodeSha256 of the latest version of the layer
+func (app *App) layerCodeSha256(ctx context.Context, name string, version int64) (string, error) {
+	res, err := app.lambda.GetLayerVersion(ctx, &lambda.GetLayerVersionInput{
+		LayerName:     aws.String(name),
+		VersionNumber: aws.Int64(version),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get layer version %s:%d: %w", name, version, err)
+	}
+	if res.Content == nil {
+		return "", nil
+	}
+	return aws.ToString(res.Content.CodeSha256), nil
+}
+
+func (app *App) publishLayer(ctx context.Context, layer *Layer, opt *LayerOption) error {
+	if err := opt.Expand(); err != nil {
+		return err
+	}
+	name := *layer.LayerName
+	latest, err := app.latestLayerVersion(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	in := layer.PublishLayerVersionInput
+	if opt.SkipArchive {
+		if in.Content == nil || in.Content.S3Bucket == nil || in.Content.S3Key == nil {
+			return fmt.Errorf("--skip-archive requires Content.S3Bucket and Content.S3Key elements in layer definition")
+		}
+	} else {
+		zipfile, info, err := prepareZipfile(opt.Src, &opt.ZipOption)
+		if err != nil {
+			return err
+		}
+		defer zipfile.Close()
+		if latest != nil && jsonStr(layer.config()) == jsonStr(remoteLayerConfig(latest)) {
+			sha, err := sha256OfFile(zipfile)
+			if err != nil {
+				return err
+			}
+			current, err := app.layerCodeSha256(ctx, name, latest.Version)
+			if err != nil {
+				return err
+			}
+			if sha == current {
+				app.logger.Printf("[info] the content and the configuration of layer %s are not changed. skip publishing. the latest version is %d", name, latest.Version)
+				return nil
+			}
+		}
+		if in.Content != nil && in.Content.S3Bucket != nil && in.Content.S3Key != nil {
+			bucket, key := *in.Content.S3Bucket, *in.Content.S3Key
+			app.logger.Printf("[info] uploading layer %d bytes to s3://%s/%s %s", info.Size(), bucket, key, opt.label())
+			if !opt.DryRun {
+				versionID, err := app.uploadFunctionToS3(ctx, zipfile, bucket, key)
+				if err != nil {
+					return fmt.Errorf("failed to upload layer zip to s3://%s/%s: %w", bucket, key, err)
+				}
+				if versionID != "" {
+					app.logger.Printf("[info] object created as version %s", versionID)
+					in.Content.S3ObjectVersion = aws.String(versionID)
+				} else {
+					app.logger.Printf("[info] object created")
+					in.Content.S3ObjectVersion = nil
+				}
+			}
+		} else {
+			if s := info.Size(); s > directUploadThreshold {
+				return fmt.Errorf("cannot use a zip file for publish layer directly. Too large file %d bytes. Please define Content.S3Bucket and Content.S3Key in layer definition", s)
+			}
+			b, err := io.ReadAll(zipfile)
+			if err != nil {
+				return fmt.Errorf("failed to read zipfile content: %w", err)
+			}
+			in.Content = &types.LayerVersionContentInput{ZipFile: b}
+		}
+	}
+
+	app.logger.Printf("[info] publishing layer %s %s", name, opt.label())
+	if opt.DryRun {
+		return nil
+	}
+	res, err := app.lambda.PublishLayerVersion(ctx, &in)
+	if err != nil {
+		return fmt.Errorf("failed to publish layer version: %w", err)
+	}
+	app.logger.Printf("[info] published layer version %s", aws.ToString(res.LayerVersionArn))
+	return nil
+}
+
+// listLayerVersions returns all versions of the layer in descending order
+func (app *App) listLayerVersions(ctx context.Context, name string) ([]types.LayerVersionsListItem, error) {
+	var versions []types.LayerVersionsListItem
+	var marker *string
+	for {
+		res, err := app.lambda.ListLayerVersions(ctx, &lambda.ListLayerVersionsInput{
+			LayerName: aws.String(name),
+			Marker:    marker,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list layer versions of %s: %w", name, err)
+		}
+		versions = append(versions, res.LayerVersions...)
+		if marker = res.NextMarker; marker == nil {
+			break
+		}
+	}
+	return versions, nil
+}
+
+type layerVersionsOutput struct {
+	Version                 int64     `json:"Version"`
+	CreatedDate             time.Time `json:"CreatedDate"`
+	CompatibleRuntimes      []string  `json:"CompatibleRuntimes,omitempty"`
+	CompatibleArchitectures []string  `json:"CompatibleArchitectures,omitempty"`
+	LayerVersionArn         string    `json:"LayerVersionArn"`
+}
+
+type layerVersionsOutputs []layerVersionsOutput
+
+func (vo layerVersionsOutputs) JSON() string {
+	b, _ := json.Marshal(vo)
+	var out bytes.Buffer
+	json.Indent(&out, b, "", "  ")
+	return out.String()
+}
+
+func (vo layerVersionsOutputs) TSV() string {
+	buf := new(strings.Builder)
+	for _, v := range vo {
+		buf.WriteString(strings.Join(v.row(), "\t") + "\n")
+	}
+	return buf.String()
+}
+
+func (vo layerVersionsOutputs) Table() string {
+	buf := new(strings.Builder)
+	w := tablewriter.NewWriter(buf)
+	w.SetHeader([]string{"Version", "Created", "Runtimes", "Architectures", "Arn"})
+	for _, v := range vo {
+		w.Append(v.row())
+	}
+	w.Render()
+	return buf.String()
+}
+
+func (v layerVersionsOutput) row() []string {
+	return []string{
+		strconv.FormatInt(v.Version, 10),
+		v.CreatedDate.Local().Format(time.RFC3339),
+		strings.Join(v.CompatibleRuntimes, ","),
+		strings.Join(v.CompatibleArchitectures, ","),
+		v.LayerVersionArn,
+	}
+}
+
+func (app *App) layerVersions(ctx context.Context, layer *Layer, opt *LayerOption) error {
+	versions, err := app.listLayerVersions(ctx, *layer.LayerName)
+	if err != nil {
+		return err
+	}
+	vos := make(layerVersionsOutputs, 0, len(versions))
+	for _, v := range versions {
+		created, err := time.Parse("2006-01-02T15:04:05.999-0700", aws.ToString(v.CreatedDate))
+		if err != nil {
+			return fmt.Errorf("failed to parse created date: %w", err)
+		}
+		vo := layerVersionsOutput{
+			Version:         v.Version,
+			CreatedDate:     created,
+			LayerVersionArn: aws.ToString(v.LayerVersionArn),
+		}
+		for _, r := range v.CompatibleRuntimes {
+			vo.CompatibleRuntimes = append(vo.CompatibleRuntimes, string(r))
+		}
+		for _, a := range v.CompatibleArchitectures {
+			vo.CompatibleArchitectures = append(vo.CompatibleArchitectures, string(a))
+		}
+		vos = append(vos, vo)
+	}
+	switch opt.Output {
+	case "json":
+		fmt.Fprintln(app.stdout, vos.JSON())
+	case "tsv":
+		fmt.Fprint(app.stdout, vos.TSV())
+	case "table":
+		fmt.Fprint(app.stdout, vos.Table())
+	default:
+		return fmt.Errorf("unknown output format: %s", opt.Output)
+	}
+	return nil
+}
+
+func (app *App) diffLayer(ctx context.Context, layer *Layer, opt *LayerOption) error {
+	if err := opt.Expand(); err != nil {
+		return err
+	}
+	name := *layer.LayerName
+	latest, err := app.latestLayerVersion(ctx, name)
+	if err != nil {
+		return err
+	}
+	remoteName := "(new) layer " + name
+	if latest != nil {
+		remoteName = aws.ToString(latest.LayerVersionArn)
+	}
+	localName := opt.Layer
+	if localName == "" {
+		localName = "layer " + name
+	}
+	if ds, err := jsondiff.Diff(
+		&jsondiff.Input{Name: remoteName, X: remoteLayerConfig(latest)},
+		&jsondiff.Input{Name: localName, X: layer.config()},
+	); err != nil {
+		return fmt.Errorf("failed to diff: %w", err)
+	} else if ds != "" {
+		fmt.Fprint(app.stdout, coloredDiff(ds))
+	}
+
+	if opt.CodeSha256 {
+		var currentCodeSha256 string
+		if latest != nil {
+			if currentCodeSha256, err = app.layerCodeSha256(ctx, name, latest.Version); err != nil {
+				return err
+			}
+		}
+		zipfile, _, err := prepareZipfile(opt.Src, &opt.ZipOption)
+		if err != nil {
+			return err
+		}
+		defer zipfile.Close()
+		newCodeSha256, err := sha256OfFile(zipfile)
+		if err != nil {
+			return err
+		}
+		prefix := "CodeSha256: "
+		if ds := diff.Diff(prefix+currentCodeSha256, prefix+newCodeSha256); ds != "" {
+			fmt.Fprintln(app.stdout, color.RedString("---"+remoteName))
+			fmt.Fprintln(app.stdout, color.GreenString("+++"+"--src="+opt.Src))
+			fmt.Fprintln(app.stdout, coloredDiff(ds))
+		}
+	}
+	return nil
+}
+
+func (app *App) deleteLayerVersions(ctx context.Context, layer *Layer, opt *LayerOption) error {
+	name := *layer.LayerName
+	var targets []int64
+	switch {
+	case opt.Version > 0:
+		targets = []int64{opt.Version}
+	case opt.KeepVersions > 0:
+		versions, err := app.listLayerVersions(ctx, name)
+		if err != nil {
+			return err
+		}
+		// versions are in descending order
+		for i, v := range versions {
+			if i >= opt.KeepVersions {
+				targets = append(targets, v.Version)
+			}
+		}
+	default:
+		return fmt.Errorf("specify --version or --keep-versions to delete layer versions")
+	}
+	if len(targets) == 0 {
+		app.logger.Printf("[info] no layer versions to delete")
+		return nil
+	}
+	for _, v := range targets {
+		app.logger.Printf("[info] deleting layer version %s:%d %s", name, v, opt.label())
+	}
+	if opt.DryRun {
+		return nil
+	}
+	if !opt.Force && !prompter.YN("Do you want to delete the layer versions?", false) {
+		app.logger.Println("[info] canceled to delete layer versions of", name)
+		return nil
+	}
+	for _, v := range targets {
+		if _, err := app.lambda.DeleteLayerVersion(ctx, &lambda.DeleteLayerVersionInput{
+			LayerName:     aws.String(name),
+			VersionNumber: aws.Int64(v),
+		}); err != nil {
+			return fmt.Errorf("failed to delete layer version %s:%d: %w", name, v, err)
+		}
+	}
+	app.logger.Printf("[info] completed to delete %d layer versions of %s", len(targets), name)
+	return nil
+}
+
+// layerResolver resolves the latest version ARN of layers in function definitions
+type layerResolver struct {
+	app  *App
+	mu   sync.Mutex
+	arns map[string]string
+}
+
+func (r *layerResolver) resolve(ctx context.Context, name string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if arn, ok := r.arns[name]; ok {
+		return arn, nil
+	}
+	v, err := r.app.latestLayerVersion(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if v == nil {
+		return "", fmt.Errorf("no versions of layer %s are found", name)
+	}
+	arn := aws.ToString(v.LayerVersionArn)
+	r.app.logger.Printf("[debug] the latest version of layer %s is %s", name, arn)
+	r.arns[name] = arn
+	return arn, nil
+}
+
+func (r *layerResolver) JsonnetNativeFuncs(ctx context.Context) []*jsonnet.NativeFunction {
+	return []*jsonnet.NativeFunction{
+		{
+			Name:   "latest_layer_version_arn",
+			Params: []ast.Identifier{"name"},
+			Func: func(args []any) (any, error) {
+				name, ok := args[0].(string)
+				if !ok {
+					return nil, fmt.Errorf("latest_layer_version_arn: name must be a string")
+				}
+				return r.resolve(ctx, name)
+			},
+		},
+	}
+}
+
+func (r *layerResolver) FuncMap(ctx context.Context) template.FuncMap {
+	return template.FuncMap{
+		"latest_layer_version_arn": func(name string) (string, error) {
+			return r.resolve(ctx, name)
+		},
+	}
+}
@@ -1,13 +1,24 @@
 package lambroll
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
-	"log"
-	"os"
-	"os/exec"
+	"io"
+	"sort"
+	"strconv"
 	"strings"
-	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	cwltypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/fatih/color"
+	"github.com/shogo82148/go-retry"
 )
 
 type LogsOption struct {
@@ -23,34 +34,311 @@ func (app *App) Logs(ctx context.Context, opt *LogsOption) error {
 		return fmt.Errorf("failed to load function: %w", err)
 	}
 
-	logGroup := resolveLogGroup(fn)
-	command := []string{
-		"aws",
-		"--profile", app.profile,
-		"--region", app.awsConfig.Region,
-		"logs",
-		"tail",
-		logGroup,
-	}
+	logGroup := resolveLogGroup(&fn.Function)
+	since := "10m"
 	if opt.Since != nil {
-		command = append(command, "--since", *opt.Since)
+		since = *opt.Since
 	}
-	if opt.Follow != nil && *opt.Follow {
-		command = append(command, "--follow")
-	}
-	if opt.Format != nil {
-		command = append(command, "--format", *opt.Format)
+	start, err := parseSince(since, time.Now())
+	if err != nil {
+		return err
 	}
+	var filterPattern *string
 	if opt.FilterPattern != nil && *opt.FilterPattern != "" {
-		command = append(command, "--filter-pattern", *opt.FilterPattern)
+		filterPattern = opt.FilterPattern
+	}
+	f := &logFormatter{
+		format:  aws.ToString(opt.Format),
+		jsonLog: fn.LoggingConfig != nil && fn.LoggingConfig.LogFormat == types.LogFormatJson,
+		w:       app.stdout,
+	}
+
+	svc := cloudwatchlogs.NewFromConfig(app.awsConfig)
+	if opt.Follow == nil || !*opt.Follow {
+		return app.filterLogs(ctx, svc, logGroup, start.UnixMilli(), filterPattern, f, nil)
 	}
-	bin, err := exec.LookPath(command[0])
+	// live tail requires the ARN of the log group in the partition of the function
+	res, err := app.lambda.GetFunction(ctx, &lambda.GetFunctionInput{FunctionName: fn.FunctionName})
+	if err != nil {
+		return fmt.Errorf("failed to get function %s: %w", *fn.FunctionName, err)
+	}
+	logGroupArn, err := logGroupArnOf(aws.ToString(res.Configuration.FunctionArn), logGroup)
 	if err != nil {
 		return err
 	}
-	log.Println("[debug] invoking command", strings.Join(command, " "))
-	if err := syscall.Exec(bin, command, os.Environ()); err != nil {
-		return fmt.Errorf("failed to invoke aws logs tail: %w", err)
+	return app.tailLogs(ctx, svc, logGroup, logGroupArn, start.UnixMilli(), filterPattern, f)
+}
+
+// logGroupArnOf returns the ARN of the log group in the partition, the region and the account of the function
+func logGroupArnOf(functionArn, logGroup string) (string, error) {
+	a, err := arn.Parse(functionArn)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse function ARN %s: %w", functionArn, err)
+	}
+	return arn.ARN{
+		Partition: a.Partition,
+		Service:   "logs",
+		Region:    a.Region,
+		AccountID: a.AccountID,
+		Resource:  "log-group:" + logGroup,
+	}.String(), nil
+}
+
+// filterLogs prints log events since the time (epoch milliseconds).
+// When seen is not nil, events which are already printed are skipped.
+func (app *App) filterLogs(ctx context.Context, svc *cloudwatchlogs.Client, logGroup string, since int64, filterPattern *string, f *logFormatter, seen *logEventSet) error {
+	app.logger.Printf("[debug] filter log events of %s since %s", logGroup, time.UnixMilli(since).Format(time.RFC3339))
+	p := cloudwatchlogs.NewFilterLogEventsPaginator(svc, &cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName:  aws.String(logGroup),
+		StartTime:     aws.Int64(since),
+		FilterPattern: filterPattern,
+	})
+	for p.HasMorePages() {
+		res, err := p.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to filter log events of %s: %w", logGroup, err)
+		}
+		for _, e := range res.Events {
+			ts, stream, message := aws.ToInt64(e.Timestamp), aws.ToString(e.LogStreamName), aws.ToString(e.Message)
+			if seen != nil && !seen.add(ts, aws.ToInt64(e.IngestionTime), stream, message) {
+				continue
+			}
+			f.print(ts, stream, message)
+		}
 	}
 	return nil
 }
+
+// liveTailReconnectMargin is the period of the past events read again when the live tail session is reconnected
+const liveTailReconnectMargin = time.Minute
+
+// liveTailReconnectPolicy is a retry policy to reconnect the live tail session after an error.
+// It is reset when a session ends normally (e.g. by the session timeout).
+var liveTailReconnectPolicy = retry.Policy{
+	MinDelay: time.Second,
+	MaxDelay: time.Minute,
+	MaxCount: 10,
+}
+
+// tailLogs prints log events since the time (epoch milliseconds) and follows new events by live tail.
+// The live tail session is started before reading the past events, so that no events are missed between them.
+// Events delivered by both are printed once.
+// When the session ends (e.g. by the session timeout), tailLogs starts a new session and reads the events again
+// since the last event to fill the gap. After an error, it reconnects with exponential backoff until
+// liveTailReconnectPolicy is exhausted or ctx is canceled.
+func (app *App) tailLogs(ctx context.Context, svc *cloudwatchlogs.Client, logGroup, logGroupArn string, since int64, filterPattern *string, f *logFormatter) error {
+	seen := newLogEventSet()
+	var lastErr error
+	connected := false
+	retryer := liveTailReconnectPolicy.Start(ctx)
+	for retryer.Continue() {
+		app.logger.Printf("[debug] starting live tail of %s", logGroupArn)
+		res, err := svc.StartLiveTail(ctx, &cloudwatchlogs.StartLiveTailInput{
+			LogGroupIdentifiers:   []string{logGroupArn},
+			LogEventFilterPattern: filterPattern,
+		})
+		if err != nil {
+			err = fmt.Errorf("failed to start live tail of %s: %w", logGroup, err)
+			if !connected || ctx.Err() != nil {
+				return err
+			}
+			app.logger.Printf("[warn] %s. reconnecting", err)
+			lastErr = err
+			continue
+		}
+		connected = true
+		stream := res.GetStream()
+		err = app.filterLogs(ctx, svc, logGroup, since, filterPattern, f, seen)
+		if err == nil {
+			err = app.readLiveTail(ctx, stream, logGroup, f, seen)
+		}
+		stream.Close()
+		if seen.latest > 0 {
+			since = seen.latest - liveTailReconnectMargin.Milliseconds()
+		}
+		seen.prune(since)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			app.logger.Printf("[warn] %s. reconnecting", err)
+			lastErr = err
+			continue
+		}
+		app.logger.Printf("[info] live tail session of %s ended. reconnecting", logGroup)
+		retryer = liveTailReconnectPolicy.Start(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("failed to reconnect live tail of %s: %w", logGroup, lastErr)
+}
+
+// readLiveTail prints log events delivered by the live tail session until the session ends.
+// It returns an error when the stream is closed by an error.
+func (app *App) readLiveTail(ctx context.Context, stream *cloudwatchlogs.StartLiveTailEventStream, logGroup string, f *logFormatter, seen *logEventSet) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev, ok := <-stream.Events():
+			if !ok {
+				if err := stream.Err(); err != nil {
+					return fmt.Errorf("live tail of %s is closed: %w", logGroup, err)
+				}
+				return nil
+			}
+			switch e := ev.(type) {
+			case *cwltypes.StartLiveTailResponseStreamMemberSessionStart:
+				app.logger.Printf("[debug] live tail session started: %s", aws.ToString(e.Value.SessionId))
+			case *cwltypes.StartLiveTailResponseStreamMemberSessionUpdate:
+				for _, le := range e.Value.SessionResults {
+					ts, logStream, message := aws.ToInt64(le.Timestamp), aws.ToString(le.LogStreamName), aws.ToString(le.Message)
+					if !seen.add(ts, aws.ToInt64(le.IngestionTime), logStream, message) {
+						continue
+					}
+					f.print(ts, logStream, message)
+				}
+			}
+		}
+	}
+}
+
+// logEventSet records printed log events to print each event once.
+// Events are identified by the timestamp, the ingestion time, the log stream and the message,
+// because events of live tail have no event ID.
+type logEventSet struct {
+	events map[string]int64 // key -> timestamp
+	latest int64
+}
+
+func newLogEventSet() *logEventSet {
+	return &logEventSet{events: make(map[string]int64)}
+}
+
+// add records the event, and reports whether the event is not recorded yet
+func (s *logEventSet) add(ts, ingestionTime int64, stream, message string) bool {
+	key := strings.Join([]string{strconv.FormatInt(ts, 10), strconv.FormatInt(ingestionTime, 10), stream, message}, "\x00")
+	if _, ok := s.events[key]; ok {
+		return false
+	}
+	s.events[key] = ts
+	if ts > s.latest {
+		s.latest = ts
+	}
+	return true
+}
+
+// prune forgets events older than the time (epoch milliseconds)
+func (s *logEventSet) prune(before int64) {
+	for key, ts := range s.events {
+		if ts < before {
+			delete(s.events, key)
+		}
+	}
+}
+
+// parseSince parses a relative time (e.g. 10m, 2h, 1d, 1w) or an absolute time.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	units := map[byte]time.Duration{
+		's': time.Second,
+		'm': time.Minute,
+		'h': time.Hour,
+		'd': 24 * time.Hour,
+		'w': 7 * 24 * time.Hour,
+	}
+	if len(s) > 1 {
+		if unit, ok := units[s[len(s)-1]]; ok {
+			if n, err := strconv.Atoi(s[:len(s)-1]); err == nil {
+				return now.Add(-time.Duration(n) * unit), nil
+			}
+		}
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid --since value: %s", s)
+}
+
+type logFormatter struct {
+	format  string
+	jsonLog bool
+	w       io.Writer
+}
+
+func (f *logFormatter) print(ts int64, stream, message string) {
+	fmt.Fprintln(f.w, f.formatEvent(time.UnixMilli(ts), stream, message))
+}
+
+func (f *logFormatter) formatEvent(ts time.Time, stream, message string) string {
+	message = strings.TrimRight(message, "\n")
+	switch f.format {
+	case "short":
+		return color.GreenString(ts.Local().Format("2006-01-02T15:04:05")) + " " + f.formatMessage(message)
+	case "json":
+		var out bytes.Buffer
+		if err := json.Indent(&out, []byte(message), "", "  "); err == nil {
+			message = out.String()
+		}
+		return color.GreenString(ts.Local().Format("2006-01-02T15:04:05.000000-07:00")) + " " + color.CyanString(stream) + " " + message
+	default:
+		return color.GreenString(ts.Local().Format("2006-01-02T15:04:05.000000-07:00")) + " " + color.CyanString(stream) + " " + f.formatMessage(message)
+	}
+}
+
+// formatMessage renders JSON formatted logs (LoggingConfig.LogFormat=JSON) with colors
+func (f *logFormatter) formatMessage(message string) string {
+	if !f.jsonLog {
+		return message
+	}
+	var m map[string]any
+	if err := json.Unmarshal([]byte(message), &m); err != nil {
+		return message
+	}
+	var parts []string
+	if level, ok := m["level"].(string); ok {
+		parts = append(parts, colorLevel(level))
+		delete(m, "level")
+	}
+	if typ, ok := m["type"].(string); ok {
+		// system logs (e.g. platform.start)
+		parts = append(parts, color.MagentaString(typ))
+		delete(m, "type")
+	}
+	if msg, ok := m["message"]; ok {
+		if s, ok := msg.(string); ok {
+			parts = append(parts, s)
+		} else {
+			mb, _ := json.Marshal(msg)
+			parts = append(parts, string(mb))
+		}
+		delete(m, "message")
+	}
+	delete(m, "timestamp")
+	delete(m, "time")
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		vb, _ := json.Marshal(m[k])
+		parts = append(parts, color.HiBlackString(k+"=")+string(vb))
+	}
+	return strings.Join(parts, " ")
+}
+
+func colorLevel(level string) string {
+	switch strings.ToUpper(level) {
+	case "ERROR", "FATAL":
+		return color.RedString(level)
+	case "WARN":
+		return color.YellowString(level)
+	case "DEBUG", "TRACE":
+		return color.HiBlackString(level)
+	default:
+		return color.BlueString(level)
+	}
+}
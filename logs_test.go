@@ -0,0 +1,112 @@
+package lambroll_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/fujiwara/lambroll"
+)
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		since  string
+		expect time.Time
+		err    bool
+	}{
+		{"10m", now.Add(-10 * time.Minute), false},
+		{"2h", now.Add(-2 * time.Hour), false},
+		{"1d", now.Add(-24 * time.Hour), false},
+		{"1w", now.Add(-7 * 24 * time.Hour), false},
+		{"30s", now.Add(-30 * time.Second), false},
+		{"2024-01-01T00:00:00Z", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), false},
+		{"m", time.Time{}, true},
+		{"10x", time.Time{}, true},
+		{"yesterday", time.Time{}, true},
+	}
+	for _, c := range cases {
+		got, err := lambroll.ParseSince(c.since, now)
+		if c.err {
+			if err == nil {
+				t.Errorf("%s: expected error but got %s", c.since, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", c.since, err)
+			continue
+		}
+		if !got.Equal(c.expect) {
+			t.Errorf("%s: expected %s but got %s", c.since, c.expect, got)
+		}
+	}
+}
+
+func TestLogGroupArnOf(t *testing.T) {
+	cases := []struct {
+		functionArn string
+		expect      string
+	}{
+		{"arn:aws:lambda:ap-northeast-1:123456789012:function:hello", "arn:aws:logs:ap-northeast-1:123456789012:log-group:/aws/lambda/hello"},
+		{"arn:aws-cn:lambda:cn-north-1:123456789012:function:hello", "arn:aws-cn:logs:cn-north-1:123456789012:log-group:/aws/lambda/hello"},
+		{"arn:aws-us-gov:lambda:us-gov-west-1:123456789012:function:hello", "arn:aws-us-gov:logs:us-gov-west-1:123456789012:log-group:/aws/lambda/hello"},
+	}
+	for _, c := range cases {
+		got, err := lambroll.LogGroupArnOf(c.functionArn, "/aws/lambda/hello")
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", c.functionArn, err)
+			continue
+		}
+		if got != c.expect {
+			t.Errorf("%s: expected %s but got %s", c.functionArn, c.expect, got)
+		}
+	}
+	if _, err := lambroll.LogGroupArnOf("hello", "/aws/lambda/hello"); err == nil {
+		t.Error("invalid function ARN should be an error")
+	}
+}
+
+func TestLogEventSet(t *testing.T) {
+	s := lambroll.NewLogEventSet()
+	// an event read by FilterLogEvents
+	if !s.Add(1000, 1001, "stream", "hello") {
+		t.Error("a new event should be added")
+	}
+	// the same event delivered by live tail
+	if s.Add(1000, 1001, "stream", "hello") {
+		t.Error("the same event should not be added twice")
+	}
+	if !s.Add(1000, 1001, "other-stream", "hello") {
+		t.Error("an event of another stream should be added")
+	}
+	if !s.Add(2000, 2001, "stream", "hello") {
+		t.Error("an event of another timestamp should be added")
+	}
+	s.Prune(2000)
+	if !s.Add(1000, 1001, "stream", "hello") {
+		t.Error("a pruned event should be added again")
+	}
+	if s.Add(2000, 2001, "stream", "hello") {
+		t.Error("an event after pruning should be kept")
+	}
+}
+
+func TestFormatLogMessage(t *testing.T) {
+	color.NoColor = true
+	cases := []struct {
+		message string
+		jsonLog bool
+		expect  string
+	}{
+		{`{"level":"INFO","message":"hello"}`, false, `{"level":"INFO","message":"hello"}`},
+		{"plain text", true, "plain text"},
+		{`{"timestamp":"2024-01-01T00:00:00Z","level":"ERROR","message":"failed","requestId":"abc"}`, true, `ERROR failed requestId="abc"`},
+		{`{"time":"2024-01-01T00:00:00Z","type":"platform.start","record":{"version":"1"}}`, true, `platform.start record={"version":"1"}`},
+	}
+	for _, c := range cases {
+		if got := lambroll.FormatLogMessage(c.message, c.jsonLog); got != c.expect {
+			t.Errorf("expected %q but got %q", c.expect, got)
+		}
+	}
+}
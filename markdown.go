@@ -0,0 +1,87 @@
+package lambroll
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// GitHubStepSummaryEnv is the environment variable of the file path of GitHub Actions job summary
+const GitHubStepSummaryEnv = "GITHUB_STEP_SUMMARY"
+
+var ansiEscapeRegexp = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// diffHeader represents attributes of the function shown in the header of the markdown diff
+type diffHeader struct {
+	arn         string
+	qualifier   string
+	functionURL string
+	codeSize    *int64 // deployed
+	newCodeSize *int64 // --src
+}
+
+func (h *diffHeader) codeSizeDelta() string {
+	switch {
+	case h.codeSize != nil && h.newCodeSize != nil:
+		return fmt.Sprintf("%d → %d bytes (%+d)", *h.codeSize, *h.newCodeSize, *h.newCodeSize-*h.codeSize)
+	case h.codeSize != nil:
+		return fmt.Sprintf("%d bytes", *h.codeSize)
+	case h.newCodeSize != nil:
+		return fmt.Sprintf("%d bytes (new)", *h.newCodeSize)
+	}
+	return "-"
+}
+
+// markdown renders the report and the text diffs as a collapsible section for pull request comments
+func (r *DiffReport) markdown(text string) string {
+	b := new(strings.Builder)
+	fmt.Fprintf(b, "### %s\n\n", r.FunctionName)
+	h := r.header
+	fmt.Fprintln(b, "| Function ARN | Qualifier | Code size |")
+	fmt.Fprintln(b, "|---|---|---|")
+	fmt.Fprintf(b, "| `%s` | `%s` | %s |\n", h.arn, h.qualifier, h.codeSizeDelta())
+	if h.functionURL != "" {
+		fmt.Fprintf(b, "\nFunction URL: %s\n", h.functionURL)
+	}
+	fmt.Fprintln(b)
+
+	text = strings.TrimRight(ansiEscapeRegexp.ReplaceAllString(text, ""), "\n")
+	if text == "" {
+		fmt.Fprintf(b, "No changes.\n\n")
+		return b.String()
+	}
+	var summary string
+	switch r.drift.exitCode() {
+	case ExitCodeFunctionNotFound:
+		summary = "Function is not found. lambroll deploy will create a new function."
+	default:
+		unit := "changes"
+		if len(r.Changes) == 1 {
+			unit = "change"
+		}
+		summary = fmt.Sprintf("%d %s (%s drift)", len(r.Changes), unit, r.Drift)
+	}
+	fmt.Fprintf(b, "<details><summary>%s</summary>\n\n", summary)
+	fmt.Fprintf(b, "```diff\n%s\n```\n\n", text)
+	fmt.Fprintf(b, "</details>\n\n")
+	return b.String()
+}
+
+// writeStepSummary appends s to the job summary of GitHub Actions when GITHUB_STEP_SUMMARY is set
+func (app *App) writeStepSummary(s string) error {
+	path := os.Getenv(GitHubStepSummaryEnv)
+	if path == "" {
+		return nil
+	}
+	app.logger.Printf("[info] writing diff to %s", GitHubStepSummaryEnv)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", GitHubStepSummaryEnv, err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(s); err != nil {
+		return fmt.Errorf("failed to write %s: %w", GitHubStepSummaryEnv, err)
+	}
+	return nil
+}
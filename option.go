@@ -1,14 +1,26 @@
 package lambroll
 
-import "fmt"
+import (
+	"fmt"
+	"log"
+	"time"
+)
 
 // Option represents common option.
 
 type ZipOption struct {
-	ExcludeFile string `help:"exclude file" default:".lambdaignore"`
-	KeepSymlink bool   `name:"symlink" help:"keep symlink (same as zip --symlink,-y)" default:"false"`
+	ExcludeFile  string `help:"exclude file" default:".lambdaignore"`
+	IgnoreSyntax string `help:"syntax of patterns in the exclude file (wildcard, gitignore)" enum:"wildcard,gitignore" default:"wildcard"`
+	KeepSymlink  bool   `name:"symlink" help:"keep symlink (same as zip --symlink,-y)" default:"false"`
+	Reproducible bool   `help:"create a reproducible zip archive. normalize timestamps (SOURCE_DATE_EPOCH), permissions and order of files" default:"false"`
 
-	excludes []string
+	logger    *log.Logger // log.Default() when nil
+	modTime   *time.Time  // overrides SOURCE_DATE_EPOCH for reproducible zip archives
+	excludes  []string
+	includes  []*PackageInclude // replaces src when defined
+	srcGiven  bool              // --src is given explicitly
+	built     bool
+	bootstrap []byte
 }
 
 func (opt *ZipOption) Expand() error {
@@ -19,3 +31,31 @@ func (opt *ZipOption) Expand() error {
 	opt.excludes = append(opt.excludes, excludes...)
 	return nil
 }
+
+func (opt *ZipOption) getLogger() *log.Logger {
+	if opt.logger == nil {
+		return log.Default()
+	}
+	return opt.logger
+}
+
+// BuildOption represents options to build the function code. deploy, diff and archive use it.
+type BuildOption struct {
+	IncludeFile string `help:"include file. each line maps a source path to a directory in the zip archive" default:".lambdainclude"`
+	SkipBuild   bool   `help:"skip the build command in the function definition" default:"false"`
+	BuildGo     string `help:"build the Go package as bootstrap for provided runtimes (e.g. ./cmd/handler)" default:""`
+
+	ZipOption
+}
+
+func (opt *BuildOption) Expand() error {
+	if err := opt.ZipOption.Expand(); err != nil {
+		return err
+	}
+	includes, err := loadIncludeFile(opt.IncludeFile)
+	if err != nil {
+		return fmt.Errorf("failed to parse include-file: %w", err)
+	}
+	opt.includes = includes
+	return nil
+}
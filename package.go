@@ -0,0 +1,88 @@
+package lambroll
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Package represents the contents of the zip archive created from multiple sources
+type Package struct {
+	// Include is the list of the sources to be archived
+	Include []*PackageInclude `json:"Include"`
+}
+
+// PackageInclude maps a source path to a directory in the zip archive
+type PackageInclude struct {
+	// Src is a file or a directory. A relative path is resolved from the directory of the function definition.
+	Src string `json:"Src"`
+	// Dest is a directory in the zip archive. "" or "/" means the root.
+	Dest string `json:"Dest,omitempty"`
+}
+
+// prefix returns the directory in the zip archive without leading and trailing slashes
+func (in *PackageInclude) prefix() string {
+	return strings.Trim(path.Clean("/"+in.Dest), "/")
+}
+
+// loadIncludeFile loads the include file. It returns nil when the file does not exist.
+// Each line of the file is "SRC [DEST]". SRC is relative to the directory of the include file.
+func loadIncludeFile(file string) ([]*PackageInclude, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	dir := filepath.Dir(file)
+	var includes []*PackageInclude
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			// skip blank or comment line
+			continue
+		}
+		fields := strings.Fields(line)
+		in := &PackageInclude{Src: joinPath(dir, fields[0])}
+		switch len(fields) {
+		case 1:
+		case 2:
+			in.Dest = fields[1]
+		default:
+			return nil, fmt.Errorf("invalid line %d in %s: %s", n, file, line)
+		}
+		includes = append(includes, in)
+	}
+	return includes, s.Err()
+}
+
+// functionDir returns the directory of the function definition
+func (app *App) functionDir() string {
+	if app.functionFilePath == "" {
+		return "."
+	}
+	return filepath.Dir(app.functionFilePath)
+}
+
+// applyPackage uses Package in the function definition as the include list instead of the include file
+func (opt *ZipOption) applyPackage(p *Package, dir string) {
+	if p == nil || len(p.Include) == 0 {
+		return
+	}
+	if len(opt.includes) > 0 {
+		opt.logger.Printf("[info] Package in the function definition overrides the include file")
+	}
+	opt.includes = make([]*PackageInclude, 0, len(p.Include))
+	for _, in := range p.Include {
+		opt.includes = append(opt.includes, &PackageInclude{
+			Src:  joinPath(dir, in.Src),
+			Dest: in.Dest,
+		})
+	}
+}
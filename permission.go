@@ -0,0 +1,234 @@
+package lambroll
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/fatih/color"
+	"github.com/kylelemons/godebug/diff"
+	"github.com/samber/lo"
+)
+
+// DefaultPermissionAction is the action of Permissions in function.json
+const DefaultPermissionAction = "lambda:InvokeFunction"
+
+func (ps *PolicyStatement) conditionValue(op, key string) *string {
+	m, ok := ps.Condition.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	mm, ok := m[op].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	for k, v := range mm {
+		if strings.EqualFold(k, key) {
+			if s, ok := v.(string); ok {
+				return aws.String(s)
+			}
+		}
+	}
+	return nil
+}
+
+func (ps *PolicyStatement) SourceAccount() *string {
+	return ps.conditionValue("StringEquals", "AWS:SourceAccount")
+}
+
+func (ps *PolicyStatement) EventSourceToken() *string {
+	return ps.conditionValue("StringEquals", "lambda:EventSourceToken")
+}
+
+// fillDefaultValuesPermissions fills Action of permissions. It must be called before Sid() is called.
+func fillDefaultValuesPermissions(ps Permissions) {
+	for _, p := range ps {
+		if p.Action == nil {
+			p.Action = aws.String(DefaultPermissionAction)
+		}
+	}
+}
+
+// getPermissions returns permissions of the function, except lambda:InvokeFunctionUrl permissions managed by the function URL.
+// Statements of any actions are returned, because Action of Permissions in function.json is not only lambda:InvokeFunction.
+// When sids is not nil, only statements managed by lambroll (Sid is lambroll-* or in sids) are returned.
+func (app *App) getPermissions(ctx context.Context, functionName string, qualifier *string, sids []string) (Permissions, error) {
+	fqFunctionName := fullQualifiedFunctionName(functionName, qualifier)
+	res, err := app.lambda.GetPolicy(ctx, &lambda.GetPolicyInput{
+		FunctionName: &functionName,
+		Qualifier:    qualifier,
+	})
+	if err != nil {
+		var nfe *types.ResourceNotFoundException
+		if errors.As(err, &nfe) {
+			return Permissions{}, nil
+		}
+		return nil, fmt.Errorf("failed to get policy: %w", err)
+	}
+	app.logger.Printf("[debug] policy for %s: %s", fqFunctionName, *res.Policy)
+	var policy PolicyOutput
+	if err := json.Unmarshal([]byte(*res.Policy), &policy); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal policy: %w", err)
+	}
+	ps := make(Permissions, 0)
+	for _, s := range policy.Statement {
+		if s.Action == "lambda:InvokeFunctionUrl" || s.Effect != "Allow" {
+			// managed by the function URL
+			continue
+		}
+		if sids != nil && !SidPattern.MatchString(s.Sid) && !lo.Contains(sids, s.Sid) {
+			// not managed by lambroll
+			continue
+		}
+		ps = append(ps, &Permission{
+			sid: s.Sid,
+			AddPermissionInput: lambda.AddPermissionInput{
+				Action:           aws.String(s.Action),
+				StatementId:      aws.String(s.Sid),
+				Qualifier:        qualifier,
+				Principal:        s.PrincipalString(),
+				PrincipalOrgID:   s.conditionValue("StringEquals", "aws:PrincipalOrgID"),
+				SourceArn:        s.SourceArn(),
+				SourceAccount:    s.SourceAccount(),
+				EventSourceToken: s.EventSourceToken(),
+			},
+		})
+	}
+	return ps, nil
+}
+
+// calcPermissionsDiff returns permissions to be added and removed.
+// The policies of the function and the qualifiers in ps are compared.
+func (app *App) calcPermissionsDiff(ctx context.Context, functionName string, ps Permissions) (Permissions, Permissions, error) {
+	exists, err := app.currentPermissions(ctx, functionName, ps)
+	if err != nil {
+		return nil, nil, err
+	}
+	adds, removes := permissionsDiff(exists, ps)
+	return adds, removes, nil
+}
+
+// currentPermissions returns the deployed permissions of the function and the qualifiers in ps
+func (app *App) currentPermissions(ctx context.Context, functionName string, ps Permissions) (Permissions, error) {
+	qualifiers := []string{""}
+	for _, p := range ps {
+		if q := aws.ToString(p.Qualifier); !lo.Contains(qualifiers, q) {
+			qualifiers = append(qualifiers, q)
+		}
+	}
+	sids := ps.Sids()
+	var exists Permissions
+	for _, q := range qualifiers {
+		var qualifier *string
+		if q != "" {
+			qualifier = aws.String(q)
+		}
+		eps, err := app.getPermissions(ctx, functionName, qualifier, sids)
+		if err != nil {
+			return nil, err
+		}
+		exists = append(exists, eps...)
+	}
+	return exists, nil
+}
+
+// permissionsDiff returns permissions to be added to and removed from exists to be ps
+func permissionsDiff(exists, ps Permissions) (Permissions, Permissions) {
+	removeSids, addSids := lo.Difference(exists.Sids(), ps.Sids())
+	var adds, removes Permissions
+	for _, sid := range addSids {
+		adds = append(adds, ps.Find(sid))
+	}
+	for _, sid := range removeSids {
+		removes = append(removes, exists.Find(sid))
+	}
+	return adds, removes
+}
+
+func (app *App) deployPermissions(ctx context.Context, fn *FunctionDefinition, opt *DeployOption) error {
+	if opt.plan != nil {
+		if opt.plan.Permissions == nil {
+			return nil
+		}
+		return app.applyPermissions(ctx, fn, opt.plan.Permissions.Add, opt.plan.Permissions.Remove, opt)
+	}
+	if fn.Permissions == nil {
+		return nil
+	}
+	fillDefaultValuesPermissions(fn.Permissions)
+	adds, removes, err := app.calcPermissionsDiff(ctx, *fn.FunctionName, fn.Permissions)
+	if err != nil {
+		return err
+	}
+	return app.applyPermissions(ctx, fn, adds, removes, opt)
+}
+
+func (app *App) applyPermissions(ctx context.Context, fn *FunctionDefinition, adds, removes Permissions, opt *DeployOption) error {
+	if len(adds) == 0 && len(removes) == 0 {
+		app.logger.Println("[info] no changes in permissions.")
+		return nil
+	}
+
+	app.logger.Printf("[info] adding %d permissions %s", len(adds), opt.label())
+	if !opt.DryRun {
+		for _, p := range adds {
+			in := p.AddPermissionInput
+			in.FunctionName = fn.FunctionName
+			in.StatementId = aws.String(p.Sid())
+			if _, err := app.lambda.AddPermission(ctx, &in); err != nil {
+				return fmt.Errorf("failed to add permission: %w", err)
+			}
+			app.logger.Printf("[info] added permission Sid: %s", p.Sid())
+		}
+	}
+
+	app.logger.Printf("[info] removing %d permissions %s", len(removes), opt.label())
+	if !opt.DryRun {
+		for _, p := range removes {
+			if _, err := app.lambda.RemovePermission(ctx, &lambda.RemovePermissionInput{
+				FunctionName: fn.FunctionName,
+				Qualifier:    p.Qualifier,
+				StatementId:  p.StatementId,
+			}); err != nil {
+				return fmt.Errorf("failed to remove permission: %w", err)
+			}
+			app.logger.Printf("[info] removed permission Sid: %s", *p.StatementId)
+		}
+	}
+	return nil
+}
+
+func (app *App) diffPermissions(ctx context.Context, fn *FunctionDefinition, opt *DiffOption) error {
+	if fn.Permissions == nil {
+		return nil
+	}
+	fillDefaultValuesPermissions(fn.Permissions)
+	exists, err := app.currentPermissions(ctx, *fn.FunctionName, fn.Permissions)
+	if err != nil {
+		return err
+	}
+	adds, removes := permissionsDiff(exists, fn.Permissions)
+	var addsB []byte
+	for _, p := range adds {
+		p.Sid() // fill StatementId
+		b, _ := marshalJSON(p)
+		addsB = append(addsB, b...)
+	}
+	var removesB []byte
+	for _, p := range removes {
+		b, _ := marshalJSON(p)
+		removesB = append(removesB, b...)
+	}
+	if ds := diff.Diff(string(removesB), string(addsB)); ds != "" {
+		fmt.Fprintln(app.stdout, color.RedString("--- permissions"))
+		fmt.Fprintln(app.stdout, color.GreenString("+++ permissions"))
+		fmt.Fprint(app.stdout, coloredDiff(ds))
+		opt.report.add(driftConfig, permissionChanges("/Permissions", exists, fn.Permissions)...)
+	}
+	return nil
+}
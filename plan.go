@@ -0,0 +1,244 @@
+package lambroll
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// PlanVersion is the format version of the plan file
+const PlanVersion = 1
+
+// Plan represents a deploy plan created by `diff --out` and applied by `deploy --plan`
+type Plan struct {
+	Version      int       `json:"Version"`
+	CreatedAt    time.Time `json:"CreatedAt"`
+	FunctionFile string    `json:"FunctionFile"`
+	Src          string    `json:"Src,omitempty"`
+
+	// Function is the rendered function definition
+	Function *FunctionDefinition `json:"Function"`
+	// CodeSha256 is the sha256 of the zip archive built from Src
+	CodeSha256 string `json:"CodeSha256,omitempty"`
+	// SourceDateEpoch is the timestamp (Unix time) of files in the reproducible zip archive built from Src
+	SourceDateEpoch *int64 `json:"SourceDateEpoch,omitempty"`
+	// Remote is the state of the deployed function when the plan was made. nil means the function did not exist.
+	Remote *PlanRemote `json:"Remote,omitempty"`
+
+	Tags        *PlanTags        `json:"Tags,omitempty"`
+	Permissions *PlanPermissions `json:"Permissions,omitempty"`
+	FunctionURL *PlanFunctionURL `json:"FunctionURL,omitempty"`
+}
+
+// PlanRemote represents the state of the deployed function
+type PlanRemote struct {
+	CodeSha256 string `json:"CodeSha256"`
+	RevisionId string `json:"RevisionId"`
+}
+
+// PlanTags represents the delta of tags
+type PlanTags struct {
+	Set    Tags     `json:"Set,omitempty"`
+	Remove []string `json:"Remove,omitempty"`
+}
+
+// PlanPermissions represents the delta of permissions
+type PlanPermissions struct {
+	Add    Permissions `json:"Add,omitempty"`
+	Remove Permissions `json:"Remove,omitempty"`
+}
+
+// PlanFunctionURL represents the function URL config and the delta of the permissions
+type PlanFunctionURL struct {
+	Config      *FunctionURLConfig `json:"Config"`
+	Permissions PlanPermissions    `json:"Permissions"`
+}
+
+func loadPlan(path string, logger *log.Logger) (*Plan, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan %s: %w", path, err)
+	}
+	var plan Plan
+	if err := unmarshalJSON(b, &plan, path, logger); err != nil {
+		return nil, fmt.Errorf("failed to load plan %s: %w", path, err)
+	}
+	if plan.Version != PlanVersion {
+		return nil, fmt.Errorf("unsupported plan version %d in %s", plan.Version, path)
+	}
+	if plan.Function == nil || plan.Function.FunctionName == nil {
+		return nil, fmt.Errorf("Function is not defined in plan %s", path)
+	}
+	return &plan, nil
+}
+
+func (plan *Plan) save(path string) error {
+	b, err := marshalJSON(plan)
+	if err != nil {
+		return fmt.Errorf("failed to marshal plan: %w", err)
+	}
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		return fmt.Errorf("failed to write plan %s: %w", path, err)
+	}
+	return nil
+}
+
+// checkDrift returns an error when the deployed function has been changed since the plan was made
+func (plan *Plan) checkDrift(current *types.FunctionConfiguration) error {
+	switch {
+	case plan.Remote == nil && current == nil:
+		return nil
+	case plan.Remote == nil:
+		return fmt.Errorf("function %s was created after the plan was made", *plan.Function.FunctionName)
+	case current == nil:
+		return fmt.Errorf("function %s was deleted after the plan was made", *plan.Function.FunctionName)
+	}
+	if s := aws.ToString(current.CodeSha256); s != plan.Remote.CodeSha256 {
+		return fmt.Errorf("CodeSha256 of function %s has drifted since the plan was made: %s (planned) != %s (current)", *plan.Function.FunctionName, plan.Remote.CodeSha256, s)
+	}
+	if r := aws.ToString(current.RevisionId); r != plan.Remote.RevisionId {
+		return fmt.Errorf("RevisionId of function %s has drifted since the plan was made: %s (planned) != %s (current)", *plan.Function.FunctionName, plan.Remote.RevisionId, r)
+	}
+	return nil
+}
+
+// checkCodeSha256 returns an error when the zip archive differs from the planned one
+func (plan *Plan) checkCodeSha256(zipfile *os.File) error {
+	if plan.CodeSha256 == "" {
+		return nil
+	}
+	s, err := sha256OfFile(zipfile)
+	if err != nil {
+		return err
+	}
+	if s != plan.CodeSha256 {
+		return fmt.Errorf("CodeSha256 of the zip archive differs from the plan: %s (planned) != %s (current). the files in %s have been changed since the plan was made", plan.CodeSha256, s, plan.Src)
+	}
+	return nil
+}
+
+// sha256OfFile returns base64 encoded sha256 of the file, and rewinds the file
+func sha256OfFile(f *os.File) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", f.Name(), err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to seek %s: %w", f.Name(), err)
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// newPlan creates a plan from the result of diff
+func (app *App) newPlan(ctx context.Context, newFunc *FunctionDefinition, remote *types.FunctionConfiguration, tags Tags, opt *DiffOption) (*Plan, error) {
+	plan := &Plan{
+		Version:      PlanVersion,
+		CreatedAt:    time.Now(),
+		FunctionFile: app.functionFilePath,
+		Function:     newFunc,
+	}
+	if remote != nil {
+		plan.Remote = &PlanRemote{
+			CodeSha256: aws.ToString(remote.CodeSha256),
+			RevisionId: aws.ToString(remote.RevisionId),
+		}
+	}
+	if newFunc.PackageType != types.PackageTypeImage {
+		plan.Src = opt.Src
+		// deploy --plan builds the zip archive again. it must be reproducible to get the same CodeSha256.
+		t, err := sourceDateEpoch()
+		if err != nil {
+			return nil, err
+		}
+		if !opt.Reproducible {
+			app.logger.Println("[info] --out creates a reproducible zip archive to be built again by deploy --plan")
+			opt.Reproducible = true
+		}
+		opt.modTime = &t
+		plan.SourceDateEpoch = aws.Int64(t.Unix())
+		if err := app.prepareSources(ctx, newFunc, &opt.BuildOption); err != nil {
+			return nil, err
+		}
+		zipfile, _, err := prepareZipfile(opt.Src, &opt.ZipOption)
+		if err != nil {
+			return nil, err
+		}
+		defer zipfile.Close()
+		if plan.CodeSha256, err = sha256OfFile(zipfile); err != nil {
+			return nil, err
+		}
+	}
+	if newFunc.Tags != nil {
+		sets, removes := mergeTags(tags, newFunc.Tags)
+		plan.Tags = &PlanTags{Set: sets, Remove: removes}
+	}
+	if newFunc.Permissions != nil {
+		fillDefaultValuesPermissions(newFunc.Permissions)
+		adds, removes, err := app.calcPermissionsDiff(ctx, *newFunc.FunctionName, newFunc.Permissions)
+		if err != nil {
+			return nil, err
+		}
+		plan.Permissions = &PlanPermissions{Add: adds, Remove: removes}
+	}
+	if opt.FunctionURL != "" {
+		fu, err := app.loadFunctionUrl(opt.FunctionURL, *newFunc.FunctionName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load function-url: %w", err)
+		}
+		adds, removes, err := app.calcFunctionURLPermissionsDiff(ctx, fu)
+		if err != nil {
+			return nil, err
+		}
+		plan.FunctionURL = &PlanFunctionURL{
+			Config:      fu.Config,
+			Permissions: PlanPermissions{Add: adds, Remove: removes},
+		}
+	}
+	return plan, nil
+}
+
+// loadFunctionForDeploy loads the function from the plan when --plan is specified
+func (app *App) loadFunctionForDeploy(opt *DeployOption) (*FunctionDefinition, error) {
+	if opt.Plan == "" {
+		return app.loadFunction(app.functionFilePath)
+	}
+	plan, err := loadPlan(opt.Plan, app.logger)
+	if err != nil {
+		return nil, err
+	}
+	app.logger.Printf("[info] applying plan %s created at %s", opt.Plan, plan.CreatedAt.Format(time.RFC3339))
+	opt.plan = plan
+	if plan.Src != "" {
+		opt.Src = plan.Src
+	}
+	if plan.SourceDateEpoch != nil {
+		t := time.Unix(*plan.SourceDateEpoch, 0).UTC()
+		opt.Reproducible = true
+		opt.modTime = &t
+	}
+	if opt.EventSourceMappings != "" {
+		return nil, fmt.Errorf("--event-source-mappings can not be used with --plan. event source mappings are not recorded in the plan")
+	}
+	return plan.Function, nil
+}
+
+func (app *App) deployPlannedFunctionURL(ctx context.Context, pf *PlanFunctionURL, opt *DeployOption) error {
+	app.logger.Printf("[info] deploying function url... %s", opt.label())
+	fc := &FunctionURL{Config: pf.Config}
+	if err := app.deployFunctionURLConfig(ctx, fc, opt); err != nil {
+		return fmt.Errorf("failed to deploy function url config: %w", err)
+	}
+	if err := app.applyFunctionURLPermissions(ctx, fc, pf.Permissions.Add, pf.Permissions.Remove, opt); err != nil {
+		return fmt.Errorf("failed to deploy function url permissions: %w", err)
+	}
+	app.logger.Println("[info] deployed function url", opt.label())
+	return nil
+}
@@ -0,0 +1,338 @@
+package lambroll
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kayac/go-config"
+	"github.com/olekukonko/tablewriter"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultManifestFilename defines file name for project manifest.
+var DefaultManifestFilename = "lambroll.yaml"
+
+// ProjectOption represents options for processing all functions in the project manifest
+type ProjectOption struct {
+	All         bool   `help:"process all functions in the project manifest" default:"false"`
+	Manifest    string `help:"path to project manifest" default:"lambroll.yaml" env:"LAMBROLL_MANIFEST"`
+	Concurrency int    `help:"number of functions processed concurrently with --all" default:"4"`
+}
+
+// Manifest represents a project manifest (lambroll.yaml)
+type Manifest struct {
+	Region          string            `json:"region,omitempty"`
+	TFState         string            `json:"tfstate,omitempty"`
+	PrefixedTFState map[string]string `json:"prefixed_tfstate,omitempty"`
+	Envfile         []string          `json:"envfile,omitempty"`
+	ExtStr          map[string]string `json:"ext_str,omitempty"`
+	ExtCode         map[string]string `json:"ext_code,omitempty"`
+
+	Functions []*ManifestFunction `json:"functions"`
+}
+
+// ManifestFunction represents a function in the project manifest.
+// Paths are relative to Dir.
+type ManifestFunction struct {
+	Dir                 string `json:"dir"`
+	Function            string `json:"function,omitempty"`
+	FunctionURL         string `json:"function_url,omitempty"`
+	EventSourceMappings string `json:"event_source_mappings,omitempty"`
+	Src                 string `json:"src,omitempty"`
+}
+
+// LoadManifest loads a project manifest. Paths in the manifest are resolved relative to the manifest.
+func LoadManifest(path string) (*Manifest, error) {
+	if path == "" {
+		path = DefaultManifestFilename
+	}
+	b, err := config.New().ReadWithEnv(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	src, err := yaml.YAMLToJSON(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	var m Manifest
+	if err := unmarshalJSON(src, &m, path, log.Default()); err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", path, err)
+	}
+	if len(m.Functions) == 0 {
+		return nil, fmt.Errorf("no functions are defined in %s", path)
+	}
+
+	base := filepath.Dir(path)
+	for i, f := range m.Envfile {
+		m.Envfile[i] = joinPath(base, f)
+	}
+	for _, f := range m.Functions {
+		if f.Dir == "" {
+			return nil, fmt.Errorf("functions[].dir is required in %s", path)
+		}
+		f.Dir = joinPath(base, f.Dir)
+		if f.Function == "" {
+			p, err := findDefinitionFileIn(f.Dir, DefaultFunctionFilenames)
+			if err != nil {
+				return nil, fmt.Errorf("function file is not found in %s: %w", f.Dir, err)
+			}
+			f.Function = p
+		} else {
+			f.Function = joinPath(f.Dir, f.Function)
+		}
+		if f.FunctionURL != "" {
+			f.FunctionURL = joinPath(f.Dir, f.FunctionURL)
+		}
+		if f.EventSourceMappings != "" {
+			f.EventSourceMappings = joinPath(f.Dir, f.EventSourceMappings)
+		}
+		f.Src = joinPath(f.Dir, f.Src)
+	}
+	return &m, nil
+}
+
+// MergeOption merges the manifest values into opt. Values in opt take precedence.
+func (m *Manifest) MergeOption(opt *Option) {
+	if (opt.Region == nil || *opt.Region == "") && m.Region != "" {
+		opt.Region = &m.Region
+	}
+	if (opt.TFState == nil || *opt.TFState == "") && m.TFState != "" {
+		opt.TFState = &m.TFState
+	}
+	opt.PrefixedTFState = mergeMap(m.PrefixedTFState, opt.PrefixedTFState)
+	opt.ExtStr = mergeMap(m.ExtStr, opt.ExtStr)
+	opt.ExtCode = mergeMap(m.ExtCode, opt.ExtCode)
+	opt.Envfile = append(append([]string{}, m.Envfile...), opt.Envfile...)
+}
+
+func mergeMap(base, override map[string]string) map[string]string {
+	if len(base) == 0 {
+		return override
+	}
+	merged := make(map[string]string, len(base)+len(override))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		merged[k] = v
+	}
+	return merged
+}
+
+func joinPath(base, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(base, path)
+}
+
+func findDefinitionFileIn(dir string, defaults []string) (string, error) {
+	for _, name := range defaults {
+		p := filepath.Join(dir, name)
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("%s not found", strings.Join(defaults, " or "))
+}
+
+// forFunction returns a copy of app for the function in the manifest
+func (app *App) forFunction(f *ManifestFunction, stdout io.Writer) *App {
+	a := *app
+	a.functionFilePath = f.Function
+	a.stdout = stdout
+	// prefix log lines with the function to tell them apart in concurrent processing.
+	// the prefix is placed before the level to keep the level filter working.
+	a.logger = log.New(log.Writer(), f.Function+": ", log.Flags()|log.Lmsgprefix)
+	return &a
+}
+
+type projectResult struct {
+	fn      *ManifestFunction
+	status  string
+	output  bytes.Buffer
+	elapsed time.Duration
+	err     error
+}
+
+func (app *App) runAll(ctx context.Context, m *Manifest, opt ProjectOption, run func(context.Context, *App, *ManifestFunction) (string, error)) []*projectResult {
+	concurrency := opt.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	results := make([]*projectResult, len(m.Functions))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, f := range m.Functions {
+		results[i] = &projectResult{fn: f}
+		wg.Add(1)
+		go func(r *projectResult) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			start := time.Now()
+			r.status, r.err = run(ctx, app.forFunction(r.fn, &r.output), r.fn)
+			r.elapsed = time.Since(start)
+			if r.err != nil {
+				r.status = "failed"
+				app.logger.Printf("[error] %s: %s", r.fn.Function, r.err)
+			}
+		}(results[i])
+	}
+	wg.Wait()
+	return results
+}
+
+func summarizeResults(w io.Writer, results []*projectResult) error {
+	buf := new(strings.Builder)
+	t := tablewriter.NewWriter(buf)
+	t.SetHeader([]string{"Function", "Result", "Elapsed", "Error"})
+	failed := 0
+	for _, r := range results {
+		var errStr string
+		if r.err != nil {
+			failed++
+			errStr = r.err.Error()
+		}
+		t.Append([]string{r.fn.Function, r.status, r.elapsed.Round(time.Millisecond).String(), errStr})
+	}
+	t.Render()
+	fmt.Fprint(w, buf.String())
+	if failed > 0 {
+		return fmt.Errorf("%d of %d functions failed", failed, len(results))
+	}
+	return nil
+}
+
+// DeployAll deploys all functions in the project manifest
+func (app *App) DeployAll(ctx context.Context, m *Manifest, opt *DeployOption) error {
+	if opt.Plan != "" {
+		return fmt.Errorf("--plan can not be used with --all")
+	}
+	app.logger.Printf("[info] deploying %d functions (concurrency %d) %s", len(m.Functions), opt.Concurrency, opt.label())
+	results := app.runAll(ctx, m, opt.ProjectOption, func(ctx context.Context, a *App, f *ManifestFunction) (string, error) {
+		o := *opt
+		o.Src = f.Src
+		o.FunctionURL = f.FunctionURL
+		o.EventSourceMappings = f.EventSourceMappings
+		o.ExcludeFile = joinPath(f.Dir, opt.ExcludeFile)
+		if opt.IncludeFile != "" {
+			o.IncludeFile = joinPath(f.Dir, opt.IncludeFile)
+		}
+		o.excludes = nil
+		o.includes = nil
+		if err := a.Deploy(ctx, &o); err != nil {
+			return "", err
+		}
+		return "deployed", nil
+	})
+	return summarizeResults(app.stdout, results)
+}
+
+// DiffAll prints diffs of all functions in the project manifest
+func (app *App) DiffAll(ctx context.Context, m *Manifest, opt *DiffOption) error {
+	if opt.Out != "" {
+		return fmt.Errorf("--out can not be used with --all")
+	}
+	var mu sync.Mutex
+	reports := make(map[*ManifestFunction]*DiffReport, len(m.Functions))
+	results := app.runAll(ctx, m, opt.ProjectOption, func(ctx context.Context, a *App, f *ManifestFunction) (string, error) {
+		o := *opt
+		o.Src = f.Src
+		o.FunctionURL = f.FunctionURL
+		o.EventSourceMappings = f.EventSourceMappings
+		o.ExcludeFile = joinPath(f.Dir, opt.ExcludeFile)
+		if opt.IncludeFile != "" {
+			o.IncludeFile = joinPath(f.Dir, opt.IncludeFile)
+		}
+		o.excludes = nil
+		o.includes = nil
+		o.ExitCode = false
+		o.Report = ""
+		err := a.Diff(ctx, &o)
+		mu.Lock()
+		reports[f] = o.report
+		mu.Unlock()
+		if err != nil {
+			return "", err
+		}
+		return "", nil
+	})
+	var d drift
+	var markdown strings.Builder
+	all := make([]*DiffReport, 0, len(results))
+	for _, r := range results {
+		if report := reports[r.fn]; report != nil && r.err == nil {
+			d |= report.drift
+			all = append(all, report)
+		}
+		if r.err != nil {
+			continue
+		}
+		if opt.structuredOutput() {
+			r.status = reports[r.fn].Drift
+			continue
+		}
+		if opt.Output == "markdown" {
+			r.status = reports[r.fn].Drift
+			markdown.Write(r.output.Bytes())
+			io.Copy(app.stdout, &r.output)
+			continue
+		}
+		if r.output.Len() == 0 {
+			r.status = "no changes"
+			continue
+		}
+		r.status = "changed"
+		fmt.Fprintf(app.stdout, "# %s\n", r.fn.Function)
+		io.Copy(app.stdout, &r.output)
+	}
+	if opt.Output == "markdown" {
+		if err := app.writeStepSummary(markdown.String()); err != nil {
+			return err
+		}
+	}
+	if opt.structuredOutput() || opt.Output == "markdown" {
+		// stdout is reserved for JSON or markdown
+		if err := summarizeResults(os.Stderr, results); err != nil {
+			return err
+		}
+	} else if err := summarizeResults(app.stdout, results); err != nil {
+		return err
+	}
+	switch opt.Output {
+	case "json":
+		if err := printDiffJSON(app.stdout, all); err != nil {
+			return err
+		}
+	case "patch":
+		patches := make(map[string]map[string][]*jsonPatchOperation, len(all))
+		for _, report := range all {
+			app.warnUnpatchedChanges(report)
+			patches[report.FunctionName] = report.jsonPatch()
+		}
+		if err := printDiffJSON(app.stdout, patches); err != nil {
+			return err
+		}
+	}
+	if opt.Report != "" {
+		if err := app.saveDiffReport(opt.Report, all); err != nil {
+			return err
+		}
+	}
+	if opt.ExitCode && d != 0 {
+		return &ExitCodeError{
+			Code:    d.exitCode(),
+			Message: fmt.Sprintf("%s drift of functions is detected", d),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package lambroll_test
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/fujiwara/lambroll"
+	"github.com/fujiwara/lambroll/lambrolltest"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoadManifest(t *testing.T) {
+	m, err := lambroll.LoadManifest("test/project/lambroll.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*lambroll.ManifestFunction{
+		{Dir: "test/project/hello", Function: "test/project/hello/function.json", Src: "test/src"},
+		{Dir: "test/project/world", Function: "test/project/world/function.jsonnet", Src: "test/src"},
+	}
+	if diff := cmp.Diff(expected, m.Functions); diff != "" {
+		t.Errorf("unexpected functions %s", diff)
+	}
+
+	opt := &lambroll.Option{ExtStr: map[string]string{"Other": "x"}}
+	m.MergeOption(opt)
+	if diff := cmp.Diff(map[string]string{"Env": "test", "Other": "x"}, opt.ExtStr); diff != "" {
+		t.Errorf("unexpected ext-str %s", diff)
+	}
+	if aws.ToString(opt.Region) != "ap-northeast-1" {
+		t.Errorf("unexpected region %s", aws.ToString(opt.Region))
+	}
+}
+
+func TestDeployAllWithFake(t *testing.T) {
+	ctx := context.Background()
+	m, err := lambroll.LoadManifest("test/project/lambroll.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt := &lambroll.Option{}
+	m.MergeOption(opt)
+	fake := lambrolltest.NewFakeLambda()
+	app, err := lambrolltest.NewApp(ctx, opt, fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dopt := newDeployOption()
+	dopt.ExcludeFile = ".lambdaignore"
+	dopt.Concurrency = 2
+	logs := new(bytes.Buffer)
+	w := log.Writer()
+	log.SetOutput(logs)
+	t.Cleanup(func() { log.SetOutput(w) })
+	if err := app.DeployAll(ctx, m, dopt); err != nil {
+		t.Fatal(err)
+	}
+	// log lines of each function are prefixed with the function
+	for _, line := range []string{
+		"test/project/hello/function.json: [info] starting deploy function hello",
+		"test/project/world/function.jsonnet: [info] starting deploy function world-test",
+	} {
+		if !strings.Contains(logs.String(), line) {
+			t.Errorf("log line %q is not found in\n%s", line, logs)
+		}
+	}
+	for _, name := range []string{"hello", "world-test"} {
+		if _, err := fake.GetAlias(ctx, &lambda.GetAliasInput{
+			FunctionName: aws.String(name),
+			Name:         aws.String("current"),
+		}); err != nil {
+			t.Errorf("alias of %s is not created: %s", name, err)
+		}
+	}
+}
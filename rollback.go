@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
 	"strconv"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -34,7 +33,7 @@ func (app *App) Rollback(ctx context.Context, opt *RollbackOption) error {
 		return fmt.Errorf("failed to load function: %w", err)
 	}
 
-	log.Printf("[info] starting rollback function %s:%s", *fn.FunctionName, opt.Alias)
+	app.logger.Printf("[info] starting rollback function %s:%s", *fn.FunctionName, opt.Alias)
 
 	res, err := app.lambda.GetAlias(ctx, &lambda.GetAliasInput{
 		FunctionName: fn.FunctionName,
@@ -55,11 +54,16 @@ func (app *App) Rollback(ctx context.Context, opt *RollbackOption) error {
 		}
 	}
 
-	log.Printf("[info] rolling back function version %s to %s %s", currentVersion, prevVersion, opt.label())
+	return app.rollbackAlias(ctx, *fn.FunctionName, currentVersion, prevVersion, opt)
+}
+
+// rollbackAlias reverts the alias from currentVersion to prevVersion
+func (app *App) rollbackAlias(ctx context.Context, name, currentVersion, prevVersion string, opt *RollbackOption) error {
+	app.logger.Printf("[info] rolling back function version %s to %s %s", currentVersion, prevVersion, opt.label())
 	if opt.DryRun {
 		return nil
 	}
-	err = app.updateAliases(ctx, *fn.FunctionName, versionAlias{Version: prevVersion, Name: opt.Alias})
+	err := app.updateAliases(ctx, name, versionAlias{Version: prevVersion, Name: opt.Alias, ResetRouting: true})
 	if err != nil {
 		return err
 	}
@@ -68,7 +72,7 @@ func (app *App) Rollback(ctx context.Context, opt *RollbackOption) error {
 		return nil
 	}
 
-	return app.deleteFunctionVersion(ctx, *fn.FunctionName, currentVersion)
+	return app.deleteFunctionVersion(ctx, name, currentVersion)
 }
 
 func (app *App) findPreviousVersion(ctx context.Context, name, currentVersion string) (string, error) {
@@ -84,7 +88,7 @@ func (app *App) findPreviousVersion(ctx context.Context, name, currentVersion st
 	var prevVersion string
 VERSIONS:
 	for v := cv - 1; v > 0; v-- {
-		log.Printf("[debug] get function version %d", v)
+		app.logger.Printf("[debug] get function version %d", v)
 		vs := strconv.FormatInt(v, 10)
 		res, err := app.lambda.GetFunction(ctx, &lambda.GetFunctionInput{
 			FunctionName: aws.String(name),
@@ -93,7 +97,7 @@ VERSIONS:
 		if err != nil {
 			var nfe *types.ResourceNotFoundException
 			if errors.As(err, &nfe) {
-				log.Printf("[debug] version %s not found", vs)
+				app.logger.Printf("[debug] version %s not found", vs)
 				continue VERSIONS
 			} else {
 				return "", fmt.Errorf("failed to get function: %w", err)
@@ -101,7 +105,7 @@ VERSIONS:
 		}
 		if pv := *res.Configuration.Version; aliases[pv] != nil {
 			// skip if the version has alias
-			log.Printf("[info] version %s has alias %v, skipping", pv, aliases[pv])
+			app.logger.Printf("[info] version %s has alias %v, skipping", pv, aliases[pv])
 			continue VERSIONS
 		}
 		prevVersion = *res.Configuration.Version
@@ -114,7 +118,7 @@ VERSIONS:
 }
 
 func (app *App) deleteFunctionVersion(ctx context.Context, functionName, version string) error {
-	log.Printf("[info] deleting function version %s", version)
+	app.logger.Printf("[info] deleting function version %s", version)
 	_, err := app.lambda.DeleteFunction(ctx, &lambda.DeleteFunctionInput{
 		FunctionName: aws.String(functionName),
 		Qualifier:    aws.String(version),
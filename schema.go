@@ -0,0 +1,147 @@
+package lambroll
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// SchemaOption represents options for Schema()
+type SchemaOption struct {
+	Target string `arg:"" enum:"function,function-url" help:"function or function-url"`
+}
+
+// JSONSchemaDraft is the dialect of the generated JSON Schema
+const JSONSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema prints JSON Schema of the function definition or the function URL definition
+func (app *App) Schema(ctx context.Context, opt *SchemaOption) error {
+	s, err := GenerateSchema(opt.Target)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal schema: %w", err)
+	}
+	fmt.Fprintln(app.stdout, string(b))
+	return nil
+}
+
+// GenerateSchema generates JSON Schema of the definition from the Go types. target is function or function-url.
+func GenerateSchema(target string) (map[string]any, error) {
+	var t reflect.Type
+	var title string
+	switch target {
+	case "function":
+		t, title = reflect.TypeOf(FunctionDefinition{}), "lambroll function definition"
+	case "function-url":
+		t, title = reflect.TypeOf(FunctionURL{}), "lambroll function URL definition"
+	default:
+		return nil, fmt.Errorf("unknown schema target: %s", target)
+	}
+	g := &schemaGenerator{defs: make(map[string]any), names: make(map[reflect.Type]string)}
+	s := g.object(t)
+	s["$schema"] = JSONSchemaDraft
+	s["title"] = title
+	s["$defs"] = g.defs
+	return s, nil
+}
+
+type schemaGenerator struct {
+	defs  map[string]any
+	names map[reflect.Type]string
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schema returns the schema of t. Named structs are defined in $defs and referenced.
+func (g *schemaGenerator) schema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		s := map[string]any{"type": "string"}
+		if enum := enumValuesOf(t); len(enum) > 0 {
+			// the values are suggested, but not enforced, because the SDK of lambroll may not know new values
+			// (e.g. a new runtime) which AWS accepts
+			s["anyOf"] = []any{
+				map[string]any{"enum": enum},
+				map[string]any{"type": "string"},
+			}
+		}
+		return s
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// []byte is encoded as base64 string
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		return g.structRef(t)
+	}
+	// interfaces accept any values
+	return map[string]any{}
+}
+
+func (g *schemaGenerator) structRef(t reflect.Type) map[string]any {
+	if name, ok := g.names[t]; ok {
+		return map[string]any{"$ref": "#/$defs/" + name}
+	}
+	name := t.Name()
+	if _, ok := g.defs[name]; ok {
+		// conflicts with a type of another package
+		name = t.String()
+	}
+	g.names[t] = name
+	g.defs[name] = nil // reserve the name while generating nested types
+	g.defs[name] = g.object(t)
+	return map[string]any{"$ref": "#/$defs/" + name}
+}
+
+// object returns the schema of the struct t. Fields are named as encoding/json.
+// Additional properties are not rejected, because lambroll matches field names case-insensitively like encoding/json
+// and JSON Schema can not express it. `lambroll validate` reports unknown fields instead.
+func (g *schemaGenerator) object(t reflect.Type) map[string]any {
+	fields := jsonFields(t)
+	props := make(map[string]any, len(fields))
+	for name, ft := range fields {
+		props[name] = g.schema(ft)
+	}
+	return map[string]any{
+		"type":       "object",
+		"properties": props,
+	}
+}
+
+// enumValuesOf returns the values of the SDK enum type which has Values() method
+func enumValuesOf(t reflect.Type) []string {
+	m, ok := t.MethodByName("Values")
+	if !ok || m.Type.NumIn() != 1 || m.Type.NumOut() != 1 || m.Type.Out(0).Kind() != reflect.Slice || m.Type.Out(0).Elem() != t {
+		return nil
+	}
+	out := m.Func.Call([]reflect.Value{reflect.New(t).Elem()})[0]
+	values := make([]string, 0, out.Len())
+	for i := 0; i < out.Len(); i++ {
+		values = append(values, out.Index(i).String())
+	}
+	return values
+}
@@ -0,0 +1,96 @@
+package lambroll_test
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/fujiwara/lambroll"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGenerateSchema(t *testing.T) {
+	s, err := lambroll.GenerateSchema("function")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// round trip to compare as JSON values
+	b, _ := json.Marshal(s)
+	var schema struct {
+		Schema               string                    `json:"$schema"`
+		Properties           map[string]map[string]any `json:"properties"`
+		AdditionalProperties *bool                     `json:"additionalProperties"`
+		Defs                 map[string]map[string]any `json:"$defs"`
+	}
+	if err := json.Unmarshal(b, &schema); err != nil {
+		t.Fatal(err)
+	}
+	if schema.Schema != lambroll.JSONSchemaDraft {
+		t.Errorf("unexpected $schema %s", schema.Schema)
+	}
+	if schema.AdditionalProperties != nil {
+		t.Error("additionalProperties must not be defined. field names are case-insensitive")
+	}
+	if diff := cmp.Diff(map[string]any{"type": "integer"}, schema.Properties["MemorySize"]); diff != "" {
+		t.Errorf("unexpected MemorySize %s", diff)
+	}
+	if diff := cmp.Diff(map[string]any{
+		"type":  "array",
+		"items": map[string]any{"type": "string", "anyOf": []any{
+			map[string]any{"enum": []any{"x86_64", "arm64"}},
+			map[string]any{"type": "string"},
+		}},
+	}, schema.Properties["Architectures"]); diff != "" {
+		t.Errorf("unexpected Architectures %s", diff)
+	}
+	if enum := enumOf(schema.Properties["Runtime"]); !slices.Contains(enum, any("nodejs20.x")) {
+		t.Errorf("unexpected Runtime %v", schema.Properties["Runtime"])
+	}
+	if enum := enumOf(schema.Properties["PackageType"]); !slices.Contains(enum, any("Image")) {
+		t.Errorf("unexpected PackageType %v", schema.Properties["PackageType"])
+	}
+	// lambroll specific attributes
+	for name, ref := range map[string]string{
+		"Concurrency":       "#/$defs/Concurrency",
+		"EventInvokeConfig": "#/$defs/EventInvokeConfig",
+		"Image":             "#/$defs/Image",
+	} {
+		if got := schema.Properties[name]["$ref"]; got != ref {
+			t.Errorf("unexpected $ref of %s: %v", name, got)
+		}
+	}
+	if _, ok := schema.Defs["EventInvokeConfig"]["properties"].(map[string]any)["MaximumRetryAttempts"]; !ok {
+		t.Error("embedded fields of EventInvokeConfig are not defined")
+	}
+
+	s, err = lambroll.GenerateSchema("function-url")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = json.Marshal(s)
+	if err := json.Unmarshal(b, &schema); err != nil {
+		t.Fatal(err)
+	}
+	authType, _ := schema.Defs["CreateFunctionUrlConfigInput"]["properties"].(map[string]any)["AuthType"].(map[string]any)
+	if diff := cmp.Diff([]any{"NONE", "AWS_IAM"}, enumOf(authType)); diff != "" {
+		t.Errorf("unexpected AuthType %s", diff)
+	}
+
+	if _, err := lambroll.GenerateSchema("unknown"); err == nil {
+		t.Error("expected error for unknown target")
+	}
+}
+
+// enumOf returns the suggested values of the SDK enum type. It fails when the values are enforced.
+func enumOf(s map[string]any) []any {
+	anyOf, _ := s["anyOf"].([]any)
+	if len(anyOf) != 2 || s["enum"] != nil {
+		return nil
+	}
+	if other, _ := anyOf[1].(map[string]any); other["type"] != "string" {
+		return nil
+	}
+	values, _ := anyOf[0].(map[string]any)
+	enum, _ := values["enum"].([]any)
+	return enum
+}
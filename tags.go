@@ -4,16 +4,21 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/lambda"
 	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
 )
 
-func (app *App) updateTags(ctx context.Context, fn *Function, opt *DeployOption) error {
+func (app *App) updateTags(ctx context.Context, fn *FunctionDefinition, opt *DeployOption) error {
+	if opt.plan != nil {
+		if opt.plan.Tags == nil {
+			return nil
+		}
+		return app.applyTags(ctx, app.functionArn(ctx, *fn.FunctionName), opt.plan.Tags.Set, opt.plan.Tags.Remove, opt)
+	}
 	if fn.Tags == nil {
-		log.Println("[debug] Tags not defined in function.json skip updating tags")
+		app.logger.Println("[debug] Tags not defined in function.json skip updating tags")
 		return nil
 	}
 	arn := app.functionArn(ctx, *fn.FunctionName)
@@ -28,19 +33,29 @@ func (app *App) updateTags(ctx context.Context, fn *Function, opt *DeployOption)
 			return fmt.Errorf("failed to list tags of %s: %w", arn, err)
 		}
 	}
-	log.Printf("[debug] %d tags found", len(tags.Tags))
+	app.logger.Printf("[debug] %d tags found", len(tags.Tags))
 
 	setTags, removeTagKeys := mergeTags(tags.Tags, fn.Tags)
+	return app.applyTags(ctx, arn, setTags, removeTagKeys, opt)
+}
 
+func (app *App) applyTags(ctx context.Context, arn string, setTags Tags, removeTagKeys []string, opt *DeployOption) error {
 	if len(setTags) == 0 && len(removeTagKeys) == 0 {
-		log.Println("[debug] no need to update tags (unchanged)")
+		app.logger.Println("[debug] no need to update tags (unchanged)")
 		return nil
 	}
 
+	for key, value := range setTags {
+		app.logger.Printf("[debug] set tag %s=%s", key, value)
+	}
+	for _, key := range removeTagKeys {
+		app.logger.Printf("[debug] remove tag %s", key)
+	}
+
 	if n := len(setTags); n > 0 {
-		log.Printf("[info] setting %d tags %s", n, opt.label())
+		app.logger.Printf("[info] setting %d tags %s", n, opt.label())
 		if !opt.DryRun {
-			_, err = app.lambda.TagResource(ctx, &lambda.TagResourceInput{
+			_, err := app.lambda.TagResource(ctx, &lambda.TagResourceInput{
 				Resource: aws.String(arn),
 				Tags:     setTags,
 			})
@@ -51,9 +66,9 @@ func (app *App) updateTags(ctx context.Context, fn *Function, opt *DeployOption)
 	}
 
 	if n := len(removeTagKeys); n > 0 {
-		log.Printf("[info] removing %d tags %s", n, opt.label())
+		app.logger.Printf("[info] removing %d tags %s", n, opt.label())
 		if !opt.DryRun {
-			_, err = app.lambda.UntagResource(ctx, &lambda.UntagResourceInput{
+			_, err := app.lambda.UntagResource(ctx, &lambda.UntagResourceInput{
 				Resource: aws.String(arn),
 				TagKeys:  removeTagKeys,
 			})
@@ -73,17 +88,14 @@ func mergeTags(oldTags, newTags Tags) (sets Tags, removes []string) {
 	for key, oldValue := range oldTags {
 		if newValue, ok := newTags[key]; ok {
 			if newValue != oldValue {
-				log.Printf("[debug] update tag %s=%s", key, newValue)
 				sets[key] = newValue
 			}
 		} else {
-			log.Printf("[debug] remove tag %s", key)
 			removes = append(removes, key)
 		}
 	}
 	for key, newValue := range newTags {
 		if _, ok := oldTags[key]; !ok {
-			log.Printf("[debug] add tag %s=%s", key, newValue)
 			sets[key] = newValue
 		}
 	}
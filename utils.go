@@ -70,14 +70,14 @@ func marshalAny(s interface{}) (interface{}, error) {
 	return res, nil
 }
 
-func unmarshalJSON(src []byte, v interface{}, path string) error {
+func unmarshalJSON(src []byte, v interface{}, path string, logger *log.Logger) error {
 	strict := json.NewDecoder(bytes.NewReader(src))
 	strict.DisallowUnknownFields()
 	if err := strict.Decode(&v); err != nil {
 		if !strings.Contains(err.Error(), "unknown field") {
 			return err
 		}
-		log.Printf("[warn] %s in %s", err, path)
+		logger.Printf("[warn] %s in %s", err, path)
 
 		// unknown field -> try lax decoder
 		lax := json.NewDecoder(bytes.NewReader(src))
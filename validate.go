@@ -0,0 +1,378 @@
+package lambroll
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// ValidateOption represents options for Validate()
+type ValidateOption struct {
+	FunctionURL string `help:"path to function-url definition" default:"" env:"LAMBROLL_FUNCTION_URL"`
+}
+
+// Lambda limits checked by validate
+const (
+	MinMemorySize           = 128
+	MaxMemorySize           = 10240
+	MaxTimeout              = 900
+	MaxEnvironmentSize      = 4096
+	MaxLayers               = 5
+	MinEphemeralStorageSize = 512
+	MaxEphemeralStorageSize = 10240
+	MaxHandlerLength        = 128
+	MaxDescriptionLength    = 256
+	MaxCorsMaxAge           = 86400
+)
+
+var (
+	roleArnRegexp  = regexp.MustCompile(`^arn:(aws[a-zA-Z-]*)?:iam::\d{12}:role/?[a-zA-Z_0-9+=,.@\-_/]+$`)
+	layerArnRegexp = regexp.MustCompile(`^arn:[a-zA-Z0-9-]+:lambda:[a-zA-Z0-9-]+:\d{12}:layer:[a-zA-Z0-9-_]+:[0-9]+$`)
+
+	// handler formats for each runtime family
+	handlerRegexps = map[string]*regexp.Regexp{
+		"nodejs": regexp.MustCompile(`^[\w./-]+\.[\w$]+$`),        // file.export
+		"python": regexp.MustCompile(`^[\w./-]+\.\w+$`),           // module.function
+		"ruby":   regexp.MustCompile(`^[\w./-]+\.[\w:]+$`),        // file.method or file.Class::method
+		"java":   regexp.MustCompile(`^[\w.$]+(::\w+)?$`),         // package.Class or package.Class::method
+		"dotnet": regexp.MustCompile(`^[\w.-]+(::[\w.]+::\w+)?$`), // Assembly::Namespace.Class::Method
+	}
+	handlerFormats = map[string]string{
+		"nodejs": "file.export",
+		"python": "module.function",
+		"ruby":   "file.method",
+		"java":   "package.Class::method",
+		"dotnet": "Assembly::Namespace.Class::Method",
+	}
+
+	corsMethods = []string{"*", "GET", "PUT", "HEAD", "POST", "PATCH", "DELETE"}
+)
+
+// ValidationError represents an invalid value in the definition file
+type ValidationError struct {
+	Path    string // JSON pointer (RFC 6901)
+	Message string
+	Warning bool // does not fail the validation
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+type validationErrors []*ValidationError
+
+func (es *validationErrors) add(path string, format string, args ...any) {
+	*es = append(*es, &ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// warn adds a warning. It is used for values which may be valid but unknown to the AWS SDK of lambroll (e.g. a new runtime).
+func (es *validationErrors) warn(path string, format string, args ...any) {
+	*es = append(*es, &ValidationError{Path: path, Message: fmt.Sprintf(format, args...), Warning: true})
+}
+
+// Validate validates the function definition and the function URL definition offline
+func (app *App) Validate(ctx context.Context, opt *ValidateOption) error {
+	var errs []string
+	src, path, err := app.renderDefinitionFile(app.functionFilePath, DefaultFunctionFilenames)
+	if err != nil {
+		return fmt.Errorf("failed to load function: %w", err)
+	}
+	var fn FunctionDefinition
+	if err := json.Unmarshal(src, &fn); err != nil {
+		return fmt.Errorf("failed to load %s: %w", path, err)
+	}
+	ves := validateUnknownFields(src, reflect.TypeOf(fn))
+	ves = append(ves, validateFunction(&fn)...)
+	for _, e := range ves {
+		if e.Warning {
+			app.logger.Printf("[warn] %s#%s", path, e)
+			continue
+		}
+		errs = append(errs, path+"#"+e.Error())
+	}
+
+	if opt.FunctionURL != "" {
+		src, path, err := app.renderDefinitionFile(opt.FunctionURL, DefaultFunctionURLFilenames)
+		if err != nil {
+			return fmt.Errorf("failed to load function-url: %w", err)
+		}
+		var fu FunctionURL
+		if err := json.Unmarshal(src, &fu); err != nil {
+			return fmt.Errorf("failed to load %s: %w", path, err)
+		}
+		ves := validateUnknownFields(src, reflect.TypeOf(fu))
+		ves = append(ves, validateFunctionURL(&fu)...)
+		for _, e := range ves {
+			if e.Warning {
+				app.logger.Printf("[warn] %s#%s", path, e)
+				continue
+			}
+			errs = append(errs, path+"#"+e.Error())
+		}
+	}
+
+	for _, e := range errs {
+		fmt.Fprintln(app.stdout, e)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d validation errors found", len(errs))
+	}
+	app.logger.Println("[info] validation passed")
+	return nil
+}
+
+func validateFunction(fn *FunctionDefinition) validationErrors {
+	var errs validationErrors
+	if aws.ToString(fn.FunctionName) == "" {
+		errs.add("/FunctionName", "is required")
+	}
+
+	if role := aws.ToString(fn.Role); role == "" {
+		errs.add("/Role", "is required")
+	} else if !roleArnRegexp.MatchString(role) {
+		errs.add("/Role", "must be an IAM role ARN like arn:aws:iam::123456789012:role/name, but %q", role)
+	}
+
+	if fn.MemorySize != nil {
+		if m := *fn.MemorySize; m < MinMemorySize || m > MaxMemorySize {
+			errs.add("/MemorySize", "must be between %d and %d MB, but %d", MinMemorySize, MaxMemorySize, m)
+		}
+	}
+	if fn.Timeout != nil {
+		if t := *fn.Timeout; t < 1 || t > MaxTimeout {
+			errs.add("/Timeout", "must be between 1 and %d seconds, but %d", MaxTimeout, t)
+		}
+	}
+	if fn.EphemeralStorage != nil && fn.EphemeralStorage.Size != nil {
+		if s := *fn.EphemeralStorage.Size; s < MinEphemeralStorageSize || s > MaxEphemeralStorageSize {
+			errs.add("/EphemeralStorage/Size", "must be between %d and %d MB, but %d", MinEphemeralStorageSize, MaxEphemeralStorageSize, s)
+		}
+	}
+	if d := aws.ToString(fn.Description); len(d) > MaxDescriptionLength {
+		errs.add("/Description", "must be at most %d characters, but %d", MaxDescriptionLength, len(d))
+	}
+
+	if fn.Environment != nil {
+		size := 0
+		for k, v := range fn.Environment.Variables {
+			size += len(k) + len(v)
+		}
+		if size > MaxEnvironmentSize {
+			errs.add("/Environment/Variables", "total size must be at most %d bytes, but %d", MaxEnvironmentSize, size)
+		}
+	}
+
+	if n := len(fn.Layers); n > MaxLayers {
+		errs.add("/Layers", "must be at most %d layers, but %d", MaxLayers, n)
+	}
+	for i, layer := range fn.Layers {
+		if !layerArnRegexp.MatchString(layer) {
+			errs.add(fmt.Sprintf("/Layers/%d", i), "must be a layer version ARN, but %q", layer)
+		}
+	}
+
+	if fn.PackageType != "" && !slices.Contains(fn.PackageType.Values(), fn.PackageType) {
+		errs.warn("/PackageType", "unknown value %q. known values are %s", fn.PackageType, enumValues(fn.PackageType.Values()))
+	}
+	if fn.Runtime != "" && !slices.Contains(fn.Runtime.Values(), fn.Runtime) {
+		errs.warn("/Runtime", "unknown value %q. known values are %s", fn.Runtime, enumValues(fn.Runtime.Values()))
+	}
+	if n := len(fn.Architectures); n > 1 {
+		errs.add("/Architectures", "must have only one architecture, but %d", n)
+	}
+	for i, a := range fn.Architectures {
+		if !slices.Contains(a.Values(), a) {
+			errs.warn(fmt.Sprintf("/Architectures/%d", i), "unknown value %q. known values are %s", a, enumValues(a.Values()))
+		}
+	}
+
+	if fn.PackageType != types.PackageTypeImage {
+		validateHandler(&errs, fn.Runtime, aws.ToString(fn.Handler))
+	}
+
+	for i, p := range fn.Permissions {
+		if aws.ToString(p.Principal) == "" {
+			errs.add(fmt.Sprintf("/Permissions/%d/Principal", i), "is required")
+		}
+	}
+	return errs
+}
+
+func validateHandler(errs *validationErrors, runtime types.Runtime, handler string) {
+	if handler == "" {
+		errs.add("/Handler", "is required for Zip package type")
+		return
+	}
+	if len(handler) > MaxHandlerLength {
+		errs.add("/Handler", "must be at most %d characters, but %d", MaxHandlerLength, len(handler))
+		return
+	}
+	if strings.ContainsAny(handler, " \t\r\n") {
+		errs.add("/Handler", "must not contain whitespaces, but %q", handler)
+		return
+	}
+	for family, re := range handlerRegexps {
+		if strings.HasPrefix(string(runtime), family) && !re.MatchString(handler) {
+			errs.add("/Handler", "must be %s format for %s runtime, but %q", handlerFormats[family], runtime, handler)
+		}
+	}
+}
+
+func validateFunctionURL(fu *FunctionURL) validationErrors {
+	var errs validationErrors
+	c := fu.Config
+	if c == nil {
+		errs.add("/Config", "is required")
+		return errs
+	}
+	switch c.AuthType {
+	case "":
+		errs.add("/Config/AuthType", "is required")
+	case types.FunctionUrlAuthTypeNone:
+	case types.FunctionUrlAuthTypeAwsIam:
+		if len(fu.Permissions) == 0 {
+			errs.add("/Permissions", "is required when AuthType is %s", types.FunctionUrlAuthTypeAwsIam)
+		}
+	default:
+		errs.add("/Config/AuthType", "must be one of %s, but %q", enumValues(c.AuthType.Values()), c.AuthType)
+	}
+	if c.InvokeMode != "" && !slices.Contains(c.InvokeMode.Values(), c.InvokeMode) {
+		errs.add("/Config/InvokeMode", "must be one of %s, but %q", enumValues(c.InvokeMode.Values()), c.InvokeMode)
+	}
+	if q := aws.ToString(c.Qualifier); isVersionQualifier(q) {
+		errs.add("/Config/Qualifier", "must be an alias name or %s, but version %s", versionLatest, q)
+	}
+	if cors := c.Cors; cors != nil {
+		if cors.MaxAge != nil {
+			if a := *cors.MaxAge; a < 0 || a > MaxCorsMaxAge {
+				errs.add("/Config/Cors/MaxAge", "must be between 0 and %d seconds, but %d", MaxCorsMaxAge, a)
+			}
+		}
+		for i, m := range cors.AllowMethods {
+			if !slices.Contains(corsMethods, strings.ToUpper(m)) {
+				errs.add(fmt.Sprintf("/Config/Cors/AllowMethods/%d", i), "must be one of %s, but %q", strings.Join(corsMethods, ", "), m)
+			}
+		}
+	}
+	for i, p := range fu.Permissions {
+		if aws.ToString(p.Principal) == "" {
+			errs.add(fmt.Sprintf("/Permissions/%d/Principal", i), "is required")
+		}
+	}
+	return errs
+}
+
+func enumValues[T ~string](values []T) string {
+	s := make([]string, 0, len(values))
+	for _, v := range values {
+		s = append(s, string(v))
+	}
+	return strings.Join(s, ", ")
+}
+
+// validateUnknownFields returns errors of fields in src which are not defined in t
+func validateUnknownFields(src []byte, t reflect.Type) validationErrors {
+	var v any
+	if err := json.Unmarshal(src, &v); err != nil {
+		return nil
+	}
+	var errs validationErrors
+	for _, path := range unknownFields(v, t, "") {
+		errs.add(path, "unknown field")
+	}
+	return errs
+}
+
+// unknownFields returns JSON pointers of fields which are not defined in t.
+// Field names are matched case-insensitively like encoding/json.
+func unknownFields(v any, t reflect.Type, prefix string) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var paths []string
+	switch x := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		switch t.Kind() {
+		case reflect.Struct:
+			fields := jsonFields(t)
+			for _, k := range keys {
+				path := prefix + "/" + escapeJSONPointer(k)
+				ft, ok := lookupJSONField(fields, k)
+				if !ok {
+					paths = append(paths, path)
+					continue
+				}
+				paths = append(paths, unknownFields(x[k], ft, path)...)
+			}
+		case reflect.Map:
+			for _, k := range keys {
+				paths = append(paths, unknownFields(x[k], t.Elem(), prefix+"/"+escapeJSONPointer(k))...)
+			}
+		}
+	case []any:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for i, e := range x {
+				paths = append(paths, unknownFields(e, t.Elem(), fmt.Sprintf("%s/%d", prefix, i))...)
+			}
+		}
+	}
+	return paths
+}
+
+// jsonFields returns the types of fields of the struct t keyed by JSON names
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	// fields of embedded structs are shadowed by the fields of t
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && ft.Kind() == reflect.Struct && f.Tag.Get("json") == "" {
+			for name, t := range jsonFields(ft) {
+				fields[name] = t
+			}
+		}
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() || f.Anonymous && f.Tag.Get("json") == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+func lookupJSONField(fields map[string]reflect.Type, key string) (reflect.Type, bool) {
+	if t, ok := fields[key]; ok {
+		return t, true
+	}
+	for name, t := range fields {
+		if strings.EqualFold(name, key) {
+			return t, true
+		}
+	}
+	return nil, false
+}
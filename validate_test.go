@@ -0,0 +1,94 @@
+package lambroll_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fujiwara/lambroll"
+	"github.com/fujiwara/lambroll/lambrolltest"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestValidate(t *testing.T) {
+	ctx := context.Background()
+	app, err := lambrolltest.NewApp(ctx, &lambroll.Option{
+		Function: "test/validate/function.jsonnet",
+	}, lambrolltest.NewFakeLambda())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	app.SetStdout(&buf)
+	if err := app.Validate(ctx, &lambroll.ValidateOption{
+		FunctionURL: "test/validate/function_url.json",
+	}); err == nil {
+		t.Fatal("expected validation errors")
+	}
+	expected := []string{
+		"test/validate/function.jsonnet#/TracingConfig/Mod: unknown field",
+		`test/validate/function.jsonnet#/Role: must be an IAM role ARN like arn:aws:iam::123456789012:role/name, but "arn:aws:iam::123456789012:user/test"`,
+		"test/validate/function.jsonnet#/MemorySize: must be between 128 and 10240 MB, but 64",
+		"test/validate/function.jsonnet#/Timeout: must be between 1 and 900 seconds, but 901",
+		"test/validate/function.jsonnet#/EphemeralStorage/Size: must be between 512 and 10240 MB, but 20480",
+		"test/validate/function.jsonnet#/Environment/Variables: total size must be at most 4096 bytes, but 4102",
+		"test/validate/function.jsonnet#/Layers: must be at most 5 layers, but 6",
+		`test/validate/function.jsonnet#/Handler: must be file.export format for nodejs20.x runtime, but "index"`,
+		"test/validate/function.jsonnet#/Permissions/0/Principal: is required",
+		"test/validate/function_url.json#/Permissions: is required when AuthType is AWS_IAM",
+		"test/validate/function_url.json#/Config/Qualifier: must be an alias name or $LATEST, but version 1",
+		"test/validate/function_url.json#/Config/Cors/MaxAge: must be between 0 and 86400 seconds, but 100000",
+		`test/validate/function_url.json#/Config/Cors/AllowMethods/1: must be one of *, GET, PUT, HEAD, POST, PATCH, DELETE, but "CONNECT"`,
+	}
+	if diff := cmp.Diff(expected, strings.Split(strings.TrimSpace(buf.String()), "\n")); diff != "" {
+		t.Errorf("unexpected validation errors %s", diff)
+	}
+}
+
+func TestValidateValid(t *testing.T) {
+	ctx := context.Background()
+	app, err := lambrolltest.NewApp(ctx, &lambroll.Option{
+		Function: "test/fake/function.json",
+	}, lambrolltest.NewFakeLambda())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	app.SetStdout(&buf)
+	if err := app.Validate(ctx, &lambroll.ValidateOption{
+		FunctionURL: "test/fake/function_url.json",
+	}); err != nil {
+		t.Errorf("unexpected error %s %s", err, buf.String())
+	}
+}
+
+func TestValidateUnknownRuntime(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "function.json")
+	// values unknown to the AWS SDK of lambroll are warned, not rejected
+	def := `{
+  "FunctionName": "test",
+  "Handler": "index.handler",
+  "Role": "arn:aws:iam::123456789012:role/test_lambda_role",
+  "Runtime": "nodejs99.x",
+  "Architectures": ["riscv64"]
+}`
+	if err := os.WriteFile(path, []byte(def), 0644); err != nil {
+		t.Fatal(err)
+	}
+	app, err := lambrolltest.NewApp(ctx, &lambroll.Option{
+		Function: path,
+	}, lambrolltest.NewFakeLambda())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	app.SetStdout(&buf)
+	if err := app.Validate(ctx, &lambroll.ValidateOption{}); err != nil {
+		t.Errorf("unexpected error %s %s", err, buf.String())
+	}
+}